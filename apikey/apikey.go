@@ -0,0 +1,233 @@
+// Package apikey 服务端调用方的API Key。每个请求用Key的密钥对方法、路径、时间戳、
+// 随机数和请求体哈希做 HMAC-SHA256 签名，服务端校验签名、时间偏差并拒绝重复的随机数。
+//
+// 密钥由配置中的主密钥和Key的公开标识派生，数据库只保存密钥的哈希：
+// 数据库泄露不会暴露密钥，校验时用各个主密钥重新派生并与哈希比对，从而支持主密钥轮换
+package apikey
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/dao/redis"
+	"web_app/models"
+	"web_app/rbac"
+	"web_app/settings"
+
+	"go.uber.org/zap"
+)
+
+const defaultMaxSkew = 5 * time.Minute
+
+var (
+	// ErrNoSecret 没有配置可用的主密钥，无法签发
+	ErrNoSecret = errors.New("apikey: no usable master secret configured")
+	// ErrInvalidScope 权限范围写法不正确
+	ErrInvalidScope = errors.New("apikey: invalid scope")
+	// ErrUnknownKey Key不存在或已吊销
+	ErrUnknownKey = errors.New("apikey: unknown or revoked key")
+	// ErrClockSkew 请求时间戳超出允许的偏差
+	ErrClockSkew = errors.New("apikey: timestamp outside allowed window")
+	// ErrBadSignature 签名不正确
+	ErrBadSignature = errors.New("apikey: bad signature")
+	// ErrReplay 随机数已被使用
+	ErrReplay = errors.New("apikey: nonce already used")
+
+	nonceRe = regexp.MustCompile(`^[A-Za-z0-9_-]{16,64}$`)
+)
+
+// record 缓存中的Key，models.APIKey 序列化时不包含密钥哈希
+type record struct {
+	*models.APIKey
+	SecretHash string `json:"secret_hash"`
+}
+
+// keyCache 按公开标识缓存Key，吊销后立即失效
+var keyCache = redis.NewCache[*record]("api_key", redis.CacheOptions{TTL: 5 * time.Minute})
+
+func init() {
+	mysql.OnWrite("api_keys", func(ctx context.Context, keyIDs []string) {
+		if err := keyCache.Invalidate(ctx, keyIDs...); err != nil {
+			zap.L().Warn("清除API Key缓存失败", zap.Strings("key_ids", keyIDs), zap.Error(err))
+		}
+	})
+}
+
+// Issue 签发新Key，返回的密钥明文只出现这一次
+func Issue(ctx context.Context, key *models.APIKey) (secret string, err error) {
+	masters := settings.Config().APIKeyConfig.Secrets
+	if len(masters) == 0 || len(masters[0]) < 32 {
+		return "", ErrNoSecret
+	}
+	for _, s := range key.Scopes {
+		if !rbac.ValidPermission(s) {
+			return "", ErrInvalidScope
+		}
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	key.KeyID = "ak_" + hex.EncodeToString(b)
+	secret = derive(masters[0], key.KeyID)
+	key.SecretHash = hashSecret(secret)
+	if err = mysql.CreateAPIKey(ctx, key); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// List 所有Key
+func List(ctx context.Context) ([]*models.APIKey, error) {
+	return mysql.ListAPIKeys(ctx)
+}
+
+// Revoke 吊销Key，所有实例的缓存同时失效
+func Revoke(ctx context.Context, keyID string) error {
+	return mysql.RevokeAPIKey(ctx, keyID)
+}
+
+// Request 待校验的签名请求
+type Request struct {
+	KeyID     string
+	Method    string
+	URI       string // 路径和查询字符串，例如 /api/v2/createExchangeRate?dry_run=1
+	Timestamp string // Unix 秒
+	Nonce     string // 16到64位的字母、数字、下划线或连字符
+	Signature string // 小写十六进制
+	Body      []byte
+}
+
+// StringToSign 签名原文，各部分以换行分隔：方法、路径、时间戳、随机数、请求体的 SHA-256 十六进制
+func StringToSign(method, uri, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{strings.ToUpper(method), uri, timestamp, nonce, hex.EncodeToString(sum[:])}, "\n")
+}
+
+// Sign 用Key的密钥计算签名，调用方按同样的方式签名
+func Sign(secret, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验签名请求，依次检查时间偏差、Key、签名和随机数。
+// 随机数在签名通过后才记录，伪造的请求无法占用合法调用方的随机数；
+// redis 不可用时无法防重放，返回错误由调用方拒绝请求
+func Verify(ctx context.Context, req *Request) (*models.APIKey, error) {
+	p, err := Prepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return p.Verify(ctx, req.Body)
+}
+
+// Pending 请求头已经校验通过、等待请求体的签名请求
+type Pending struct {
+	req    Request
+	rec    *record
+	secret string
+	skew   time.Duration
+}
+
+// Prepare 只用请求头做不需要请求体的检查：时间偏差、随机数格式、Key是否存在。
+// 调用方通过后再读取请求体，未认证的请求不会让服务端缓冲大请求体；req.Body 被忽略
+func Prepare(ctx context.Context, req *Request) (*Pending, error) {
+	skew := settings.Config().APIKeyConfig.MaxSkew
+	if skew <= 0 {
+		skew = defaultMaxSkew
+	}
+	ts, err := strconv.ParseInt(req.Timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrClockSkew
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > skew || d < -skew {
+		return nil, ErrClockSkew
+	}
+	if !nonceRe.MatchString(req.Nonce) {
+		return nil, ErrBadSignature
+	}
+	rec, err := keyCache.GetOrLoad(ctx, req.KeyID, func(ctx context.Context) (*record, error) {
+		// 吊销后缓存被清除，立即重新加载时副本可能还没同步到吊销，必须读主库
+		key, err := mysql.GetAPIKey(mysql.WithPrimary(ctx), req.KeyID)
+		if err == nil && key == nil {
+			return nil, redis.ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &record{APIKey: key, SecretHash: key.SecretHash}, nil
+	})
+	if errors.Is(err, redis.ErrNotFound) {
+		return nil, ErrUnknownKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rec.RevokedAt != nil {
+		return nil, ErrUnknownKey
+	}
+	secret, ok := secretFor(rec)
+	if !ok {
+		zap.L().Warn("没有能派生出该Key密钥的主密钥", zap.String("key_id", rec.KeyID))
+		return nil, ErrUnknownKey
+	}
+	return &Pending{req: *req, rec: rec, secret: secret, skew: skew}, nil
+}
+
+// Verify 校验覆盖请求体的签名并记录随机数
+func (p *Pending) Verify(ctx context.Context, body []byte) (*models.APIKey, error) {
+	req := &p.req
+	want := Sign(p.secret, StringToSign(req.Method, req.URI, req.Timestamp, req.Nonce, body))
+	if !hmac.Equal([]byte(want), []byte(strings.ToLower(req.Signature))) {
+		return nil, ErrBadSignature
+	}
+	fresh, err := redis.ClaimNonce(ctx, "api_key:"+p.rec.KeyID+":"+req.Nonce, 2*p.skew)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, ErrReplay
+	}
+	return p.rec.APIKey, nil
+}
+
+// Allows 判断Key的权限范围是否包含 permission，匹配规则与角色权限相同
+func Allows(key *models.APIKey, permission string) bool {
+	for _, scope := range key.Scopes {
+		if rbac.Matches(scope, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretFor 依次用配置的主密钥派生密钥，与保存的哈希一致即为该Key的密钥
+func secretFor(rec *record) (string, bool) {
+	for _, master := range settings.Config().APIKeyConfig.Secrets {
+		secret := derive(master, rec.KeyID)
+		if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(rec.SecretHash)) == 1 {
+			return secret, true
+		}
+	}
+	return "", false
+}
+
+func derive(master, keyID string) string {
+	mac := hmac.New(sha256.New, []byte(master))
+	mac.Write([]byte(keyID))
+	return "sk_" + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,125 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/dao/redis/redistest"
+	"web_app/models"
+	"web_app/settings"
+)
+
+func setup(t *testing.T) (context.Context, *models.APIKey, string) {
+	t.Helper()
+	ctx := context.Background()
+	_, stop := redistest.Start()
+	t.Cleanup(stop)
+	if err := mysql.Init(settings.MysqlConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "test.db")}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mysql.Close() })
+	if err := mysql.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	prev := settings.Config().APIKeyConfig
+	settings.Config().APIKeyConfig = settings.APIKeyConfig{Secrets: []string{strings.Repeat("m", 32)}}
+	t.Cleanup(func() { settings.Config().APIKeyConfig = prev })
+	key := &models.APIKey{Name: "test"}
+	secret, err := Issue(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx, key, secret
+}
+
+func TestVerify(t *testing.T) {
+	ctx, key, secret := setup(t)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	signed := func(r Request) *Request {
+		r.Signature = Sign(secret, StringToSign(r.Method, r.URI, r.Timestamp, r.Nonce, r.Body))
+		return &r
+	}
+	base := Request{KeyID: key.KeyID, Method: "POST", URI: "/api/v2/createExchangeRate", Timestamp: now, Body: []byte(`{"rate":7.1}`)}
+	with := func(nonce string, edit func(r *Request)) *Request {
+		r := base
+		r.Nonce = nonce
+		req := signed(r)
+		if edit != nil {
+			edit(req)
+		}
+		return req
+	}
+	tests := []struct {
+		name string
+		req  *Request
+		want error
+	}{
+		{"valid", with("nonce-valid-000001", nil), nil},
+		{"upper case signature", with("nonce-upper-000001", func(r *Request) { r.Signature = strings.ToUpper(r.Signature) }), nil},
+		{"body changed after signing", with("nonce-body-0000001", func(r *Request) { r.Body = []byte(`{"rate":9.9}`) }), ErrBadSignature},
+		{"uri changed after signing", with("nonce-uri-00000001", func(r *Request) { r.URI += "?dry_run=1" }), ErrBadSignature},
+		{"signed with another secret", with("nonce-secret-00001", func(r *Request) {
+			r.Signature = Sign("sk_other", StringToSign(r.Method, r.URI, r.Timestamp, r.Nonce, r.Body))
+		}), ErrBadSignature},
+		{"stale timestamp", with("nonce-stale-000001", func(r *Request) {
+			r.Timestamp = strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+		}), ErrClockSkew},
+		{"timestamp not a number", with("nonce-ts-000000001", func(r *Request) { r.Timestamp = "yesterday" }), ErrClockSkew},
+		{"malformed nonce", with("short", nil), ErrBadSignature},
+		{"unknown key", with("nonce-unknown-0001", func(r *Request) { r.KeyID = "ak_0000000000000000" }), ErrUnknownKey},
+		{"replayed nonce", with("nonce-valid-000001", nil), ErrReplay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(ctx, tt.req)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err == nil && got.KeyID != key.KeyID {
+				t.Errorf("key = %s, want %s", got.KeyID, key.KeyID)
+			}
+		})
+	}
+}
+
+func TestVerifyRevoked(t *testing.T) {
+	tests := []struct {
+		name   string
+		cached bool // 吊销前是否已经校验过一次，Key进入缓存
+	}{
+		{"cached before revoke", true},
+		{"not cached before revoke", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, key, secret := setup(t)
+			req := func(nonce string) *Request {
+				r := &Request{KeyID: key.KeyID, Method: "GET", URI: "/api/v2/rates", Timestamp: strconv.FormatInt(time.Now().Unix(), 10), Nonce: nonce}
+				r.Signature = Sign(secret, StringToSign(r.Method, r.URI, r.Timestamp, r.Nonce, nil))
+				return r
+			}
+			if tt.cached {
+				if _, err := Verify(ctx, req("nonce-before-revoke")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := Revoke(ctx, key.KeyID); err != nil {
+				t.Fatal(err)
+			}
+			// 吊销后的第一次校验重新加载Key，之后的校验命中缓存里的吊销状态
+			for _, nonce := range []string{"nonce-after-revoke1", "nonce-after-revoke2"} {
+				if _, err := Verify(ctx, req(nonce)); !errors.Is(err, ErrUnknownKey) {
+					t.Errorf("%s: got %v, want %v", nonce, err, ErrUnknownKey)
+				}
+			}
+			if err := Revoke(ctx, key.KeyID); !errors.Is(err, mysql.ErrNotFound) {
+				t.Errorf("revoke twice: got %v, want %v", err, mysql.ErrNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+// Package auth 签发和校验JWT。访问令牌短期有效，每次请求校验签名和吊销列表；
+// 刷新令牌每次使用后轮换，同一次登录轮换出来的刷新令牌属于同一个令牌族，
+// 已轮换的旧令牌再次出现视为泄露，整个令牌族被吊销
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"web_app/dao/redis"
+	"web_app/settings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAccessTTL  = 15 * time.Minute
+	defaultRefreshTTL = 720 * time.Hour
+
+	useAccess  = "access"
+	useRefresh = "refresh"
+)
+
+var (
+	// ErrNoSigningKey 没有配置可用于签发的密钥
+	ErrNoSigningKey = errors.New("auth: no signing key")
+	// ErrInvalidToken 令牌格式、签名、有效期或用途不正确
+	ErrInvalidToken = errors.New("auth: invalid token")
+	// ErrTokenRevoked 令牌已被吊销
+	ErrTokenRevoked = errors.New("auth: token revoked")
+	// ErrTokenReused 已轮换的刷新令牌被再次使用，所属令牌族已被吊销
+	ErrTokenReused = errors.New("auth: refresh token reused")
+)
+
+// Claims 令牌中的声明，Subject 为用户ID
+type Claims struct {
+	jwt.RegisteredClaims
+	// TokenUse access 或 refresh，刷新令牌不能当作访问令牌使用
+	TokenUse string `json:"token_use"`
+	// Family 令牌族ID，同一次登录签发的访问令牌和刷新令牌相同，退出登录时据此吊销刷新令牌
+	Family string `json:"fam"`
+	// IssuedAtMicro 微秒精度的签发时间。iat 只精确到秒，RevokeAll 之后同一秒内重新登录签发的令牌
+	// 需要据此与吊销时间点比较
+	IssuedAtMicro int64 `json:"iat_us"`
+}
+
+// TokenPair 签发给客户端的令牌对，有效期单位为秒
+type TokenPair struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshExpiresIn int    `json:"refresh_expires_in"`
+}
+
+// current 当前生效的密钥集合，为 nil 表示尚未初始化
+var current atomic.Pointer[keySet]
+
+// Init 加载密钥集合，修改配置文件后重新加载；新配置无效时保留原来的密钥并记录日志。
+// 首次加载失败时同样监听配置变化，补上密钥后不需要重启
+func Init(cfg settings.AuthConfig) error {
+	settings.OnChange(func() {
+		ks, err := loadKeys(settings.Config().AuthConfig)
+		if err != nil {
+			zap.L().Error("重新加载令牌密钥失败，继续使用原密钥", zap.Error(err))
+			return
+		}
+		current.Store(ks)
+	})
+	ks, err := loadKeys(cfg)
+	if err != nil {
+		return err
+	}
+	current.Store(ks)
+	return nil
+}
+
+// Issue 为用户开始新的令牌族，签发访问令牌和刷新令牌
+func Issue(ctx context.Context, subject string) (*TokenPair, error) {
+	ks := current.Load()
+	if ks == nil || ks.active == nil {
+		return nil, ErrNoSigningKey
+	}
+	family, jti := newID(), newID()
+	if err := redis.SetRefreshFamily(ctx, family, jti, ks.refreshTTL()); err != nil {
+		return nil, err
+	}
+	return ks.issuePair(subject, family, jti)
+}
+
+// Refresh 用刷新令牌换取新的令牌对，旧的刷新令牌随即失效
+func Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	ks := current.Load()
+	if ks == nil || ks.active == nil {
+		return nil, ErrNoSigningKey
+	}
+	claims, err := ks.parse(refreshToken, useRefresh)
+	if err != nil {
+		return nil, err
+	}
+	if revoked, err := revokedBefore(ctx, claims); err != nil || revoked {
+		if err == nil {
+			err = ErrTokenRevoked
+		}
+		return nil, err
+	}
+	jti := newID()
+	ok, latest, err := redis.RotateRefreshFamily(ctx, claims.Family, claims.ID, jti, ks.refreshTTL())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if latest == "" {
+			return nil, ErrTokenRevoked
+		}
+		zap.L().Warn("刷新令牌被重复使用，吊销令牌族",
+			zap.String("subject", claims.Subject), zap.String("family", claims.Family))
+		if err := redis.RevokeRefreshFamily(ctx, claims.Family); err != nil {
+			return nil, err
+		}
+		return nil, ErrTokenReused
+	}
+	return ks.issuePair(claims.Subject, claims.Family, jti)
+}
+
+// Verify 校验访问令牌。redis 不可用时无法查询吊销列表，记录日志后放行，
+// 访问令牌有效期很短，这段时间内被吊销的令牌仍然可用
+func Verify(ctx context.Context, accessToken string) (*Claims, error) {
+	ks := current.Load()
+	if ks == nil {
+		return nil, ErrInvalidToken
+	}
+	claims, err := ks.parse(accessToken, useAccess)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := redis.TokenRevoked(ctx, claims.ID)
+	if err == nil && !revoked {
+		revoked, err = revokedBefore(ctx, claims)
+	}
+	if err != nil {
+		zap.L().Warn("查询令牌吊销列表失败，跳过吊销检查", zap.String("jti", claims.ID), zap.Error(err))
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// Revoke 吊销访问令牌，并吊销同一令牌族的刷新令牌，用于退出登录
+func Revoke(ctx context.Context, claims *Claims) error {
+	if claims.ExpiresAt != nil {
+		if err := redis.RevokeToken(ctx, claims.ID, time.Until(claims.ExpiresAt.Time)); err != nil {
+			return err
+		}
+	}
+	return redis.RevokeRefreshFamily(ctx, claims.Family)
+}
+
+// RevokeAll 吊销用户此前签发的所有访问令牌和刷新令牌，用于在所有设备上退出登录。
+// 按微秒精度的签发时间比较，之后立即重新登录签发的令牌不受影响
+func RevokeAll(ctx context.Context, subject string) error {
+	ttl := defaultRefreshTTL
+	if ks := current.Load(); ks != nil {
+		ttl = max(ks.accessTTL(), ks.refreshTTL())
+	}
+	return redis.RevokeSubjectTokens(ctx, subject, time.Now(), ttl)
+}
+
+// revokedBefore 令牌是否在用户的吊销时间点之前签发，按微秒比较
+func revokedBefore(ctx context.Context, claims *Claims) (bool, error) {
+	cutoff, err := redis.SubjectTokensRevokedBefore(ctx, claims.Subject)
+	if err != nil || cutoff.IsZero() {
+		return false, err
+	}
+	return time.UnixMicro(claims.IssuedAtMicro).Before(cutoff), nil
+}
+
+func (ks *keySet) issuePair(subject, family, refreshID string) (*TokenPair, error) {
+	now := time.Now()
+	access, err := ks.sign(subject, family, newID(), useAccess, now, ks.accessTTL())
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := ks.sign(subject, family, refreshID, useRefresh, now, ks.refreshTTL())
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(ks.accessTTL().Seconds()),
+		RefreshExpiresIn: int(ks.refreshTTL().Seconds()),
+	}, nil
+}
+
+func (ks *keySet) sign(subject, family, jti, use string, now time.Time, ttl time.Duration) (string, error) {
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    ks.cfg.Issuer,
+			Subject:   subject,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+		TokenUse:      use,
+		Family:        family,
+		IssuedAtMicro: now.UnixMicro(),
+	}
+	if ks.cfg.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{ks.cfg.Audience}
+	}
+	t := jwt.NewWithClaims(ks.active.method, claims)
+	t.Header["kid"] = ks.active.kid
+	return t.SignedString(ks.active.sign)
+}
+
+// parse 校验签名、签发者、受众、有效期和令牌用途
+func (ks *keySet) parse(raw, use string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(ks.methods),
+		jwt.WithLeeway(ks.cfg.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if ks.cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(ks.cfg.Issuer))
+	}
+	if ks.cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(ks.cfg.Audience))
+	}
+	claims := new(Claims)
+	if _, err := jwt.ParseWithClaims(raw, claims, ks.keyFunc, opts...); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.TokenUse != use || claims.ID == "" || claims.Family == "" {
+		return nil, fmt.Errorf("%w: token_use is not %s", ErrInvalidToken, use)
+	}
+	return claims, nil
+}
+
+func (ks *keySet) accessTTL() time.Duration {
+	if ks.cfg.AccessTTL > 0 {
+		return ks.cfg.AccessTTL
+	}
+	return defaultAccessTTL
+}
+
+func (ks *keySet) refreshTTL() time.Duration {
+	if ks.cfg.RefreshTTL > 0 {
+		return ks.cfg.RefreshTTL
+	}
+	return defaultRefreshTTL
+}
+
+type claimsKey struct{}
+
+// NewContext 把声明放入 context，供 logic 层读取当前用户
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext 取出认证中间件放入的声明，未认证时返回 nil
+func FromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*Claims)
+	return claims
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"web_app/dao/redis/redistest"
+	"web_app/settings"
+)
+
+func setup(t *testing.T) context.Context {
+	t.Helper()
+	_, stop := redistest.Start()
+	t.Cleanup(stop)
+	err := Init(settings.AuthConfig{
+		ActiveKey: "k1",
+		Keys:      []settings.AuthKey{{Kid: "k1", Alg: "HS256", Secret: strings.Repeat("s", 32)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return context.Background()
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := setup(t)
+	tests := []struct {
+		name string
+		// run 在刚签发的令牌对上执行操作，返回最后一次调用的错误
+		run  func(first *TokenPair) error
+		want error
+	}{
+		{"rotate", func(first *TokenPair) error {
+			_, err := Refresh(ctx, first.RefreshToken)
+			return err
+		}, nil},
+		{"reuse of rotated token", func(first *TokenPair) error {
+			if _, err := Refresh(ctx, first.RefreshToken); err != nil {
+				return err
+			}
+			_, err := Refresh(ctx, first.RefreshToken)
+			return err
+		}, ErrTokenReused},
+		{"family revoked after reuse", func(first *TokenPair) error {
+			second, err := Refresh(ctx, first.RefreshToken)
+			if err != nil {
+				return err
+			}
+			Refresh(ctx, first.RefreshToken)
+			_, err = Refresh(ctx, second.RefreshToken)
+			return err
+		}, ErrTokenRevoked},
+		{"access token used as refresh token", func(first *TokenPair) error {
+			_, err := Refresh(ctx, first.AccessToken)
+			return err
+		}, ErrInvalidToken},
+		{"after logout", func(first *TokenPair) error {
+			claims, err := Verify(ctx, first.AccessToken)
+			if err != nil {
+				return err
+			}
+			if err := Revoke(ctx, claims); err != nil {
+				return err
+			}
+			_, err = Refresh(ctx, first.RefreshToken)
+			return err
+		}, ErrTokenRevoked},
+		{"after revoke all", func(first *TokenPair) error {
+			if err := RevokeAll(ctx, "42"); err != nil {
+				return err
+			}
+			_, err := Refresh(ctx, first.RefreshToken)
+			return err
+		}, ErrTokenRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, err := Issue(ctx, "42")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.run(first); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevokeAll(t *testing.T) {
+	ctx := setup(t)
+	old, err := Issue(ctx, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeAll(ctx, "7"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(ctx, old.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("access token issued before RevokeAll: got %v, want %v", err, ErrTokenRevoked)
+	}
+	// 吊销后立即重新登录签发的令牌不受影响
+	fresh, err := Issue(ctx, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(ctx, fresh.AccessToken); err != nil {
+		t.Errorf("access token issued after RevokeAll: %v", err)
+	}
+	if _, err := Refresh(ctx, fresh.RefreshToken); err != nil {
+		t.Errorf("refresh token issued after RevokeAll: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"web_app/settings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// key 一个签名密钥，sign 为 nil 时只用于校验
+type key struct {
+	kid    string
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+// keySet 编译好的密钥集合和令牌参数，配置热加载时整体替换
+type keySet struct {
+	cfg     settings.AuthConfig
+	keys    map[string]*key
+	active  *key
+	methods []string // 集合中出现的算法，校验时只接受这些算法
+}
+
+// loadKeys 解析配置中的密钥，任何一个密钥无效都返回错误，避免轮换时悄悄丢掉密钥
+func loadKeys(cfg settings.AuthConfig) (*keySet, error) {
+	ks := &keySet{cfg: cfg, keys: make(map[string]*key)}
+	seen := make(map[string]bool)
+	for _, kc := range cfg.Keys {
+		if kc.Kid == "" {
+			return nil, errors.New("auth: key without kid")
+		}
+		if ks.keys[kc.Kid] != nil {
+			return nil, fmt.Errorf("auth: duplicate kid %q", kc.Kid)
+		}
+		k, err := parseKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("auth: key %q: %w", kc.Kid, err)
+		}
+		ks.keys[k.kid] = k
+		if !seen[k.method.Alg()] {
+			seen[k.method.Alg()] = true
+			ks.methods = append(ks.methods, k.method.Alg())
+		}
+		if ks.active == nil && cfg.ActiveKey == "" && k.sign != nil {
+			ks.active = k
+		}
+	}
+	if cfg.ActiveKey != "" {
+		ks.active = ks.keys[cfg.ActiveKey]
+		if ks.active == nil {
+			return nil, fmt.Errorf("auth: active key %q not found", cfg.ActiveKey)
+		}
+		if ks.active.sign == nil {
+			return nil, fmt.Errorf("auth: active key %q has no private key", cfg.ActiveKey)
+		}
+	}
+	return ks, nil
+}
+
+func parseKey(kc settings.AuthKey) (*key, error) {
+	k := &key{kid: kc.Kid}
+	switch kc.Alg {
+	case "HS256":
+		if len(kc.Secret) < 32 {
+			return nil, errors.New("HS256 secret must be at least 32 bytes")
+		}
+		k.method = jwt.SigningMethodHS256
+		k.sign, k.verify = []byte(kc.Secret), []byte(kc.Secret)
+	case "RS256":
+		k.method = jwt.SigningMethodRS256
+		if kc.PrivateKey != "" {
+			pem, err := readPEM(kc.PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+			priv, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			k.sign, k.verify = priv, &priv.PublicKey
+		}
+		if kc.PublicKey != "" {
+			pem, err := readPEM(kc.PublicKey)
+			if err != nil {
+				return nil, err
+			}
+			if k.verify, err = jwt.ParseRSAPublicKeyFromPEM(pem); err != nil {
+				return nil, err
+			}
+		}
+	case "EdDSA":
+		k.method = jwt.SigningMethodEdDSA
+		if kc.PrivateKey != "" {
+			pem, err := readPEM(kc.PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+			priv, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			k.sign, k.verify = priv, priv.(ed25519.PrivateKey).Public()
+		}
+		if kc.PublicKey != "" {
+			pem, err := readPEM(kc.PublicKey)
+			if err != nil {
+				return nil, err
+			}
+			if k.verify, err = jwt.ParseEdPublicKeyFromPEM(pem); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %q", kc.Alg)
+	}
+	if k.verify == nil {
+		return nil, errors.New("private_key or public_key is required")
+	}
+	return k, nil
+}
+
+// readPEM 配置值以 -----BEGIN 开头时为PEM内容，否则为文件路径
+func readPEM(v string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(v), "-----BEGIN") {
+		return []byte(v), nil
+	}
+	return os.ReadFile(v)
+}
+
+// keyFunc 按令牌头中的 kid 选择校验密钥，并要求令牌的算法与密钥一致，防止算法混淆
+func (ks *keySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	k := ks.keys[kid]
+	if k == nil {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("alg %s does not match key %q", t.Method.Alg(), kid)
+	}
+	return k.verify, nil
+}
+
+// JWK 公钥的 JSON Web Key 表示
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet GET /.well-known/jwks.json 的响应
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS 集合中非对称密钥的公钥，供其他服务校验本服务签发的令牌；HS256 共享密钥不公开
+func JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	ks := current.Load()
+	if ks == nil {
+		return set
+	}
+	enc := base64.RawURLEncoding
+	for _, kc := range ks.cfg.Keys {
+		k := ks.keys[kc.Kid]
+		switch pub := k.verify.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{Kty: "RSA", Kid: k.kid, Alg: k.method.Alg(), Use: "sig",
+				N: enc.EncodeToString(pub.N.Bytes()), E: enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{Kty: "OKP", Kid: k.kid, Alg: k.method.Alg(), Use: "sig",
+				Crv: "Ed25519", X: enc.EncodeToString(pub)})
+		}
+	}
+	return set
+}
@@ -0,0 +1,165 @@
+// Package captcha 数字图片验证码。答案保存在redis中，校验一次后即作废，
+// 图片以 data URL 返回，前端直接作为 <img> 的 src 使用
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
+	"math/big"
+	mrand "math/rand"
+	"strings"
+	"time"
+	"web_app/dao/redis"
+	"web_app/settings"
+)
+
+const (
+	defaultTTL = 5 * time.Minute
+	length     = 5
+
+	width  = 150
+	height = 50
+	scale  = 4 // 字模放大倍数，5x7 的字模绘制为 20x28 像素
+)
+
+// Captcha 返回给客户端的验证码
+type Captcha struct {
+	ID        string `json:"id"`
+	Image     string `json:"image"`      // data:image/png;base64,...
+	ExpiresIn int    `json:"expires_in"` // 秒
+}
+
+// New 生成验证码并保存答案
+func New(ctx context.Context) (*Captcha, error) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	// 答案用 crypto/rand 生成，math/rand 的输出可以由之前的验证码推算
+	answer := make([]byte, length)
+	for i := range answer {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return nil, err
+		}
+		answer[i] = byte('0' + n.Int64())
+	}
+	ttl := settings.Config().SecurityConfig.CaptchaTTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	if err := redis.SaveCaptcha(ctx, id, string(answer), ttl); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, render(string(answer))); err != nil {
+		return nil, err
+	}
+	return &Captcha{
+		ID:        id,
+		Image:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+		ExpiresIn: int(ttl.Seconds()),
+	}, nil
+}
+
+// Verify 校验答案，无论对错验证码都会作废，客户端需要重新获取
+func Verify(ctx context.Context, id, answer string) (bool, error) {
+	if id == "" || answer == "" {
+		return false, nil
+	}
+	return redis.ConsumeCaptcha(ctx, id, strings.TrimSpace(answer))
+}
+
+// render 绘制数字：每个数字随机颜色、位置和倾斜，叠加干扰线和噪点
+func render(answer string) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	bg := color.RGBA{uint8(230 + mrand.Intn(26)), uint8(230 + mrand.Intn(26)), uint8(230 + mrand.Intn(26)), 255}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, bg)
+		}
+	}
+	cell := width / len(answer)
+	for i, ch := range answer {
+		glyph := digits[ch-'0']
+		fg := randomDark()
+		x0 := i*cell + (cell-5*scale)/2 + mrand.Intn(7) - 3
+		y0 := mrand.Intn(height - 7*scale)
+		shear := mrand.Float64() - 0.5 // 每行的水平偏移，单位为像素
+		for row, line := range glyph {
+			dx := int(float64(row-3) * shear * scale)
+			for col, bit := range line {
+				if bit != '#' {
+					continue
+				}
+				for py := 0; py < scale; py++ {
+					for px := 0; px < scale; px++ {
+						img.Set(x0+dx+col*scale+px, y0+row*scale+py, fg)
+					}
+				}
+			}
+		}
+	}
+	for i := 0; i < 5; i++ {
+		line(img, mrand.Intn(width), mrand.Intn(height), mrand.Intn(width), mrand.Intn(height), randomDark())
+	}
+	for i := 0; i < width*height/15; i++ {
+		img.Set(mrand.Intn(width), mrand.Intn(height), randomDark())
+	}
+	return img
+}
+
+// line Bresenham 画线
+func line(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	for e := dx + dy; ; {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * e; e2 >= dy {
+			e += dy
+			x0 += sx
+		} else {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func randomDark() color.RGBA {
+	return color.RGBA{uint8(mrand.Intn(150)), uint8(mrand.Intn(150)), uint8(mrand.Intn(150)), 255}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// digits 5x7 点阵字模
+var digits = [10][7]string{
+	{".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	{"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	{".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	{"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	{"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	{"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	{"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	{"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	{".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	{".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+}
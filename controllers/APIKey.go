@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"web_app/apikey"
+	"web_app/dao/mysql"
+	"web_app/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type IssueAPIKeyRequest struct {
+	Name       string   `json:"name" binding:"required,max=128" description:"调用方名称"`
+	Scopes     []string `json:"scopes" description:"允许的权限，例如 exchange_rates:create"`
+	RateLimit  int      `json:"rate_limit" binding:"gte=0" description:"窗口内最大请求数，0表示不限流"`
+	RateWindow int      `json:"rate_window" binding:"gte=0" description:"限流窗口，单位秒"`
+}
+
+// IssueAPIKeyResponse 新签发的Key，Secret 只返回这一次
+type IssueAPIKeyResponse struct {
+	Key    *models.APIKey `json:"key"`
+	Secret string         `json:"secret"`
+}
+
+// IssueAPIKey 为服务端调用方签发API Key
+// 请求示例: POST /api/v1/api-keys (X-Admin-Token: xxx)
+// 请求体: {"name": "partner-a", "scopes": ["exchange_rates:create"], "rate_limit": 100, "rate_window": 60}
+func IssueAPIKey(ctx *gin.Context) {
+	var req IssueAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	key := &models.APIKey{Name: req.Name, Scopes: req.Scopes, RateLimit: req.RateLimit, RateWindow: req.RateWindow}
+	if key.Scopes == nil {
+		key.Scopes = models.StringList{}
+	}
+	secret, err := apikey.Issue(ctx.Request.Context(), key)
+	switch {
+	case errors.Is(err, apikey.ErrInvalidScope):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, apikey.ErrNoSecret):
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "api key signing not configured"})
+		return
+	case err != nil:
+		zap.L().Error("签发API Key失败", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, IssueAPIKeyResponse{Key: key, Secret: secret})
+}
+
+// ListAPIKeys 所有API Key，不包含密钥
+// 请求示例: GET /api/v1/api-keys (X-Admin-Token: xxx)
+func ListAPIKeys(ctx *gin.Context) {
+	keys, err := apikey.List(ctx.Request.Context())
+	if err != nil {
+		zap.L().Error("查询API Key失败", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey 吊销API Key，立即对所有实例生效
+// 请求示例: DELETE /api/v1/api-keys/ak_0123456789abcdef (X-Admin-Token: xxx)
+func RevokeAPIKey(ctx *gin.Context) {
+	err := apikey.Revoke(ctx.Request.Context(), ctx.Param("key_id"))
+	if errors.Is(err, mysql.ErrNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if err != nil {
+		zap.L().Error("吊销API Key失败", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
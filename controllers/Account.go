@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"web_app/auth"
+	"web_app/dao/mysql"
+	"web_app/logic"
+	"web_app/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required" description:"3到32位小写字母、数字或下划线"`
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required" description:"8到72字节"`
+	CaptchaFields
+}
+
+// CaptchaFields 失败次数较多时需要填写的验证码，先调用 POST /api/v1/account/captcha 获取
+type CaptchaFields struct {
+	CaptchaID     string `json:"captcha_id,omitempty"`
+	CaptchaAnswer string `json:"captcha_answer,omitempty"`
+}
+
+// Register 注册账号，验证邮件发送到注册邮箱
+// 请求示例: POST /api/v1/account/register
+// 请求体: {"username": "alice", "email": "alice@example.com", "password": "correct horse"}
+func Register(ctx *gin.Context) {
+	var req RegisterRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := logic.Register(ctx.Request.Context(), logic.RegisterParams{
+		Username: req.Username, Email: req.Email, Password: req.Password,
+		CaptchaID: req.CaptchaID, CaptchaAnswer: req.CaptchaAnswer, IP: ctx.ClientIP(),
+	})
+	if err != nil {
+		accountError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, user)
+}
+
+type LoginRequest struct {
+	Login    string `json:"login" binding:"required" description:"用户名或邮箱"`
+	Password string `json:"password" binding:"required"`
+	OTP      string `json:"otp,omitempty" description:"认证器App的验证码或恢复码，开启两步验证后必填"`
+	CaptchaFields
+}
+
+// params 转换为 logic 层的登录参数
+func (req *LoginRequest) params(ctx *gin.Context) logic.LoginParams {
+	return logic.LoginParams{
+		Login: req.Login, Password: req.Password, OTP: req.OTP,
+		CaptchaID: req.CaptchaID, CaptchaAnswer: req.CaptchaAnswer, IP: ctx.ClientIP(),
+	}
+}
+
+// LoginResponse 登录的用户和签发的令牌
+type LoginResponse struct {
+	User *models.User `json:"user"`
+	*auth.TokenPair
+}
+
+// Login 用用户名或邮箱和密码登录
+// 请求示例: POST /api/v1/account/login
+// 请求体: {"login": "alice", "password": "correct horse"}
+func Login(ctx *gin.Context) {
+	var req LoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, pair, err := logic.Login(ctx.Request.Context(), req.params(ctx))
+	if err != nil {
+		accountError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, LoginResponse{User: user, TokenPair: pair})
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required" description:"验证邮件中的令牌"`
+}
+
+// VerifyEmail 验证邮箱，令牌只能使用一次
+// 请求示例: POST /api/v1/account/verify-email
+// 请求体: {"token": "xxx"}
+func VerifyEmail(ctx *gin.Context) {
+	var req VerifyEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := logic.VerifyEmail(ctx.Request.Context(), req.Token)
+	if err != nil {
+		accountError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
+
+// ResendVerification 重新发送验证邮件
+// 请求示例: POST /api/v1/account/verify-email/resend (Authorization: Bearer xxx)
+func ResendVerification(ctx *gin.Context) {
+	id, ok := currentUserID(ctx)
+	if !ok {
+		return
+	}
+	if err := logic.ResendVerification(ctx.Request.Context(), id); err != nil {
+		accountError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+// Profile 当前登录用户的账号信息
+// 请求示例: GET /api/v1/account/profile (Authorization: Bearer xxx)
+func Profile(ctx *gin.Context) {
+	id, ok := currentUserID(ctx)
+	if !ok {
+		return
+	}
+	user, err := logic.GetUser(ctx.Request.Context(), id)
+	if err != nil {
+		accountError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
+
+// currentUserID 访问令牌中的用户ID，管理接口为调试签发的令牌可能不是注册用户，此时返回404
+func currentUserID(ctx *gin.Context) (int64, bool) {
+	claims := auth.FromContext(ctx.Request.Context())
+	id, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return 0, false
+	}
+	return id, true
+}
+
+// accountError 参数不合法返回400，登录失败返回401，邮箱未验证返回403，账号不存在返回404，
+// 已注册返回409，锁定中返回429。需要验证码或两步验证码时响应中分别带 captcha_required、otp_required
+func accountError(ctx *gin.Context, err error) {
+	var locked *logic.LockoutError
+	switch {
+	case errors.As(err, &locked):
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, logic.ErrCaptchaRequired), errors.Is(err, logic.ErrInvalidCaptcha):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "captcha_required": true})
+	case errors.Is(err, logic.ErrOTPRequired):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "otp_required": true})
+	case errors.Is(err, logic.ErrInvalidUsername), errors.Is(err, logic.ErrInvalidEmail),
+		errors.Is(err, logic.ErrWeakPassword), errors.Is(err, logic.ErrInvalidVerificationToken):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, logic.ErrInvalidCredentials), errors.Is(err, logic.ErrInvalidOTP):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, logic.ErrEmailNotVerified):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, mysql.ErrNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+	case errors.Is(err, logic.ErrUsernameTaken), errors.Is(err, logic.ErrEmailTaken),
+		errors.Is(err, logic.ErrEmailAlreadyVerified), errors.Is(err, logic.ErrTOTPAlreadyEnabled),
+		errors.Is(err, logic.ErrTOTPNotEnabled), errors.Is(err, logic.ErrTOTPNotEnrolled):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, auth.ErrNoSigningKey):
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "token signing not configured"})
+	case errors.Is(err, logic.ErrTOTPNotConfigured):
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		zap.L().Error("账号操作失败", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
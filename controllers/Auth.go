@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+	"web_app/auth"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type IssueTokenRequest struct {
+	Subject string `json:"subject" binding:"required" description:"用户ID"`
+}
+
+// IssueToken 为指定用户签发令牌，供调试和内部服务使用
+// 请求示例: POST /api/v1/auth/token (X-Admin-Token: xxx)
+// 请求体: {"subject": "42"}
+func IssueToken(ctx *gin.Context) {
+	var req IssueTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pair, err := auth.Issue(ctx.Request.Context(), req.Subject)
+	if err != nil {
+		tokenError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, pair)
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshToken 用刷新令牌换取新的令牌对，旧的刷新令牌随即失效
+// 请求示例: POST /api/v1/auth/refresh
+// 请求体: {"refresh_token": "eyJ..."}
+func RefreshToken(ctx *gin.Context) {
+	var req RefreshTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pair, err := auth.Refresh(ctx.Request.Context(), req.RefreshToken)
+	if err != nil {
+		tokenError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, pair)
+}
+
+// Logout 吊销当前访问令牌和同一次登录的刷新令牌
+// 请求示例: POST /api/v1/auth/logout (Authorization: Bearer xxx)
+func Logout(ctx *gin.Context) {
+	claims := auth.FromContext(ctx.Request.Context())
+	if err := auth.Revoke(ctx.Request.Context(), claims); err != nil {
+		zap.L().Error("吊销令牌失败", zap.String("jti", claims.ID), zap.Error(err))
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "token store unavailable"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// MeResponse 当前访问令牌中的声明
+type MeResponse struct {
+	UserID    string    `json:"user_id"`
+	TokenID   string    `json:"token_id"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Me 当前访问令牌中的声明
+// 请求示例: GET /api/v1/auth/me (Authorization: Bearer xxx)
+func Me(ctx *gin.Context) {
+	claims := auth.FromContext(ctx.Request.Context())
+	ctx.JSON(http.StatusOK, MeResponse{
+		UserID:    claims.Subject,
+		TokenID:   claims.ID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+}
+
+// JWKS 签名公钥集合，其他服务据此校验本服务签发的令牌
+// 请求示例: GET /.well-known/jwks.json
+func JWKS(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, auth.JWKS())
+}
+
+// tokenError 令牌无效返回401，密钥未配置或redis不可用返回503
+func tokenError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrTokenRevoked), errors.Is(err, auth.ErrTokenReused):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, auth.ErrNoSigningKey):
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "token signing not configured"})
+	default:
+		zap.L().Error("签发令牌失败", zap.Error(err))
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "token store unavailable"})
+	}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"web_app/dao/mysql"
+	"web_app/dao/redis"
+	"web_app/jobs"
+	"web_app/logic"
+	"web_app/query"
+	"web_app/rates"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// exchangeRateSchema 汇率列表允许查询的字段
+var exchangeRateSchema = &query.Schema{
+	Table: "exchange_rates",
+	Fields: map[string]query.Field{
+		"id":           {Column: "id", Type: query.Int, Filter: true, Sort: true},
+		"base":         {Column: "base", Type: query.String, Filter: true, Sort: true},
+		"quote":        {Column: "quote", Type: query.String, Filter: true, Sort: true},
+		"rate":         {Column: "rate", Type: query.Float, Filter: true, Sort: true},
+		"source":       {Column: "source", Type: query.String, Filter: true},
+		"effective_at": {Column: "effective_at", Type: query.Time, Filter: true, Sort: true},
+		"created_at":   {Column: "created_at", Type: query.Time},
+	},
+	Key:         "id",
+	DefaultSort: []query.Sort{{Field: "effective_at", Desc: true}},
+}
+
+// GetExchangeRates 汇率列表，支持过滤、排序、字段选择和分页
+// 请求示例: GET /api/v2/getExchangeRates?filter=base:eq:USD&sort=-effective_at&fields=base,quote,rate&page=1&size=20
+func GetExchangeRates(ctx *gin.Context) {
+	q, err := exchangeRateSchema.Parse(ctx.Request.URL.Query())
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rows, total, err := mysql.List(ctx.Request.Context(), "exchange_rate", q)
+	if err != nil {
+		zap.L().Error("查询汇率列表失败", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, q.NewPage(rows, total))
+}
+
+type LatestExchangeRateRequest struct {
+	Base  string `form:"base" binding:"required,len=3"`
+	Quote string `form:"quote" binding:"required,len=3"`
+}
+
+// GetLatestExchangeRate 查询货币对的最新汇率
+// 请求示例: GET /api/v2/getLatestExchangeRate?base=USD&quote=CNY
+func GetLatestExchangeRate(ctx *gin.Context) {
+	var q LatestExchangeRateRequest
+	if err := ctx.ShouldBindQuery(&q); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rate, err := logic.GetLatestExchangeRate(ctx.Request.Context(), q.Base, q.Quote)
+	if errors.Is(err, redis.ErrNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "exchange rate not found"})
+		return
+	}
+	if err != nil {
+		zap.L().Error("查询最新汇率失败", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, rate)
+}
+
+// JobResponse 已入队的后台任务
+type JobResponse struct {
+	JobID string `json:"job_id"`
+}
+
+// RefreshExchangeRates 立即拉取汇率，拉取在后台任务中执行，接口只负责入队；redis 不可用时返回503
+// 请求示例: POST /api/v2/refreshExchangeRates (X-Admin-Token: xxx)
+// 请求体: {"provider": "ecb"}，provider 为空时拉取所有数据源
+func RefreshExchangeRates(ctx *gin.Context) {
+	var p rates.IngestPayload
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&p); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	id, err := jobs.Enqueue(ctx.Request.Context(), rates.IngestJobType, p)
+	if err != nil {
+		if !errors.Is(err, jobs.ErrUnavailable) {
+			zap.L().Error("汇率拉取任务入队失败", zap.Error(err))
+		}
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "job queue unavailable"})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, JobResponse{JobID: id})
+}
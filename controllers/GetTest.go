@@ -19,25 +19,35 @@ func TestGetPathParam(ctx *gin.Context) {
 	})
 }
 
+// GetQueryRequest 分页查询参数，未传时使用默认值
+type GetQueryRequest struct {
+	Page string `form:"page,default=1"`
+	Size string `form:"size,default=10"`
+}
+
 // GET + 查询参数  请求示例: GET /api/v1/query?page=1&size=20
 func TestGetQuery(ctx *gin.Context) {
-	page := ctx.DefaultQuery("page", "1")
-	size := ctx.DefaultQuery("size", "10")
+	var q GetQueryRequest
+	if err := ctx.ShouldBindQuery(&q); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	ctx.JSON(http.StatusOK, gin.H{
 		"method": ctx.Request.Method,
 		"url":    ctx.Request.URL,
-		"page":   page,
-		"size":   size,
+		"page":   q.Page,
+		"size":   q.Size,
 	})
 }
 
+type GetQueryStructRequest struct {
+	ID   string `form:"id"`
+	Name string `form:"name"`
+}
+
 // GET + 查询参数绑定到结构体 请求示例: GET /api/v1/query/struct?id=123&name=John
 func TestGetQueryStruct(ctx *gin.Context) {
-	type Query struct {
-		ID   string `form:"id"`
-		Name string `form:"name"`
-	}
-	var query Query
+	var query GetQueryStructRequest
 	if err := ctx.ShouldBindQuery(&query); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -49,14 +59,22 @@ func TestGetQueryStruct(ctx *gin.Context) {
 	})
 }
 
+type HeaderParamsRequest struct {
+	Authorization string `header:"Authorization"`
+	ContentType   string `header:"Content-Type"`
+}
+
 // TestHeaderParams 测试请求头参数
 // 请求示例: GET /api/v1/header
 func TestHeaderParams(ctx *gin.Context) {
-	token := ctx.GetHeader("Authorization")
-	contentType := ctx.GetHeader("Content-Type")
+	var h HeaderParamsRequest
+	if err := ctx.ShouldBindHeader(&h); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	ctx.JSON(http.StatusOK, gin.H{
-		"token":       token,
-		"contentType": contentType,
+		"token":       h.Authorization,
+		"contentType": h.ContentType,
 	})
 }
 
@@ -102,14 +120,15 @@ func TestDownloadFile(ctx *gin.Context) {
 	ctx.FileAttachment("./uploads/"+filename, filename)
 }
 
+type QueryStructBindingRequest struct {
+	Name string `form:"name"`
+	Age  int    `form:"age"`
+}
+
 // TestQueryStructBinding 测试查询参数绑定到结构体
 // 请求示例: GET /api/v1/query-struct?name=John&age=30
 func TestQueryStructBinding(ctx *gin.Context) {
-	type Query struct {
-		Name string `form:"name"`
-		Age  int    `form:"age"`
-	}
-	var query Query
+	var query QueryStructBindingRequest
 	if err := ctx.ShouldBindQuery(&query); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -120,18 +139,18 @@ func TestQueryStructBinding(ctx *gin.Context) {
 	})
 }
 
+type URIStructBindingRequest struct {
+	Name string `uri:"name"`
+	Age  int    `uri:"age"`
+}
+
 // TestURIStructBinding 测试URI参数绑定到结构体
 //
 //	GET /api/v1/uri-struct/:name/:age
 //
 // 请求示例: GET /api/v1/uri-struct/John/30
 func TestURIStructBinding(ctx *gin.Context) {
-	type User struct {
-		Name string `uri:"name"`
-		Age  int    `uri:"age"`
-	}
-
-	var user User
+	var user URIStructBindingRequest
 	if err := ctx.ShouldBindUri(&user); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
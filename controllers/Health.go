@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/dao/redis"
+	"web_app/deps"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const healthPingTimeout = time.Second
+
+var (
+	startedAt    = time.Now()
+	shuttingDown atomic.Bool
+)
+
+// MarkShuttingDown 开始优雅关机时调用，之后 /readyz 返回503，负载均衡不再转发新请求
+func MarkShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// Healthz 存活探针，进程能处理请求即返回200
+// 请求示例: GET /healthz
+func Healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz 就绪探针，关机中或必需依赖不可用时返回503，可选依赖不可用不影响就绪
+// 请求示例: GET /readyz
+func Readyz(ctx *gin.Context) {
+	if shuttingDown.Load() {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+		return
+	}
+	ready := true
+	checks := make(map[string]string)
+	for _, s := range deps.Check(ctx.Request.Context(), healthPingTimeout) {
+		if s.Up {
+			checks[s.Name] = "up"
+			continue
+		}
+		checks[s.Name] = "down"
+		if s.Required {
+			ready = false
+		}
+	}
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, gin.H{"ready": ready, "checks": checks})
+}
+
+// HealthDetails 依赖延迟、连接池统计、版本和运行时长，仅管理员可访问
+// 请求示例: GET /health/details (X-Admin-Token: xxx)
+func HealthDetails(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"name":          settings.Config().Name,
+		"version":       settings.Config().Version,
+		"uptime":        time.Since(startedAt).Round(time.Second).String(),
+		"shutting_down": shuttingDown.Load(),
+		"dependencies":  deps.Check(ctx.Request.Context(), healthPingTimeout),
+		"pools": gin.H{
+			"mysql": mysql.Stats(),
+			"redis": redis.Stats(),
+		},
+	})
+}
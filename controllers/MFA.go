@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"net/http"
+	"web_app/captcha"
+	"web_app/logic"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// NewCaptcha 获取图片验证码，登录或注册返回 captcha_required 时使用
+// 请求示例: POST /api/v1/account/captcha
+func NewCaptcha(ctx *gin.Context) {
+	c, err := captcha.New(ctx.Request.Context())
+	if err != nil {
+		zap.L().Error("生成验证码失败", zap.Error(err))
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "captcha unavailable"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, c)
+}
+
+// TOTPStatus 当前用户两步验证的状态
+// 请求示例: GET /api/v1/account/totp (Authorization: Bearer xxx)
+func TOTPStatus(ctx *gin.Context) {
+	id, ok := currentUserID(ctx)
+	if !ok {
+		return
+	}
+	status, err := logic.GetTOTPStatus(ctx.Request.Context(), id)
+	if err != nil {
+		accountError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, status)
+}
+
+// EnrollTOTPResponse 新生成的密钥，secret 供手动输入，uri 生成二维码供认证器App扫描
+type EnrollTOTPResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// EnrollTOTP 发起两步验证绑定，确认之前不影响登录
+// 请求示例: POST /api/v1/account/totp (Authorization: Bearer xxx)
+func EnrollTOTP(ctx *gin.Context) {
+	id, ok := currentUserID(ctx)
+	if !ok {
+		return
+	}
+	secret, uri, err := logic.EnrollTOTP(ctx.Request.Context(), id)
+	if err != nil {
+		accountError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, EnrollTOTPResponse{Secret: secret, URI: uri})
+}
+
+type ConfirmTOTPRequest struct {
+	Code string `json:"code" binding:"required" description:"认证器App中的6位验证码"`
+}
+
+// RecoveryCodesResponse 恢复码只在开启两步验证或重新生成时返回一次，每个只能使用一次
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ConfirmTOTP 用认证器App的验证码确认绑定，开启两步验证
+// 请求示例: POST /api/v1/account/totp/confirm (Authorization: Bearer xxx)
+// 请求体: {"code": "123456"}
+func ConfirmTOTP(ctx *gin.Context) {
+	id, ok := currentUserID(ctx)
+	if !ok {
+		return
+	}
+	var req ConfirmTOTPRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	codes, err := logic.ConfirmTOTP(ctx.Request.Context(), id, req.Code)
+	if err != nil {
+		accountError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password" binding:"required"`
+	OTP      string `json:"otp" binding:"required" description:"认证器App的验证码或恢复码"`
+}
+
+// DisableTOTP 关闭两步验证，恢复码一并作废
+// 请求示例: DELETE /api/v1/account/totp (Authorization: Bearer xxx)
+// 请求体: {"password": "correct horse", "otp": "123456"}
+func DisableTOTP(ctx *gin.Context) {
+	id, ok := currentUserID(ctx)
+	if !ok {
+		return
+	}
+	var req DisableTOTPRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := logic.DisableTOTP(ctx.Request.Context(), id, req.Password, req.OTP); err != nil {
+		accountError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，之前的恢复码全部失效
+// 请求示例: POST /api/v1/account/recovery-codes (Authorization: Bearer xxx)
+// 请求体: {"code": "123456"}
+func RegenerateRecoveryCodes(ctx *gin.Context) {
+	id, ok := currentUserID(ctx)
+	if !ok {
+		return
+	}
+	var req ConfirmTOTPRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	codes, err := logic.RegenerateRecoveryCodes(ctx.Request.Context(), id, req.Code)
+	if err != nil {
+		accountError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -12,6 +13,12 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// PostFormRequest 表单提交的字段，age 未传时为18
+type PostFormRequest struct {
+	Name string `form:"name"`
+	Age  int    `form:"age,default=18"`
+}
+
 // TestPostForm 测试表单提交
 // 请求示例: POST /api/v1/users (Content-Type: application/x-www-form-urlencoded)
 func TestPostForm(ctx *gin.Context) {
@@ -37,15 +44,16 @@ func TestPostFormMap(ctx *gin.Context) {
 	})
 }
 
+type PostJSONRequest struct {
+	Name string `json:"name" binding:"required"`
+	Age  int    `json:"age" binding:"required,min=1"`
+}
+
 // TestPostJSON 测试JSON数据绑定
 // 请求示例: POST /api/v1/users (Content-Type: application/json)
 // 请求体: {"name": "John", "age": 30}
 func TestPostJSON(ctx *gin.Context) {
-	type User struct {
-		Name string `json:"name" binding:"required"`
-		Age  int    `json:"age" binding:"required,min=1"`
-	}
-	var user User
+	var user PostJSONRequest
 	if err := ctx.ShouldBindJSON(&user); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -57,6 +65,16 @@ func TestPostJSON(ctx *gin.Context) {
 	})
 }
 
+// SingleFileUploadRequest 单文件上传的表单，处理函数直接读取 file 字段，结构体用于描述接口
+type SingleFileUploadRequest struct {
+	File *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+// MultiFileUploadRequest 多文件上传的表单
+type MultiFileUploadRequest struct {
+	Files []*multipart.FileHeader `form:"files" binding:"required"`
+}
+
 // TestSingleFileUpload 测试单文件上传
 // 请求示例: POST /api/v1/upload (Content-Type: multipart/form-data)
 func TestSingleFileUpload(ctx *gin.Context) {
@@ -139,16 +157,16 @@ func TestRawBody(ctx *gin.Context) {
 	})
 }
 
+type XMLBindingRequest struct {
+	Name string `xml:"name"`
+	Age  int    `xml:"age"`
+}
+
 // TestXMLBinding 测试XML数据绑定
 // 请求示例: POST /api/v1/xml (Content-Type: application/xml)
 // 请求体: <user><name>John</name><age>30</age></user>
 func TestXMLBinding(ctx *gin.Context) {
-	type User struct {
-		Name string `xml:"name"`
-		Age  int    `xml:"age"`
-	}
-
-	var user User
+	var user XMLBindingRequest
 	if err := ctx.ShouldBindXML(&user); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -159,16 +177,16 @@ func TestXMLBinding(ctx *gin.Context) {
 	})
 }
 
+type YAMLBindingRequest struct {
+	Name string `yaml:"name"`
+	Age  int    `yaml:"age"`
+}
+
 // TestYAMLBinding 测试YAML数据绑定
 // 请求示例: POST /api/v1/yaml (Content-Type: application/x-yaml)
 // 请求体: name: John\nage: 30
 func TestYAMLBinding(ctx *gin.Context) {
-	type User struct {
-		Name string `yaml:"name"`
-		Age  int    `yaml:"age"`
-	}
-
-	var user User
+	var user YAMLBindingRequest
 	if err := ctx.ShouldBindYAML(&user); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -179,15 +197,16 @@ func TestYAMLBinding(ctx *gin.Context) {
 	})
 }
 
+type FormStructBindingRequest struct {
+	Name string `form:"name"`
+	Age  int    `form:"age"`
+}
+
 // TestFormStructBinding 测试表单数据绑定到结构体
 // 请求示例: POST /api/v1/form-struct (Content-Type: application/x-www-form-urlencoded)
 // 表单数据: name=John&age=30
 func TestFormStructBinding(ctx *gin.Context) {
-	type User struct {
-		Name string `form:"name"`
-		Age  int    `form:"age"`
-	}
-	var user User
+	var user FormStructBindingRequest
 	if err := ctx.ShouldBindWith(&user, binding.Form); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"web_app/dao/mysql"
+	"web_app/models"
+	"web_app/rbac"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ListRoles 所有角色及其权限
+// 请求示例: GET /api/v1/rbac/roles (X-Admin-Token: xxx)
+func ListRoles(ctx *gin.Context) {
+	roles, err := rbac.Roles(ctx.Request.Context())
+	if err != nil {
+		rbacError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, roles)
+}
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=64" description:"小写字母、数字、下划线和连字符"`
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions" description:"权限不存在时自动创建"`
+}
+
+// CreateRole 新增角色
+// 请求示例: POST /api/v1/rbac/roles (X-Admin-Token: xxx)
+// 请求体: {"name": "editor", "permissions": ["articles:*"]}
+func CreateRole(ctx *gin.Context) {
+	var req CreateRoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role := &models.Role{Name: req.Name, Description: req.Description, Permissions: req.Permissions}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	if err := rbac.CreateRole(ctx.Request.Context(), role); err != nil {
+		rbacError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, role)
+}
+
+type RolePermissionsRequest struct {
+	Name        string   `uri:"name" binding:"required"`
+	Permissions []string `json:"permissions"`
+}
+
+// SetRolePermissions 替换角色的全部权限
+// 请求示例: PUT /api/v1/rbac/roles/editor/permissions (X-Admin-Token: xxx)
+// 请求体: {"permissions": ["articles:create", "articles:delete"]}
+func SetRolePermissions(ctx *gin.Context) {
+	var req RolePermissionsRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := rbac.SetRolePermissions(ctx.Request.Context(), req.Name, req.Permissions); err != nil {
+		rbacError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// DeleteRole 删除角色，角色的绑定一并删除
+// 请求示例: DELETE /api/v1/rbac/roles/editor (X-Admin-Token: xxx)
+func DeleteRole(ctx *gin.Context) {
+	if err := rbac.DeleteRole(ctx.Request.Context(), ctx.Param("name")); err != nil {
+		rbacError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListPermissions 所有权限
+// 请求示例: GET /api/v1/rbac/permissions (X-Admin-Token: xxx)
+func ListPermissions(ctx *gin.Context) {
+	perms, err := rbac.Permissions(ctx.Request.Context())
+	if err != nil {
+		rbacError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, perms)
+}
+
+type CreatePermissionRequest struct {
+	Name        string `json:"name" binding:"required,max=128" description:"形如 articles:delete，articles:* 表示该前缀下的所有权限"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+// CreatePermission 新增权限
+// 请求示例: POST /api/v1/rbac/permissions (X-Admin-Token: xxx)
+// 请求体: {"name": "articles:publish", "description": "发布文章"}
+func CreatePermission(ctx *gin.Context) {
+	var req CreatePermissionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p := &models.Permission{Name: req.Name, Description: req.Description}
+	if err := rbac.CreatePermission(ctx.Request.Context(), p); err != nil {
+		rbacError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, p)
+}
+
+// ListSubjectRoles 用户绑定的角色
+// 请求示例: GET /api/v1/rbac/subjects/42/roles (X-Admin-Token: xxx)
+func ListSubjectRoles(ctx *gin.Context) {
+	bindings, err := rbac.SubjectRoles(ctx.Request.Context(), ctx.Param("subject"))
+	if err != nil {
+		rbacError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, bindings)
+}
+
+// BindRole 为用户绑定角色，重复绑定不报错
+// 请求示例: PUT /api/v1/rbac/subjects/42/roles/editor (X-Admin-Token: xxx)
+func BindRole(ctx *gin.Context) {
+	if err := rbac.Bind(ctx.Request.Context(), ctx.Param("subject"), ctx.Param("role")); err != nil {
+		rbacError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// UnbindRole 解除用户与角色的绑定
+// 请求示例: DELETE /api/v1/rbac/subjects/42/roles/editor (X-Admin-Token: xxx)
+func UnbindRole(ctx *gin.Context) {
+	if err := rbac.Unbind(ctx.Request.Context(), ctx.Param("subject"), ctx.Param("role")); err != nil {
+		rbacError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+type ExplainRequest struct {
+	Subject    string `form:"subject" binding:"required" description:"用户ID"`
+	Permission string `form:"permission" binding:"required"`
+}
+
+// ExplainAccess 说明用户是否拥有权限以及原因，结果与 Require 中间件使用同一份内存数据
+// 请求示例: GET /api/v1/rbac/explain?subject=42&permission=articles:delete (X-Admin-Token: xxx)
+func ExplainAccess(ctx *gin.Context) {
+	var req ExplainRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, rbac.Check(req.Subject, req.Permission))
+}
+
+// rbacError 名称不合法返回400，记录不存在返回404，重名返回409
+func rbacError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, rbac.ErrInvalidName):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, mysql.ErrNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	case errors.Is(err, mysql.ErrDuplicate):
+		ctx.JSON(http.StatusConflict, gin.H{"error": "already exists"})
+	default:
+		zap.L().Error("权限数据操作失败", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
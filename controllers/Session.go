@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"web_app/logic"
+	"web_app/models"
+	"web_app/session"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// SessionLoginResponse 登录的用户和新建的会话，会话ID只在 Set-Cookie 中返回
+type SessionLoginResponse struct {
+	User    *models.User    `json:"user"`
+	Session *models.Session `json:"session"`
+}
+
+// SessionLogin 用用户名或邮箱和密码登录，创建会话并写入 HttpOnly cookie
+// 请求示例: POST /api/v1/sessions
+// 请求体: {"login": "alice", "password": "correct horse"}
+func SessionLogin(ctx *gin.Context) {
+	var req LoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, cookie, s, err := logic.StartSession(ctx.Request.Context(), req.params(ctx), ctx.Request.UserAgent())
+	switch {
+	case errors.Is(err, session.ErrNoSecret):
+		sessionError(ctx, err)
+		return
+	case err != nil:
+		accountError(ctx, err)
+		return
+	}
+	http.SetCookie(ctx.Writer, session.Cookie(cookie))
+	ctx.JSON(http.StatusCreated, SessionLoginResponse{User: user, Session: s})
+}
+
+// ListSessions 当前用户的所有会话，current 为 true 的是发起请求的会话
+// 请求示例: GET /api/v1/sessions (Cookie: sid=xxx)
+func ListSessions(ctx *gin.Context) {
+	current := session.FromContext(ctx.Request.Context())
+	sessions, err := session.List(ctx.Request.Context(), current.UserID, current.ID)
+	if err != nil {
+		sessionError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, sessions)
+}
+
+// SessionLogout 退出当前会话并清除cookie
+// 请求示例: DELETE /api/v1/sessions/current (Cookie: sid=xxx)
+func SessionLogout(ctx *gin.Context) {
+	current := session.FromContext(ctx.Request.Context())
+	if err := session.Revoke(ctx.Request.Context(), current.UserID, current.ID); err != nil && !errors.Is(err, session.ErrNotFound) {
+		sessionError(ctx, err)
+		return
+	}
+	http.SetCookie(ctx.Writer, session.Cookie(""))
+	ctx.Status(http.StatusNoContent)
+}
+
+// RevokeSession 吊销当前用户的某个会话，例如在其他设备上退出登录
+// 请求示例: DELETE /api/v1/sessions/3f2a... (Cookie: sid=xxx)
+func RevokeSession(ctx *gin.Context) {
+	current := session.FromContext(ctx.Request.Context())
+	id := ctx.Param("id")
+	if err := session.Revoke(ctx.Request.Context(), current.UserID, id); err != nil {
+		sessionError(ctx, err)
+		return
+	}
+	if id == current.ID {
+		http.SetCookie(ctx.Writer, session.Cookie(""))
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// SignOutEverywhereResponse 吊销的会话数量
+type SignOutEverywhereResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+// SignOutEverywhere 在所有设备上退出登录，包括当前会话和通过令牌登录的客户端
+// 请求示例: DELETE /api/v1/sessions (Cookie: sid=xxx)
+func SignOutEverywhere(ctx *gin.Context) {
+	current := session.FromContext(ctx.Request.Context())
+	n, err := logic.SignOutEverywhere(ctx.Request.Context(), current.UserID)
+	if err != nil {
+		sessionError(ctx, err)
+		return
+	}
+	http.SetCookie(ctx.Writer, session.Cookie(""))
+	ctx.JSON(http.StatusOK, SignOutEverywhereResponse{Revoked: n})
+}
+
+// sessionError 会话不存在返回404，签名密钥未配置或redis不可用返回503
+func sessionError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, session.ErrNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+	case errors.Is(err, session.ErrNoSecret):
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "sessions not configured"})
+	default:
+		zap.L().Error("会话操作失败", zap.Error(err))
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "session store unavailable"})
+	}
+}
@@ -0,0 +1,62 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"web_app/models"
+)
+
+// apiKeyColumns api_keys 表的查询列
+const apiKeyColumns = `id, key_id, name, secret_hash, scopes, rate_limit, rate_window, created_at, revoked_at`
+
+// GetAPIKey 按公开标识查询API Key，包括已吊销的，不存在时返回 nil
+func GetAPIKey(ctx context.Context, keyID string) (*models.APIKey, error) {
+	key := new(models.APIKey)
+	err := Get(ctx, Reader(ctx), "api_key.get", key,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_id = ?`, keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListAPIKeys 所有API Key，按创建时间倒序
+func ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	err := Select(ctx, Reader(ctx), "api_key.list", &keys,
+		`SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id DESC`)
+	return keys, err
+}
+
+// CreateAPIKey 保存新签发的API Key
+func CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	key.CreatedAt = time.Now().UTC()
+	res, err := Exec(ctx, DB(), "api_key.insert",
+		`INSERT INTO api_keys (key_id, name, secret_hash, scopes, rate_limit, rate_window, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		key.KeyID, key.Name, key.SecretHash, key.Scopes, key.RateLimit, key.RateWindow, key.CreatedAt)
+	if err != nil {
+		return duplicate(err)
+	}
+	key.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// RevokeAPIKey 吊销API Key，记录保留用于审计；不存在或已吊销时返回 ErrNotFound
+func RevokeAPIKey(ctx context.Context, keyID string) error {
+	res, err := Exec(ctx, DB(), "api_key.revoke",
+		`UPDATE api_keys SET revoked_at = ? WHERE key_id = ? AND revoked_at IS NULL`, time.Now().UTC(), keyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	afterWrite(ctx, "api_keys", []string{keyID})
+	return nil
+}
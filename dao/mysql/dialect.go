@@ -0,0 +1,110 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"web_app/settings"
+
+	mysqldrv "github.com/go-sql-driver/mysql"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Dialect 屏蔽不同数据库驱动之间的差异，语句优先使用两者都支持的写法，
+// 无法统一的部分通过 Dialect 生成
+type Dialect interface {
+	// Name 方言名称，同时是 migrations 下的目录名
+	Name() string
+	// DriverName 注册到 database/sql 的驱动名
+	DriverName() string
+	// DSN 根据配置生成连接串，host/port 对不需要网络的驱动没有意义
+	DSN(cfg settings.MysqlConfig, host, port string) (string, error)
+	// InsertIgnore 返回忽略唯一键冲突的插入语句前缀
+	InsertIgnore() string
+	// IsRetryable 判断错误是否为重试事务即可解决的锁冲突
+	IsRetryable(err error) bool
+	// IsDuplicateKey 判断错误是否为主键或唯一键冲突
+	IsDuplicateKey(err error) bool
+}
+
+// CurrentDialect 返回当前使用的方言，Init 时根据配置确定，初始化之前为 MySQL
+func CurrentDialect() Dialect {
+	if p := current.Load(); p != nil {
+		return p.dialect
+	}
+	return mysqlDialect{}
+}
+
+func dialectFor(driver string) (Dialect, error) {
+	switch driver {
+	case "", "mysql":
+		return mysqlDialect{}, nil
+	case "sqlite":
+		return sqliteDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// MySQL 错误码: 死锁、锁等待超时，这两类错误重试整个事务通常可以成功
+const (
+	errDeadlock        = 1213
+	errLockWaitTimeout = 1205
+	errDuplicateEntry  = 1062
+)
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string       { return "mysql" }
+func (mysqlDialect) DriverName() string { return "mysql" }
+func (mysqlDialect) DSN(cfg settings.MysqlConfig, host, port string) (string, error) {
+	return buildDSN(cfg, host, port)
+}
+func (mysqlDialect) InsertIgnore() string { return "INSERT IGNORE INTO" }
+func (mysqlDialect) IsRetryable(err error) bool {
+	var me *mysqldrv.MySQLError
+	if errors.As(err, &me) {
+		return me.Number == errDeadlock || me.Number == errLockWaitTimeout
+	}
+	return false
+}
+func (mysqlDialect) IsDuplicateKey(err error) bool {
+	var me *mysqldrv.MySQLError
+	return errors.As(err, &me) && me.Number == errDuplicateEntry
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string       { return "sqlite" }
+func (sqliteDialect) DriverName() string { return "sqlite" }
+
+// DSN 开启外键和WAL，并设置忙等待，时间按 sqlite 自身格式存储便于排序比较
+func (sqliteDialect) DSN(cfg settings.MysqlConfig, _, _ string) (string, error) {
+	path := cfg.Path
+	if path == "" {
+		path = "web_app.db"
+	}
+	q := url.Values{}
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Set("_time_format", "sqlite")
+	return "file:" + path + "?" + q.Encode(), nil
+}
+func (sqliteDialect) InsertIgnore() string { return "INSERT OR IGNORE INTO" }
+func (sqliteDialect) IsRetryable(err error) bool {
+	var se *sqlite.Error
+	if errors.As(err, &se) {
+		code := se.Code() & 0xff // 去掉扩展错误码
+		return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+	}
+	return false
+}
+func (sqliteDialect) IsDuplicateKey(err error) bool {
+	var se *sqlite.Error
+	if errors.As(err, &se) {
+		return se.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || se.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"web_app/models"
+)
+
+// GetLatestExchangeRate 查询货币对最新的一条汇率，不存在时返回 nil
+func GetLatestExchangeRate(ctx context.Context, base, quote string) (*models.ExchangeRate, error) {
+	rate := new(models.ExchangeRate)
+	sqlStr := `SELECT id, base, quote, rate, source, effective_at, created_at
+		FROM exchange_rates WHERE base = ? AND quote = ?
+		ORDER BY effective_at DESC LIMIT 1`
+	if err := Get(ctx, Reader(ctx), "exchange_rate.latest", rate, sqlStr, base, quote); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return rate, nil
+}
+
+// exchangeRatesFence 汇率写入使用的防护令牌名称
+const exchangeRatesFence = "exchange_rates"
+
+// CreateExchangeRates 在一个事务中批量写入汇率，同一来源同一时间点的重复数据会被忽略
+// 返回实际新写入的条数。fence 为调度器当选leader时获得的防护令牌，
+// 小于已写入过的令牌时说明已有新leader，返回 ErrStaleFence 且不写入任何数据；传0不校验
+func CreateExchangeRates(ctx context.Context, rates []*models.ExchangeRate, fence int64) (n int64, err error) {
+	sqlStr := CurrentDialect().InsertIgnore() + ` exchange_rates (base, quote, rate, source, effective_at)
+		VALUES (?, ?, ?, ?, ?)`
+	err = WithTx(ctx, nil, func(tx *Tx) error {
+		// 事务可能因锁冲突重试，每次都从零开始计数
+		n = 0
+		if err := checkFence(ctx, tx, exchangeRatesFence, fence); err != nil {
+			return err
+		}
+		for _, r := range rates {
+			res, err := Exec(ctx, tx, "exchange_rate.insert", sqlStr, r.Base, r.Quote, r.Rate, r.Source, r.EffectiveAt)
+			if err != nil {
+				return err
+			}
+			affected, _ := res.RowsAffected()
+			n += affected
+		}
+		return nil
+	})
+	if err == nil && n > 0 {
+		pairs := make([]string, 0, len(rates))
+		for _, r := range rates {
+			pairs = append(pairs, r.Pair())
+		}
+		afterWrite(ctx, "exchange_rates", pairs)
+	}
+	return n, err
+}
@@ -0,0 +1,31 @@
+package mysql
+
+import (
+	"context"
+	"time"
+)
+
+// checkFence 在事务内校验并推进防护令牌，令牌小于已记录的值时返回 ErrStaleFence，
+// 调用方随之回滚整个事务。fence <= 0 表示未经选举的写入（redis不可用时的本地调度、
+// 手动触发的任务），不做校验也不推进令牌。
+// UPDATE 持有行锁直到事务结束，同一 name 的带令牌写入因此串行执行
+func checkFence(ctx context.Context, tx *Tx, name string, fence int64) error {
+	if fence <= 0 {
+		return nil
+	}
+	if _, err := Exec(ctx, tx, "write_fence.init",
+		CurrentDialect().InsertIgnore()+` write_fences (name, fence, writes, updated_at) VALUES (?, 0, 0, ?)`,
+		name, time.Now().UTC()); err != nil {
+		return err
+	}
+	res, err := Exec(ctx, tx, "write_fence.advance",
+		`UPDATE write_fences SET fence = ?, writes = writes + 1, updated_at = ? WHERE name = ? AND fence <= ?`,
+		fence, time.Now().UTC(), name, fence)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrStaleFence
+	}
+	return nil
+}
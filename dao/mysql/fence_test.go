@@ -0,0 +1,54 @@
+package mysql
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"web_app/models"
+)
+
+func TestCreateExchangeRatesFence(t *testing.T) {
+	ctx := setup(t)
+	at := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	// 按顺序执行，每一步写入一条生效时间不同的汇率
+	steps := []struct {
+		name  string
+		fence int64
+		err   error
+		want  int64 // 执行后记录的令牌
+	}{
+		{"unfenced write", 0, nil, 0},
+		{"first leader", 2, nil, 2},
+		{"same leader again", 2, nil, 2},
+		{"unfenced write does not advance", 0, nil, 2},
+		{"stale leader", 1, ErrStaleFence, 2},
+		{"new leader", 3, nil, 3},
+		{"previous leader after takeover", 2, ErrStaleFence, 3},
+	}
+	var rows int64
+	for i, st := range steps {
+		r := &models.ExchangeRate{Base: "USD", Quote: "CNY", Rate: 7.1, Source: "ecb", EffectiveAt: at.Add(time.Duration(i) * time.Minute)}
+		n, err := CreateExchangeRates(ctx, []*models.ExchangeRate{r}, st.fence)
+		if !errors.Is(err, st.err) {
+			t.Fatalf("%s: got %v, want %v", st.name, err, st.err)
+		}
+		if err == nil {
+			rows += n
+		}
+		var fence int64
+		if err := DB().GetContext(ctx, &fence, `SELECT COALESCE(MAX(fence), 0) FROM write_fences WHERE name = ?`, exchangeRatesFence); err != nil {
+			t.Fatal(err)
+		}
+		if fence != st.want {
+			t.Errorf("%s: fence = %d, want %d", st.name, fence, st.want)
+		}
+	}
+	// 被拒绝的写入整体回滚
+	var count int64
+	if err := DB().GetContext(ctx, &count, `SELECT COUNT(*) FROM exchange_rates`); err != nil {
+		t.Fatal(err)
+	}
+	if count != rows || count != 5 {
+		t.Errorf("rows = %d (inserted %d), want 5", count, rows)
+	}
+}
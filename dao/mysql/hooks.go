@@ -0,0 +1,31 @@
+package mysql
+
+import (
+	"context"
+	"sync"
+)
+
+// WriteHook 写操作提交后执行，keys 为受影响数据的业务标识，例如汇率的货币对
+type WriteHook func(ctx context.Context, keys []string)
+
+var (
+	hooksMu sync.RWMutex
+	hooks   = make(map[string][]WriteHook)
+)
+
+// OnWrite 注册表的写后钩子，通常用于让缓存失效
+func OnWrite(table string, hook WriteHook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks[table] = append(hooks[table], hook)
+}
+
+// afterWrite 在事务提交后调用，不能在事务内调用，否则回滚后缓存已被清除
+func afterWrite(ctx context.Context, table string, keys []string) {
+	hooksMu.RLock()
+	list := hooks[table]
+	hooksMu.RUnlock()
+	for _, h := range list {
+		h(ctx, keys)
+	}
+}
@@ -0,0 +1,77 @@
+package mysql
+
+import (
+	"context"
+	"strconv"
+	"time"
+	"web_app/query"
+)
+
+// List 执行通用列表查询，返回以字段名为key的行；页码分页时同时返回总数
+func List(ctx context.Context, name string, q *query.Query) ([]map[string]interface{}, int64, error) {
+	listSQL, listArgs, countSQL, countArgs := q.ToSQL()
+	db := Reader(ctx)
+	var total int64
+	if countSQL != "" {
+		if err := Get(ctx, db, name+".count", &total, countSQL, countArgs...); err != nil {
+			return nil, 0, err
+		}
+	}
+	start := time.Now()
+	rows, err := db.QueryxContext(ctx, listSQL, listArgs...)
+	if err != nil {
+		observe(ctx, name+".list", listSQL, listArgs, start, 0, err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+	names := q.Names()
+	var list []map[string]interface{}
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return nil, 0, err
+		}
+		row := make(map[string]interface{}, len(names))
+		for i, v := range values {
+			row[names[i]] = normalize(q.Schema.Fields[names[i]].Type, v)
+		}
+		list = append(list, row)
+	}
+	err = rows.Err()
+	observe(ctx, name+".list", listSQL, listArgs, start, int64(len(list)), err)
+	return list, total, err
+}
+
+// normalize 不同驱动扫描到 interface{} 的类型不一致（如 MySQL 的 DECIMAL 为 []byte），
+// 统一转换为字段声明的类型
+func normalize(t query.Type, v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	s, isString := v.(string)
+	switch t {
+	case query.Int:
+		if isString {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return n
+			}
+		}
+	case query.Float:
+		if isString {
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return f
+			}
+		}
+	case query.Bool:
+		// MySQL 的 TINYINT(1) 以 []byte 形式返回 "0" 或 "1"
+		if isString {
+			if b, err := strconv.ParseBool(s); err == nil {
+				return b
+			}
+		}
+		if n, ok := v.(int64); ok {
+			return n != 0
+		}
+	}
+	return v
+}
@@ -0,0 +1,36 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+	"web_app/query"
+)
+
+func TestNormalize(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		typ  query.Type
+		in   interface{}
+		want interface{}
+	}{
+		{"int from bytes", query.Int, []byte("42"), int64(42)},
+		{"int from int64", query.Int, int64(42), int64(42)},
+		{"decimal from bytes", query.Float, []byte("7.125"), 7.125},
+		{"bool from tinyint bytes", query.Bool, []byte("1"), true},
+		{"false from tinyint bytes", query.Bool, []byte("0"), false},
+		{"bool from string", query.Bool, "true", true},
+		{"bool from int64", query.Bool, int64(0), false},
+		{"unparsable bool kept as string", query.Bool, []byte("yes"), "yes"},
+		{"string from bytes", query.String, []byte("USD"), "USD"},
+		{"time unchanged", query.Time, now, now},
+		{"null", query.Int, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalize(tt.typ, tt.in); got != tt.want {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
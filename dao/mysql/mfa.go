@@ -0,0 +1,107 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"web_app/models"
+)
+
+// GetUserTOTP 查询用户的TOTP绑定，包括尚未确认的，不存在时返回 nil
+func GetUserTOTP(ctx context.Context, userID int64) (*models.UserTOTP, error) {
+	t := new(models.UserTOTP)
+	err := Get(ctx, Reader(ctx), "user_totp.get", t,
+		`SELECT user_id, secret, enabled_at, created_at FROM user_totp WHERE user_id = ?`, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// CreatePendingTOTP 保存待确认的TOTP密钥，替换之前未确认的绑定；已开启时返回 ErrDuplicate
+func CreatePendingTOTP(ctx context.Context, userID int64, secret string) error {
+	return WithTx(ctx, nil, func(tx *Tx) error {
+		if _, err := Exec(ctx, tx, "user_totp.delete_pending",
+			`DELETE FROM user_totp WHERE user_id = ? AND enabled_at IS NULL`, userID); err != nil {
+			return err
+		}
+		_, err := Exec(ctx, tx, "user_totp.insert",
+			`INSERT INTO user_totp (user_id, secret, created_at) VALUES (?, ?, ?)`, userID, secret, time.Now().UTC())
+		return duplicate(err)
+	})
+}
+
+// EnableTOTP 确认TOTP绑定并保存恢复码，没有待确认的绑定时返回 ErrNotFound
+func EnableTOTP(ctx context.Context, userID int64, codeHashes []string) error {
+	return WithTx(ctx, nil, func(tx *Tx) error {
+		res, err := Exec(ctx, tx, "user_totp.enable",
+			`UPDATE user_totp SET enabled_at = ? WHERE user_id = ? AND enabled_at IS NULL`, time.Now().UTC(), userID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		return replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+}
+
+// DeleteTOTP 关闭两步验证，恢复码一并删除；未绑定时返回 ErrNotFound
+func DeleteTOTP(ctx context.Context, userID int64) error {
+	return WithTx(ctx, nil, func(tx *Tx) error {
+		res, err := Exec(ctx, tx, "user_totp.delete", `DELETE FROM user_totp WHERE user_id = ?`, userID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		_, err = Exec(ctx, tx, "user_recovery_codes.delete", `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID)
+		return err
+	})
+}
+
+// ReplaceRecoveryCodes 用新的恢复码替换用户的全部恢复码
+func ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	return WithTx(ctx, nil, func(tx *Tx) error {
+		return replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+}
+
+// UseRecoveryCode 使用一个恢复码，恢复码不存在或已使用时返回 false
+func UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	res, err := Exec(ctx, DB(), "user_recovery_codes.use",
+		`UPDATE user_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		time.Now().UTC(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// CountRecoveryCodes 用户剩余可用的恢复码数量
+func CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := Get(ctx, Reader(ctx), "user_recovery_codes.count", &n,
+		`SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID)
+	return n, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *Tx, userID int64, codeHashes []string) error {
+	if _, err := Exec(ctx, tx, "user_recovery_codes.delete",
+		`DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		if _, err := Exec(ctx, tx, "user_recovery_codes.insert",
+			`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package mysql
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// migrations 下按方言分目录存放迁移文件，同一版本在各目录中的文件名必须相同
+//
+//go:embed migrations
+var migrationFS embed.FS
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version VARCHAR(255) NOT NULL PRIMARY KEY,
+	applied_at DATETIME NOT NULL
+)`
+
+// Migrate 按文件名顺序执行当前方言下尚未执行的迁移
+func Migrate(ctx context.Context) error {
+	p := current.Load()
+	if p == nil {
+		return errNotInitialized
+	}
+	return migrate(ctx, p.db, p.dialect)
+}
+
+// migrate 在指定的连接池上执行迁移，Init 在新连接池替换当前连接池之前调用
+func migrate(ctx context.Context, db *sqlx.DB, dialect Dialect) error {
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return err
+	}
+	var applied []string
+	if err := db.SelectContext(ctx, &applied, "SELECT version FROM schema_migrations"); err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(applied))
+	for _, v := range applied {
+		done[v] = true
+	}
+	dir := path.Join("migrations", dialect.Name())
+	entries, err := fs.ReadDir(migrationFS, dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, e := range entries {
+		version := strings.TrimSuffix(e.Name(), ".sql")
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") || done[version] {
+			continue
+		}
+		raw, err := migrationFS.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		// MySQL 的DDL会隐式提交，这里逐条执行，不使用事务
+		for _, stmt := range splitStatements(string(raw)) {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		if _, err := db.ExecContext(ctx, "INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)",
+			version, time.Now().UTC()); err != nil {
+			return err
+		}
+		zap.L().Info("数据库迁移完成", zap.String("dialect", dialect.Name()), zap.String("version", version))
+	}
+	return nil
+}
+
+// splitStatements 按行尾分号拆分语句，迁移文件中不要在字符串里换行写分号
+func splitStatements(s string) []string {
+	var stmts []string
+	for _, part := range strings.Split(s, ";\n") {
+		var lines []string
+		for _, line := range strings.Split(part, "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+				lines = append(lines, line)
+			}
+		}
+		if stmt := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(strings.Join(lines, "\n")), ";")); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id           BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    base         CHAR(3)         NOT NULL,
+    quote        CHAR(3)         NOT NULL,
+    rate         DECIMAL(24, 10) NOT NULL,
+    source       VARCHAR(64)     NOT NULL,
+    effective_at DATETIME(3)     NOT NULL,
+    created_at   DATETIME(3)     NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_pair_source_time (base, quote, source, effective_at),
+    KEY idx_pair_time (base, quote, effective_at)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name        VARCHAR(64)     NOT NULL,
+    description VARCHAR(255)    NOT NULL DEFAULT '',
+    created_at  DATETIME(3)     NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_name (name)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name        VARCHAR(128)    NOT NULL,
+    description VARCHAR(255)    NOT NULL DEFAULT '',
+    created_at  DATETIME(3)     NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_name (name)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id       BIGINT UNSIGNED NOT NULL,
+    permission_id BIGINT UNSIGNED NOT NULL,
+    PRIMARY KEY (role_id, permission_id),
+    KEY idx_permission (permission_id),
+    CONSTRAINT fk_role_permissions_role FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE,
+    CONSTRAINT fk_role_permissions_permission FOREIGN KEY (permission_id) REFERENCES permissions (id) ON DELETE CASCADE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- subject 为令牌中的用户ID
+CREATE TABLE IF NOT EXISTS role_bindings (
+    subject    VARCHAR(128)    NOT NULL,
+    role_id    BIGINT UNSIGNED NOT NULL,
+    created_at DATETIME(3)     NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (subject, role_id),
+    KEY idx_role (role_id),
+    CONSTRAINT fk_role_bindings_role FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+INSERT IGNORE INTO permissions (name, description) VALUES
+    ('*', '所有权限'),
+    ('exchange_rates:create', '创建汇率'),
+    ('articles:create', '创建文章'),
+    ('articles:delete', '删除文章');
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    key_id      VARCHAR(32)     NOT NULL,
+    name        VARCHAR(128)    NOT NULL,
+    secret_hash CHAR(64)        NOT NULL,
+    scopes      VARCHAR(1024)   NOT NULL DEFAULT '',
+    rate_limit  INT             NOT NULL DEFAULT 0,
+    rate_window INT             NOT NULL DEFAULT 0,
+    created_at  DATETIME(3)     NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    revoked_at  DATETIME(3)     NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_key_id (key_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
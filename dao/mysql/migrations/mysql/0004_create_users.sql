@@ -0,0 +1,24 @@
+-- username 和 email 保存为小写，唯一约束不受大小写影响
+CREATE TABLE IF NOT EXISTS users (
+    id                BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    username          VARCHAR(32)     NOT NULL,
+    email             VARCHAR(254)    NOT NULL,
+    password_hash     VARCHAR(255)    NOT NULL,
+    email_verified_at DATETIME(3)     NULL,
+    created_at        DATETIME(3)     NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    updated_at        DATETIME(3)     NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_username (username),
+    UNIQUE KEY uk_email (email)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- 只保存验证令牌的 SHA-256，令牌明文只出现在邮件中
+CREATE TABLE IF NOT EXISTS email_verifications (
+    token_hash CHAR(64)        NOT NULL,
+    user_id    BIGINT UNSIGNED NOT NULL,
+    expires_at DATETIME(3)     NOT NULL,
+    created_at DATETIME(3)     NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (token_hash),
+    KEY idx_user (user_id),
+    CONSTRAINT fk_email_verifications_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,18 @@
+-- secret 为AES-GCM加密后的TOTP密钥，enabled_at 为空表示已发起绑定但尚未确认
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id    BIGINT UNSIGNED NOT NULL,
+    secret     VARCHAR(255)    NOT NULL,
+    enabled_at DATETIME(3)     NULL,
+    created_at DATETIME(3)     NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (user_id),
+    CONSTRAINT fk_user_totp_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- 只保存恢复码的 SHA-256，每个恢复码只能使用一次
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    user_id   BIGINT UNSIGNED NOT NULL,
+    code_hash CHAR(64)        NOT NULL,
+    used_at   DATETIME(3)     NULL,
+    PRIMARY KEY (user_id, code_hash),
+    CONSTRAINT fk_user_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
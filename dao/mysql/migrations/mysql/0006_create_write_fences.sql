@@ -0,0 +1,9 @@
+-- 每类分布式写入已见过的最大防护令牌，旧leader持有的令牌小于它时写入被拒绝；
+-- writes 每次写入都会递增，保证令牌相同时 UPDATE 的影响行数也为1
+CREATE TABLE IF NOT EXISTS write_fences (
+    name       VARCHAR(64)     NOT NULL,
+    fence      BIGINT          NOT NULL DEFAULT 0,
+    writes     BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    updated_at DATETIME(3)     NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (name)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
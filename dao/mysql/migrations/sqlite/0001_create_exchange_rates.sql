@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    base         TEXT     NOT NULL,
+    quote        TEXT     NOT NULL,
+    rate         REAL     NOT NULL,
+    source       TEXT     NOT NULL,
+    effective_at DATETIME NOT NULL,
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (base, quote, source, effective_at)
+);
+CREATE INDEX IF NOT EXISTS idx_exchange_rates_pair_time ON exchange_rates (base, quote, effective_at);
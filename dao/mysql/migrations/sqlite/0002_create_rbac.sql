@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    name        TEXT     NOT NULL UNIQUE,
+    description TEXT     NOT NULL DEFAULT '',
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    name        TEXT     NOT NULL UNIQUE,
+    description TEXT     NOT NULL DEFAULT '',
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id       INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+CREATE INDEX IF NOT EXISTS idx_role_permissions_permission ON role_permissions (permission_id);
+
+-- subject 为令牌中的用户ID
+CREATE TABLE IF NOT EXISTS role_bindings (
+    subject    TEXT     NOT NULL,
+    role_id    INTEGER  NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (subject, role_id)
+);
+CREATE INDEX IF NOT EXISTS idx_role_bindings_role ON role_bindings (role_id);
+
+INSERT OR IGNORE INTO permissions (name, description) VALUES
+    ('*', '所有权限'),
+    ('exchange_rates:create', '创建汇率'),
+    ('articles:create', '创建文章'),
+    ('articles:delete', '删除文章');
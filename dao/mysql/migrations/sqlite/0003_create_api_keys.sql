@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    key_id      TEXT     NOT NULL UNIQUE,
+    name        TEXT     NOT NULL,
+    secret_hash TEXT     NOT NULL,
+    scopes      TEXT     NOT NULL DEFAULT '',
+    rate_limit  INTEGER  NOT NULL DEFAULT 0,
+    rate_window INTEGER  NOT NULL DEFAULT 0,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_at  DATETIME NULL
+);
@@ -0,0 +1,19 @@
+-- username 和 email 保存为小写，唯一约束不受大小写影响
+CREATE TABLE IF NOT EXISTS users (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    username          TEXT     NOT NULL UNIQUE,
+    email             TEXT     NOT NULL UNIQUE,
+    password_hash     TEXT     NOT NULL,
+    email_verified_at DATETIME NULL,
+    created_at        DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at        DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 只保存验证令牌的 SHA-256，令牌明文只出现在邮件中
+CREATE TABLE IF NOT EXISTS email_verifications (
+    token_hash TEXT     NOT NULL PRIMARY KEY,
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_email_verifications_user ON email_verifications (user_id);
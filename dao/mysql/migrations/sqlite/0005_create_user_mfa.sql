@@ -0,0 +1,15 @@
+-- secret 为AES-GCM加密后的TOTP密钥，enabled_at 为空表示已发起绑定但尚未确认
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id    INTEGER  NOT NULL PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret     TEXT     NOT NULL,
+    enabled_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 只保存恢复码的 SHA-256，每个恢复码只能使用一次
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    user_id   INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash TEXT     NOT NULL,
+    used_at   DATETIME NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
@@ -0,0 +1,8 @@
+-- 每类分布式写入已见过的最大防护令牌，旧leader持有的令牌小于它时写入被拒绝；
+-- writes 每次写入都会递增，保证令牌相同时 UPDATE 的影响行数也为1
+CREATE TABLE IF NOT EXISTS write_fences (
+    name       TEXT     NOT NULL PRIMARY KEY,
+    fence      INTEGER  NOT NULL DEFAULT 0,
+    writes     INTEGER  NOT NULL DEFAULT 0,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -1,28 +1,166 @@
 package mysql
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
 	"web_app/settings"
 
-	_ "github.com/go-sql-driver/mysql"
+	mysqldrv "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
-var DB *sqlx.DB
-var driverName string = "mysql"
-
-func Init(cfg settings.MysqlConfig) (err error) {
-	dsn := fmt.Sprintf("%v:%v@tcp(%v:%v)/%v?charset=utf8mb4&parseTime=True",
-		cfg.User,
-		cfg.PassWord,
-		cfg.Host,
-		cfg.Port,
-		cfg.DbName)
-	DB, err = sqlx.Connect(driverName, dsn)
+var errNotInitialized = errors.New("mysql: not initialized")
+
+var (
+	// ErrNotFound 要修改或关联的记录不存在
+	ErrNotFound = errors.New("mysql: record not found")
+	// ErrDuplicate 违反唯一约束
+	ErrDuplicate = errors.New("mysql: duplicate record")
+	// ErrStaleFence 防护令牌小于已经写入过的令牌，持有者已不是当前leader
+	ErrStaleFence = errors.New("mysql: stale fencing token")
+)
+
+// pool 一次 Init 建立的主库、副本连接和后台goroutine（副本健康检查、统计日志）。
+// 重连时先建好新的 pool 再整体替换，已经开始的语句继续使用旧的连接池，关闭旧连接池时会等它们结束
+type pool struct {
+	db       *sqlx.DB
+	dialect  Dialect
+	replicas []*replica
+	stop     context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+var current atomic.Pointer[pool]
+
+// DB 当前的主库连接池，未初始化时返回 nil。重连后会换成新的连接池，不要长期持有返回值
+func DB() *sqlx.DB {
+	if p := current.Load(); p != nil {
+		return p.db
+	}
+	return nil
+}
+
+// Init 连接数据库，成功后替换当前的连接池并关闭旧的；失败时只释放本次建立的连接，
+// 当前的连接池保持不变，可以安全地重复调用
+func Init(cfg settings.MysqlConfig) error {
+	d, err := dialectFor(cfg.Driver)
 	if err != nil {
-		return
+		return err
+	}
+	p, err := open(cfg, d)
+	if err != nil {
+		return err
+	}
+	initTrace(cfg)
+	if old := current.Swap(p); old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// open 建立主库和副本连接，执行迁移并启动后台任务
+func open(cfg settings.MysqlConfig, d Dialect) (p *pool, err error) {
+	dsn, err := d.DSN(cfg, cfg.Host, cfg.Port)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sqlx.Connect(d.DriverName(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	p = &pool{db: db, dialect: d}
+	defer func() {
+		if err != nil {
+			p.close()
+		}
+	}()
+	setPool(db, cfg)
+	var ctx context.Context
+	ctx, p.stop = context.WithCancel(context.Background())
+	if _, ok := d.(sqliteDialect); ok {
+		// sqlite 同一时刻只允许一个写者，单连接可以避免 SQLITE_BUSY；副本对本地文件没有意义
+		db.SetMaxOpenConns(1)
+		cfg.AutoMigrate = true
+	} else if err = p.initReplicas(ctx, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.AutoMigrate {
+		if err = migrate(ctx, db, d); err != nil {
+			return nil, err
+		}
+	}
+	p.startStats(ctx, cfg.StatsInterval)
+	return p, nil
+}
+
+// Close 停止后台任务，关闭主库和所有只读副本。关闭后 DB 仍返回已关闭的连接池，语句返回错误而不是panic
+func Close() error {
+	if p := current.Load(); p != nil {
+		return p.close()
+	}
+	return nil
+}
+
+func (p *pool) close() error {
+	if p.stop != nil {
+		p.stop()
+		p.wg.Wait()
+	}
+	p.closeReplicas()
+	return p.db.Close()
+}
+
+// goBackground 启动一个随 pool 关闭而停止的后台goroutine
+func (p *pool) goBackground(ctx context.Context, fn func(ctx context.Context)) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		fn(ctx)
+	}()
+}
+
+func setPool(db *sqlx.DB, cfg settings.MysqlConfig) {
+	db.SetMaxOpenConns(cfg.MaxOpenConn)
+	db.SetMaxIdleConns(cfg.MaxIdleConn)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+// buildDSN 主库和副本共用账号、库名和连接参数，只有地址不同
+func buildDSN(cfg settings.MysqlConfig, host, port string) (string, error) {
+	c := mysqldrv.NewConfig()
+	c.User = cfg.User
+	c.Passwd = cfg.PassWord
+	c.Net = "tcp"
+	c.Addr = host + ":" + port
+	c.DBName = cfg.DbName
+	c.ParseTime = true
+	c.Collation = "utf8mb4_general_ci"
+	if cfg.Collation != "" {
+		c.Collation = cfg.Collation
+	}
+	if cfg.Loc != "" {
+		loc, err := time.LoadLocation(cfg.Loc)
+		if err != nil {
+			return "", err
+		}
+		c.Loc = loc
+	}
+	c.Timeout = cfg.DialTimeout
+	c.ReadTimeout = cfg.ReadTimeout
+	c.WriteTimeout = cfg.WriteTimeout
+	c.TLSConfig = cfg.TLS
+	return c.FormatDSN(), nil
+}
+
+// Ping 检查主库连接
+func Ping(ctx context.Context) error {
+	db := DB()
+	if db == nil {
+		return errNotInitialized
 	}
-	DB.SetMaxOpenConns(cfg.MaxOpenConn)
-	DB.SetMaxIdleConns(cfg.MaxIdleConn)
-	return
+	return db.PingContext(ctx)
 }
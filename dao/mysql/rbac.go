@@ -0,0 +1,199 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"web_app/models"
+)
+
+// rbacTable 角色、权限和绑定变更后触发的写后钩子名称
+const rbacTable = "rbac"
+
+// ListRoles 所有角色及其权限，按名称排序
+func ListRoles(ctx context.Context) ([]*models.Role, error) {
+	if DB() == nil {
+		return nil, errNotInitialized
+	}
+	db := Reader(ctx)
+	var roles []*models.Role
+	if err := Select(ctx, db, "rbac.roles", &roles,
+		`SELECT id, name, description, created_at FROM roles ORDER BY name`); err != nil {
+		return nil, err
+	}
+	var grants []struct {
+		RoleID     int64  `db:"role_id"`
+		Permission string `db:"permission"`
+	}
+	if err := Select(ctx, db, "rbac.role_permissions", &grants,
+		`SELECT rp.role_id, p.name AS permission FROM role_permissions rp
+		JOIN permissions p ON p.id = rp.permission_id ORDER BY p.name`); err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*models.Role, len(roles))
+	for _, r := range roles {
+		r.Permissions = []string{}
+		byID[r.ID] = r
+	}
+	for _, g := range grants {
+		if r := byID[g.RoleID]; r != nil {
+			r.Permissions = append(r.Permissions, g.Permission)
+		}
+	}
+	return roles, nil
+}
+
+// ListPermissions 所有权限，按名称排序
+func ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	var perms []*models.Permission
+	err := Select(ctx, Reader(ctx), "rbac.permissions", &perms,
+		`SELECT id, name, description, created_at FROM permissions ORDER BY name`)
+	return perms, err
+}
+
+// ListRoleBindings 角色绑定，subject 为空时返回所有主体的绑定
+func ListRoleBindings(ctx context.Context, subject string) ([]*models.RoleBinding, error) {
+	if DB() == nil {
+		return nil, errNotInitialized
+	}
+	sqlStr := `SELECT b.subject, r.name AS role, b.created_at FROM role_bindings b
+		JOIN roles r ON r.id = b.role_id`
+	var args []interface{}
+	if subject != "" {
+		sqlStr += ` WHERE b.subject = ?`
+		args = append(args, subject)
+	}
+	var bindings []*models.RoleBinding
+	err := Select(ctx, Reader(ctx), "rbac.bindings", &bindings, sqlStr+` ORDER BY b.subject, r.name`, args...)
+	return bindings, err
+}
+
+// CreatePermission 新增权限，名称已存在时返回 ErrDuplicate
+func CreatePermission(ctx context.Context, p *models.Permission) error {
+	p.CreatedAt = time.Now().UTC()
+	res, err := Exec(ctx, DB(), "rbac.permission.insert",
+		`INSERT INTO permissions (name, description, created_at) VALUES (?, ?, ?)`, p.Name, p.Description, p.CreatedAt)
+	if err != nil {
+		return duplicate(err)
+	}
+	p.ID, _ = res.LastInsertId()
+	afterWrite(ctx, rbacTable, []string{p.Name})
+	return nil
+}
+
+// CreateRole 新增角色并授予权限，权限不存在时自动创建；角色名已存在时返回 ErrDuplicate
+func CreateRole(ctx context.Context, role *models.Role) error {
+	role.CreatedAt = time.Now().UTC()
+	err := WithTx(ctx, nil, func(tx *Tx) error {
+		res, err := Exec(ctx, tx, "rbac.role.insert",
+			`INSERT INTO roles (name, description, created_at) VALUES (?, ?, ?)`, role.Name, role.Description, role.CreatedAt)
+		if err != nil {
+			return duplicate(err)
+		}
+		if role.ID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		return grantPermissions(ctx, tx, role.ID, role.Permissions)
+	})
+	if err == nil {
+		afterWrite(ctx, rbacTable, []string{role.Name})
+	}
+	return err
+}
+
+// SetRolePermissions 用 perms 替换角色的全部权限，角色不存在时返回 ErrNotFound
+func SetRolePermissions(ctx context.Context, name string, perms []string) error {
+	err := WithTx(ctx, nil, func(tx *Tx) error {
+		id, err := roleID(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		if _, err = Exec(ctx, tx, "rbac.role_permissions.delete",
+			`DELETE FROM role_permissions WHERE role_id = ?`, id); err != nil {
+			return err
+		}
+		return grantPermissions(ctx, tx, id, perms)
+	})
+	if err == nil {
+		afterWrite(ctx, rbacTable, []string{name})
+	}
+	return err
+}
+
+// DeleteRole 删除角色，角色的权限和绑定随之删除；角色不存在时返回 ErrNotFound
+func DeleteRole(ctx context.Context, name string) error {
+	res, err := Exec(ctx, DB(), "rbac.role.delete", `DELETE FROM roles WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	afterWrite(ctx, rbacTable, []string{name})
+	return nil
+}
+
+// BindRole 为主体绑定角色，已绑定时什么都不做；角色不存在时返回 ErrNotFound
+func BindRole(ctx context.Context, subject, role string) error {
+	err := WithTx(ctx, nil, func(tx *Tx) error {
+		id, err := roleID(ctx, tx, role)
+		if err != nil {
+			return err
+		}
+		_, err = Exec(ctx, tx, "rbac.binding.insert",
+			CurrentDialect().InsertIgnore()+` role_bindings (subject, role_id) VALUES (?, ?)`, subject, id)
+		return err
+	})
+	if err == nil {
+		afterWrite(ctx, rbacTable, []string{role})
+	}
+	return err
+}
+
+// UnbindRole 解除主体与角色的绑定，绑定不存在时返回 ErrNotFound
+func UnbindRole(ctx context.Context, subject, role string) error {
+	res, err := Exec(ctx, DB(), "rbac.binding.delete",
+		`DELETE FROM role_bindings WHERE subject = ? AND role_id = (SELECT id FROM roles WHERE name = ?)`, subject, role)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	afterWrite(ctx, rbacTable, []string{role})
+	return nil
+}
+
+func roleID(ctx context.Context, tx *Tx, name string) (int64, error) {
+	var id int64
+	err := Get(ctx, tx, "rbac.role.id", &id, `SELECT id FROM roles WHERE name = ?`, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+// grantPermissions 授予角色权限，权限表中没有的权限先创建
+func grantPermissions(ctx context.Context, tx *Tx, roleID int64, perms []string) error {
+	for _, p := range perms {
+		if _, err := Exec(ctx, tx, "rbac.permission.ensure",
+			CurrentDialect().InsertIgnore()+` permissions (name) VALUES (?)`, p); err != nil {
+			return err
+		}
+		if _, err := Exec(ctx, tx, "rbac.role_permission.insert",
+			CurrentDialect().InsertIgnore()+` role_permissions (role_id, permission_id) SELECT ?, id FROM permissions WHERE name = ?`,
+			roleID, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// duplicate 把唯一键冲突转换为 ErrDuplicate
+func duplicate(err error) error {
+	if CurrentDialect().IsDuplicateKey(err) {
+		return ErrDuplicate
+	}
+	return err
+}
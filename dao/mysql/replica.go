@@ -0,0 +1,144 @@
+package mysql
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+	"web_app/settings"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHealthCheckInterval = 5 * time.Second
+	healthCheckTimeout         = 2 * time.Second
+)
+
+// replica 只读副本
+type replica struct {
+	addr    string
+	db      *sqlx.DB
+	weight  int
+	healthy atomic.Bool
+}
+
+type primaryKey struct{}
+
+// WithPrimary 返回强制读主库的context，用于写后立即读的场景
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// Executor 执行读操作的句柄，*sqlx.DB 和 *Tx 都实现了它
+type Executor interface {
+	Queryer
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+}
+
+// Reader 返回执行读操作的句柄：ctx 处于事务中时返回该事务，读到事务内未提交的写入，
+// 也不会在 sqlite 的单连接上等待事务释放连接而死锁；否则按权重随机选择健康的副本，
+// 没有可用副本或 ctx 要求读主库时返回主库
+func Reader(ctx context.Context) Executor {
+	if tx, ok := ctx.Value(txKey{}).(*Tx); ok {
+		return tx
+	}
+	p := current.Load()
+	if p == nil {
+		return nil
+	}
+	replicas := p.replicas
+	if len(replicas) == 0 || ctx.Value(primaryKey{}) != nil {
+		return p.db
+	}
+	total := 0
+	for _, r := range replicas {
+		if r.healthy.Load() {
+			total += r.weight
+		}
+	}
+	if total == 0 {
+		return p.db
+	}
+	n := rand.Intn(total)
+	for _, r := range replicas {
+		if !r.healthy.Load() {
+			continue
+		}
+		if n < r.weight {
+			return r.db
+		}
+		n -= r.weight
+	}
+	return p.db
+}
+
+// initReplicas 连接所有副本并启动健康检查，副本暂时不可用不会导致初始化失败
+func (p *pool) initReplicas(ctx context.Context, cfg settings.MysqlConfig) error {
+	if len(cfg.Replicas) == 0 {
+		return nil
+	}
+	for _, rc := range cfg.Replicas {
+		dsn, err := buildDSN(cfg, rc.Host, rc.Port)
+		if err != nil {
+			p.closeReplicas()
+			return err
+		}
+		// sqlx.Open 不会建立连接，副本是否可用由健康检查决定
+		db, err := sqlx.Open(p.dialect.DriverName(), dsn)
+		if err != nil {
+			p.closeReplicas()
+			return err
+		}
+		setPool(db, cfg)
+		r := &replica{addr: rc.Host + ":" + rc.Port, db: db, weight: rc.Weight}
+		if r.weight <= 0 {
+			r.weight = 1
+		}
+		p.replicas = append(p.replicas, r)
+	}
+	interval := cfg.HealthCheckInterval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	p.checkReplicas()
+	p.goBackground(ctx, func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.checkReplicas()
+			}
+		}
+	})
+	return nil
+}
+
+// checkReplicas ping所有副本，不健康的移出轮询，恢复后重新加入
+func (p *pool) checkReplicas() {
+	for _, r := range p.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		err := r.db.PingContext(ctx)
+		cancel()
+		healthy := err == nil
+		if r.healthy.Swap(healthy) == healthy {
+			continue
+		}
+		if healthy {
+			zap.L().Info("mysql副本恢复，加入轮询", zap.String("replica", r.addr))
+		} else {
+			zap.L().Warn("mysql副本不可用，移出轮询", zap.String("replica", r.addr), zap.Error(err))
+		}
+	}
+}
+
+func (p *pool) closeReplicas() {
+	for _, r := range p.replicas {
+		r.db.Close()
+	}
+	p.replicas = nil
+}
@@ -0,0 +1,105 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// addReplicas 给当前连接池加上指向独立 sqlite 文件的副本，返回它们的连接
+func addReplicas(t *testing.T, weights ...int) []*sqlx.DB {
+	t.Helper()
+	p := current.Load()
+	var dbs []*sqlx.DB
+	for i, w := range weights {
+		db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), fmt.Sprintf("replica%d.db", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &replica{addr: fmt.Sprintf("replica%d", i), db: db, weight: w}
+		r.healthy.Store(true)
+		p.replicas = append(p.replicas, r)
+		dbs = append(dbs, db)
+	}
+	return dbs
+}
+
+func TestReader(t *testing.T) {
+	ctx := setup(t)
+	primary := DB()
+	if got := Reader(ctx); got != primary {
+		t.Fatal("without replicas: want the primary")
+	}
+	replicas := addReplicas(t, 1)
+	p := current.Load()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		healthy bool
+		want    Executor
+	}{
+		{"healthy replica", ctx, true, replicas[0]},
+		{"WithPrimary", WithPrimary(ctx), true, primary},
+		{"no healthy replica", ctx, false, primary},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.replicas[0].healthy.Store(tt.healthy)
+			if got := Reader(tt.ctx); got != tt.want {
+				t.Errorf("got %p, want %p", got, tt.want)
+			}
+		})
+	}
+	p.replicas[0].healthy.Store(true)
+	err := WithTx(ctx, nil, func(tx *Tx) error {
+		if got := Reader(tx.Context()); got != tx {
+			t.Errorf("inside a transaction: got %p, want the transaction", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReaderWeights(t *testing.T) {
+	ctx := setup(t)
+	replicas := addReplicas(t, 3, 1)
+	counts := make(map[Executor]int)
+	const n = 8000
+	for i := 0; i < n; i++ {
+		counts[Reader(ctx)]++
+	}
+	if counts[DB()] != 0 {
+		t.Errorf("primary chosen %d times with healthy replicas", counts[DB()])
+	}
+	for i, want := range []float64{0.75, 0.25} {
+		got := float64(counts[replicas[i]]) / n
+		if got < want-0.05 || got > want+0.05 {
+			t.Errorf("replica%d chosen %.2f of the time, want about %.2f", i, got, want)
+		}
+	}
+}
+
+func TestCheckReplicas(t *testing.T) {
+	ctx := setup(t)
+	replicas := addReplicas(t, 1, 1)
+	p := current.Load()
+	p.replicas[1].healthy.Store(false)
+	replicas[0].Close()
+	p.checkReplicas()
+	if p.replicas[0].healthy.Load() {
+		t.Error("closed replica still healthy")
+	}
+	if !p.replicas[1].healthy.Load() {
+		t.Error("reachable replica not restored")
+	}
+	for i := 0; i < 100; i++ {
+		if got := Reader(ctx); got != replicas[1] {
+			t.Fatalf("got %p, want the healthy replica", got)
+		}
+	}
+}
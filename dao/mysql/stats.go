@@ -0,0 +1,65 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"web_app/metrics"
+
+	"go.uber.org/zap"
+)
+
+func init() {
+	metrics.Publish("mysql", func() interface{} {
+		return Stats()
+	})
+}
+
+// Stats 返回主库和各副本的连接池统计，key 为 primary 或副本地址
+func Stats() map[string]sql.DBStats {
+	p := current.Load()
+	if p == nil {
+		return map[string]sql.DBStats{}
+	}
+	return p.stats()
+}
+
+func (p *pool) stats() map[string]sql.DBStats {
+	stats := make(map[string]sql.DBStats, len(p.replicas)+1)
+	stats["primary"] = p.db.Stats()
+	for _, r := range p.replicas {
+		stats[r.addr] = r.db.Stats()
+	}
+	return stats
+}
+
+// startStats 按间隔把连接池统计写入日志，interval 为0时不启动
+func (p *pool) startStats(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	p.goBackground(ctx, func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for name, s := range p.stats() {
+					zap.L().Info("mysql连接池统计",
+						zap.String("db", name),
+						zap.Int("open", s.OpenConnections),
+						zap.Int("in_use", s.InUse),
+						zap.Int("idle", s.Idle),
+						zap.Int64("wait_count", s.WaitCount),
+						zap.Duration("wait_duration", s.WaitDuration),
+						zap.Int64("max_idle_closed", s.MaxIdleClosed),
+						zap.Int64("max_idle_time_closed", s.MaxIdleTimeClosed),
+						zap.Int64("max_lifetime_closed", s.MaxLifetimeClosed),
+					)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+	"web_app/logger"
+	"web_app/metrics"
+	"web_app/settings"
+
+	"go.uber.org/zap"
+)
+
+const defaultSlowThreshold = 200 * time.Millisecond
+
+var (
+	// Init 重连时会重新设置，与执行中的语句并发读写
+	slowThreshold atomic.Int64
+	debugQueries  atomic.Bool
+
+	queryLatency = metrics.NewHistogramVec("mysql_query_seconds", metrics.DefaultLatencyBuckets)
+
+	// 语句中直接拼接的字符串和数字字面量，记录日志前替换为 ?
+	literalRe    = regexp.MustCompile(`'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"|\b\d+(?:\.\d+)?\b`)
+	whitespaceRe = regexp.MustCompile(`\s+`)
+)
+
+// Queryer *sqlx.DB、*sqlx.Tx 和 *Tx 都实现了该接口
+type Queryer interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func threshold() time.Duration {
+	if d := time.Duration(slowThreshold.Load()); d > 0 {
+		return d
+	}
+	return defaultSlowThreshold
+}
+
+func initTrace(cfg settings.MysqlConfig) {
+	threshold := cfg.SlowThreshold
+	if threshold <= 0 {
+		threshold = defaultSlowThreshold
+	}
+	slowThreshold.Store(int64(threshold))
+	debugQueries.Store(cfg.Debug)
+}
+
+// Get 执行查询单行的语句并记录耗时，name 用于日志和按查询统计延迟
+func Get(ctx context.Context, q Queryer, name string, dest interface{}, query string, args ...interface{}) error {
+	start := time.Now()
+	err := q.GetContext(ctx, dest, query, args...)
+	var rows int64
+	if err == nil {
+		rows = 1
+	}
+	observe(ctx, name, query, args, start, rows, err)
+	return err
+}
+
+// Select 执行查询多行的语句并记录耗时
+func Select(ctx context.Context, q Queryer, name string, dest interface{}, query string, args ...interface{}) error {
+	start := time.Now()
+	err := q.SelectContext(ctx, dest, query, args...)
+	var rows int64
+	if v := reflect.Indirect(reflect.ValueOf(dest)); err == nil && v.Kind() == reflect.Slice {
+		rows = int64(v.Len())
+	}
+	observe(ctx, name, query, args, start, rows, err)
+	return err
+}
+
+// Exec 执行写语句并记录耗时和影响行数
+func Exec(ctx context.Context, q Queryer, name string, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := q.ExecContext(ctx, query, args...)
+	var rows int64
+	if err == nil {
+		rows, _ = res.RowsAffected()
+	}
+	observe(ctx, name, query, args, start, rows, err)
+	return res, err
+}
+
+func observe(ctx context.Context, name, query string, args []interface{}, start time.Time, rows int64, err error) {
+	cost := time.Since(start)
+	queryLatency.With(name).Observe(cost.Seconds())
+	slow := cost >= threshold()
+	if !slow && !debugQueries.Load() {
+		return
+	}
+	fields := []zap.Field{
+		zap.String("query_name", name),
+		zap.String("request_id", logger.RequestIDFromContext(ctx)),
+		zap.Duration("cost", cost),
+		zap.Int64("rows", rows),
+		zap.String("statement", redact(query)),
+		zap.Strings("args", argTypes(args)),
+	}
+	if err != nil && err != sql.ErrNoRows {
+		fields = append(fields, zap.Error(err))
+	}
+	if slow {
+		zap.L().Warn("mysql慢查询", fields...)
+	} else {
+		zap.L().Debug("mysql查询", fields...)
+	}
+}
+
+// redact 压缩空白并隐藏语句中的字面量，参数值本身不会出现在日志中
+func redact(query string) string {
+	query = whitespaceRe.ReplaceAllString(strings.TrimSpace(query), " ")
+	return literalRe.ReplaceAllString(query, "?")
+}
+
+// argTypes 只记录参数类型，不记录参数值
+func argTypes(args []interface{}) []string {
+	types := make([]string, len(args))
+	for i, a := range args {
+		types[i] = fmt.Sprintf("%T", a)
+	}
+	return types
+}
@@ -0,0 +1,108 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	txMaxAttempts  = 3
+	txRetryBackoff = 50 * time.Millisecond
+)
+
+type txKey struct{}
+
+// Tx 事务句柄，嵌入 *sqlx.Tx 可以直接执行语句
+type Tx struct {
+	*sqlx.Tx
+	ctx   context.Context
+	depth int
+}
+
+// Context 返回绑定了当前事务的context，把它传给 WithTx 会以保存点的方式嵌套执行
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+// WithTx 在事务中执行fn，fn返回错误或panic时回滚，否则提交
+//
+// ctx 中已经存在事务时（即传入的是 Tx.Context()），使用保存点实现嵌套，opts 被忽略；
+// 最外层事务遇到锁冲突（MySQL 死锁、锁等待超时，sqlite 忙）会按退避策略整体重试，因此 fn 必须可以重复执行。
+// 在 gin 的处理函数中应传入 c.Request.Context()，请求被取消时事务不会提交。
+func WithTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	if parent, ok := ctx.Value(txKey{}).(*Tx); ok {
+		return parent.savepoint(fn)
+	}
+	backoff := txRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, opts, fn)
+		if err == nil || !CurrentDialect().IsRetryable(err) || attempt >= txMaxAttempts {
+			return err
+		}
+		zap.L().Warn("事务冲突，准备重试", zap.Int("attempt", attempt), zap.Error(err))
+		// 加入随机抖动，避免冲突的事务再次同时重试
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff)))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+func runTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) (err error) {
+	sqlTx, err := DB().BeginTxx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	tx := &Tx{Tx: sqlTx}
+	tx.ctx = context.WithValue(ctx, txKey{}, tx)
+	defer func() {
+		if p := recover(); p != nil {
+			sqlTx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			sqlTx.Rollback()
+		}
+	}()
+	if err = fn(tx); err != nil {
+		return err
+	}
+	// 请求已经取消时不再提交，BeginTxx 绑定的ctx也会让驱动自动回滚
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+// savepoint 在已有事务中通过保存点执行fn，失败只回滚到保存点
+func (tx *Tx) savepoint(fn func(tx *Tx) error) (err error) {
+	child := &Tx{Tx: tx.Tx, depth: tx.depth + 1}
+	child.ctx = context.WithValue(tx.ctx, txKey{}, child)
+	name := fmt.Sprintf("sp_%d", child.depth)
+	if _, err = tx.ExecContext(tx.ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.ExecContext(tx.ctx, "ROLLBACK TO SAVEPOINT "+name)
+			panic(p)
+		}
+		if err != nil {
+			tx.ExecContext(tx.ctx, "ROLLBACK TO SAVEPOINT "+name)
+		}
+	}()
+	if err = fn(child); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(tx.ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
@@ -0,0 +1,196 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"web_app/settings"
+)
+
+func setup(t *testing.T) context.Context {
+	t.Helper()
+	ctx := context.Background()
+	if err := Init(settings.MysqlConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "test.db")}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Close() })
+	if _, err := DB().ExecContext(ctx, `CREATE TABLE items (v INTEGER NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+func insert(ctx context.Context, tx *Tx, v int) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO items (v) VALUES (?)`, v)
+	return err
+}
+
+// items 通过 Reader 读取，ctx 处于事务中时读到事务内的写入
+func items(t *testing.T, ctx context.Context) []int {
+	t.Helper()
+	var vs []int
+	if err := Select(ctx, Reader(ctx), "items", &vs, `SELECT v FROM items ORDER BY v`); err != nil {
+		t.Fatal(err)
+	}
+	return vs
+}
+
+var errConflict = errors.New("conflict")
+
+// conflictDialect 把 errConflict 当作可重试的锁冲突，模拟 MySQL 死锁
+type conflictDialect struct {
+	sqliteDialect
+}
+
+func (conflictDialect) IsRetryable(err error) bool {
+	return errors.Is(err, errConflict)
+}
+
+func TestWithTxSavepoint(t *testing.T) {
+	errInner := errors.New("inner")
+	tests := []struct {
+		name string
+		fn   func(tx *Tx) error
+		err  error
+		want []int
+	}{
+		{"nested commit", func(tx *Tx) error {
+			if err := insert(tx.Context(), tx, 1); err != nil {
+				return err
+			}
+			return WithTx(tx.Context(), nil, func(inner *Tx) error { return insert(inner.Context(), inner, 2) })
+		}, nil, []int{1, 2}},
+		{"failed savepoint rolls back only its own writes", func(tx *Tx) error {
+			insert(tx.Context(), tx, 1)
+			err := WithTx(tx.Context(), nil, func(inner *Tx) error {
+				insert(inner.Context(), inner, 2)
+				return errInner
+			})
+			if !errors.Is(err, errInner) {
+				return err
+			}
+			return insert(tx.Context(), tx, 3)
+		}, nil, []int{1, 3}},
+		{"panicking savepoint rolls back and propagates", func(tx *Tx) (err error) {
+			insert(tx.Context(), tx, 1)
+			func() {
+				defer func() { recover() }()
+				WithTx(tx.Context(), nil, func(inner *Tx) error {
+					insert(inner.Context(), inner, 2)
+					panic("boom")
+				})
+			}()
+			return nil
+		}, nil, []int{1}},
+		{"two levels of savepoints", func(tx *Tx) error {
+			return WithTx(tx.Context(), nil, func(a *Tx) error {
+				insert(a.Context(), a, 1)
+				WithTx(a.Context(), nil, func(b *Tx) error {
+					insert(b.Context(), b, 2)
+					return errInner
+				})
+				return WithTx(a.Context(), nil, func(b *Tx) error { return insert(b.Context(), b, 3) })
+			})
+		}, nil, []int{1, 3}},
+		{"outer failure discards released savepoints", func(tx *Tx) error {
+			WithTx(tx.Context(), nil, func(inner *Tx) error { return insert(inner.Context(), inner, 2) })
+			return errInner
+		}, errInner, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := setup(t)
+			if err := WithTx(ctx, nil, tt.fn); !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if got := items(t, ctx); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("items = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithTxReadsOwnWrites(t *testing.T) {
+	ctx := setup(t)
+	err := WithTx(ctx, nil, func(tx *Tx) error {
+		insert(tx.Context(), tx, 1)
+		if got := items(t, tx.Context()); !reflect.DeepEqual(got, []int{1}) {
+			t.Errorf("inside tx: items = %v, want [1]", got)
+		}
+		return WithTx(tx.Context(), nil, func(inner *Tx) error {
+			insert(inner.Context(), inner, 2)
+			if got := items(t, inner.Context()); !reflect.DeepEqual(got, []int{1, 2}) {
+				t.Errorf("inside savepoint: items = %v, want [1 2]", got)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithTxRetry(t *testing.T) {
+	errOther := errors.New("other")
+	tests := []struct {
+		name      string
+		failures  int   // 前几次执行返回的错误次数
+		failWith  error // 返回的错误
+		err       error
+		attempts  int
+		committed bool
+	}{
+		{"no conflict", 0, nil, nil, 1, true},
+		{"retried after conflicts", 2, errConflict, nil, 3, true},
+		{"gives up after max attempts", txMaxAttempts, errConflict, errConflict, txMaxAttempts, false},
+		{"other errors are not retried", 1, errOther, errOther, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := setup(t)
+			current.Load().dialect = conflictDialect{}
+			attempts := 0
+			err := WithTx(ctx, nil, func(tx *Tx) error {
+				attempts++
+				// 每次执行都写入，失败的那几次必须被回滚
+				if err := insert(tx.Context(), tx, attempts); err != nil {
+					return err
+				}
+				if attempts <= tt.failures {
+					return tt.failWith
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+			var want []int
+			if tt.committed {
+				want = []int{attempts}
+			}
+			if got := items(t, ctx); !reflect.DeepEqual(got, want) {
+				t.Errorf("items = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithTxRetryCanceled(t *testing.T) {
+	ctx := setup(t)
+	current.Load().dialect = conflictDialect{}
+	ctx, cancel := context.WithCancel(ctx)
+	attempts := 0
+	err := WithTx(ctx, nil, func(tx *Tx) error {
+		attempts++
+		cancel()
+		return errConflict
+	})
+	if !errors.Is(err, context.Canceled) || attempts != 1 {
+		t.Errorf("got %v after %d attempts, want %v after 1", err, attempts, context.Canceled)
+	}
+}
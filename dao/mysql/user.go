@@ -0,0 +1,112 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"web_app/models"
+)
+
+// userColumns users 表的查询列
+const userColumns = `id, username, email, password_hash, email_verified_at, created_at, updated_at`
+
+// CreateUser 新增用户，用户名或邮箱已存在时返回 ErrDuplicate
+func CreateUser(ctx context.Context, u *models.User) error {
+	u.CreatedAt = time.Now().UTC()
+	u.UpdatedAt = u.CreatedAt
+	res, err := Exec(ctx, DB(), "user.insert",
+		`INSERT INTO users (username, email, password_hash, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		u.Username, u.Email, u.PasswordHash, u.CreatedAt, u.UpdatedAt)
+	if err != nil {
+		return duplicate(err)
+	}
+	u.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// GetUserByID 按ID查询用户，不存在时返回 nil
+func GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	return getUser(ctx, "user.get", `id = ?`, id)
+}
+
+// GetUserByLogin 按用户名或邮箱查询用户，login 需为小写，不存在时返回 nil
+func GetUserByLogin(ctx context.Context, login string) (*models.User, error) {
+	return getUser(ctx, "user.get_by_login", `username = ? OR email = ?`, login, login)
+}
+
+// UserExists 用户名和邮箱是否已被注册，查询主库，用于注册冲突时给出具体原因
+func UserExists(ctx context.Context, username, email string) (usernameTaken, emailTaken bool, err error) {
+	var rows []struct {
+		Username string `db:"username"`
+		Email    string `db:"email"`
+	}
+	err = Select(ctx, DB(), "user.exists", &rows,
+		`SELECT username, email FROM users WHERE username = ? OR email = ?`, username, email)
+	for _, r := range rows {
+		usernameTaken = usernameTaken || r.Username == username
+		emailTaken = emailTaken || r.Email == email
+	}
+	return usernameTaken, emailTaken, err
+}
+
+// CreateEmailVerification 保存邮箱验证令牌的哈希，同一用户之前的令牌随之失效
+func CreateEmailVerification(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	return WithTx(ctx, nil, func(tx *Tx) error {
+		if _, err := Exec(ctx, tx, "email_verification.delete",
+			`DELETE FROM email_verifications WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+		_, err := Exec(ctx, tx, "email_verification.insert",
+			`INSERT INTO email_verifications (token_hash, user_id, expires_at, created_at) VALUES (?, ?, ?, ?)`,
+			tokenHash, userID, expiresAt.UTC(), time.Now().UTC())
+		return err
+	})
+}
+
+// ConsumeEmailVerification 使用邮箱验证令牌并标记邮箱已验证，令牌只能使用一次；
+// 令牌不存在或已过期时返回 ErrNotFound
+func ConsumeEmailVerification(ctx context.Context, tokenHash string) (userID int64, err error) {
+	err = WithTx(ctx, nil, func(tx *Tx) error {
+		var v struct {
+			UserID    int64     `db:"user_id"`
+			ExpiresAt time.Time `db:"expires_at"`
+		}
+		err := Get(ctx, tx, "email_verification.get", &v,
+			`SELECT user_id, expires_at FROM email_verifications WHERE token_hash = ?`, tokenHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if time.Now().After(v.ExpiresAt) {
+			return ErrNotFound
+		}
+		if _, err = Exec(ctx, tx, "email_verification.delete",
+			`DELETE FROM email_verifications WHERE user_id = ?`, v.UserID); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if _, err = Exec(ctx, tx, "user.verify_email",
+			`UPDATE users SET email_verified_at = ?, updated_at = ? WHERE id = ? AND email_verified_at IS NULL`,
+			now, now, v.UserID); err != nil {
+			return err
+		}
+		userID = v.UserID
+		return nil
+	})
+	return userID, err
+}
+
+func getUser(ctx context.Context, name, where string, args ...interface{}) (*models.User, error) {
+	u := new(models.User)
+	err := Get(ctx, Reader(ctx), name, u, `SELECT `+userColumns+` FROM users WHERE `+where, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,185 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"time"
+	"web_app/metrics"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrNotFound loader 返回该错误表示数据不存在，结果会按 NegativeTTL 缓存，避免缓存穿透
+var ErrNotFound = errors.New("cache: not found")
+
+const (
+	cacheKeyPrefix     = "cache:"
+	defaultJitter      = 0.1
+	defaultNegativeTTL = 30 * time.Second
+	defaultLoadTimeout = 10 * time.Second
+	// 负缓存的占位值，不是合法的JSON，不会与正常数据混淆
+	notFoundMarker = "!"
+)
+
+// cacheStats 各缓存的命中统计，key 为 <前缀>.<hit|local_hit|miss|negative_hit|error>
+var cacheStats = metrics.NewCounterMap("cache")
+
+// CacheOptions 缓存配置
+type CacheOptions struct {
+	TTL time.Duration
+	// NegativeTTL 数据不存在时的缓存时间，默认30s
+	NegativeTTL time.Duration
+	// Jitter TTL随机浮动比例，避免同时写入的key同时过期，默认0.1
+	Jitter float64
+	// LoadTimeout 单次加载的超时。加载结果由同一key的所有并发调用方共享，
+	// 不随第一个调用方的请求取消而中断，默认10s
+	LoadTimeout time.Duration
+}
+
+// Cache 旁路缓存：先读进程内缓存（开启时），再读redis，未命中时由 loader 从数据库加载并回写。
+// 同一key的并发未命中只会执行一次 loader；redis不可用时直接调用 loader
+type Cache[T any] struct {
+	prefix string
+	opts   CacheOptions
+	group  singleflight.Group
+}
+
+// NewCache 创建缓存，prefix 作为redis key前缀和统计名称
+func NewCache[T any](prefix string, opts CacheOptions) *Cache[T] {
+	if opts.NegativeTTL <= 0 {
+		opts.NegativeTTL = defaultNegativeTTL
+	}
+	if opts.Jitter <= 0 {
+		opts.Jitter = defaultJitter
+	}
+	if opts.LoadTimeout <= 0 {
+		opts.LoadTimeout = defaultLoadTimeout
+	}
+	return &Cache[T]{prefix: prefix, opts: opts}
+}
+
+func (c *Cache[T]) key(k string) string {
+	return cacheKeyPrefix + c.prefix + ":" + k
+}
+
+// GetOrLoad 读取缓存，未命中时调用 load 加载
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	cached, found, err := c.get(ctx, key)
+	if err != nil {
+		return zero, err
+	}
+	if found {
+		return cached, nil
+	}
+	cacheStats.Add(c.prefix+".miss", 1)
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		// 第一个调用方断开时其他等待者仍需要结果，保留 ctx 中的值（事务、主库标记等）但去掉取消
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.opts.LoadTimeout)
+		defer cancel()
+		// 加载期间发生的失效说明加载结果可能已经过期，不写入本地缓存
+		gen := current.Load().generation(c.key(key))
+		v, err := load(ctx)
+		if errors.Is(err, ErrNotFound) {
+			c.set(ctx, key, notFoundMarker, c.opts.NegativeTTL, gen)
+			return zero, ErrNotFound
+		}
+		if err != nil {
+			return zero, err
+		}
+		if raw, err := json.Marshal(v); err == nil {
+			c.set(ctx, key, string(raw), c.opts.TTL, gen)
+		}
+		return v, nil
+	})
+	if err != nil {
+		return zero, err
+	}
+	return v.(T), nil
+}
+
+// get 返回缓存值；命中负缓存时返回 ErrNotFound；redis 出错按未命中处理
+func (c *Cache[T]) get(ctx context.Context, key string) (v T, found bool, err error) {
+	rc := current.Load()
+	if rc == nil {
+		return v, false, nil
+	}
+	full := c.key(key)
+	gen := rc.local.generation(full)
+	raw, ok := "", false
+	if rc.local.use(full) {
+		if raw, ok = rc.local.lru.Get(full); ok {
+			cacheStats.Add(c.prefix+".local_hit", 1)
+		}
+	}
+	if !ok {
+		if raw, err = rc.Get(ctx, full); err != nil {
+			if err != Nil {
+				cacheStats.Add(c.prefix+".error", 1)
+				zap.L().Warn("读取缓存失败", zap.String("key", full), zap.Error(err))
+			}
+			return v, false, nil
+		}
+		if rc.local.use(full) {
+			ttl := c.opts.TTL
+			if raw == notFoundMarker {
+				ttl = c.opts.NegativeTTL
+			}
+			rc.local.store(full, raw, ttl, gen)
+		}
+	}
+	if raw == notFoundMarker {
+		cacheStats.Add(c.prefix+".negative_hit", 1)
+		return v, false, ErrNotFound
+	}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		cacheStats.Add(c.prefix+".error", 1)
+		return v, false, nil
+	}
+	cacheStats.Add(c.prefix+".hit", 1)
+	return v, true, nil
+}
+
+func (c *Cache[T]) set(ctx context.Context, key, value string, ttl time.Duration, gen uint64) {
+	rc := current.Load()
+	if rc == nil {
+		return
+	}
+	full := c.key(key)
+	ttl = c.jitter(ttl)
+	if err := rc.Set(ctx, full, value, ttl); err != nil {
+		cacheStats.Add(c.prefix+".error", 1)
+		zap.L().Warn("写入缓存失败", zap.String("key", full), zap.Error(err))
+		return
+	}
+	if rc.local.use(full) {
+		rc.local.store(full, value, ttl, gen)
+	}
+}
+
+// jitter 在 ttl 上下浮动 Jitter 比例
+func (c *Cache[T]) jitter(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return 0
+	}
+	delta := (rand.Float64()*2 - 1) * c.opts.Jitter * float64(ttl)
+	return ttl + time.Duration(delta)
+}
+
+// Invalidate 删除缓存，写操作提交后调用；开启本地缓存时同时广播给所有实例
+func (c *Cache[T]) Invalidate(ctx context.Context, keys ...string) error {
+	rc := current.Load()
+	if rc == nil || len(keys) == 0 {
+		return nil
+	}
+	full := make([]string, len(keys))
+	for i, k := range keys {
+		full[i] = c.key(k)
+	}
+	_, err := rc.Del(ctx, full...)
+	broadcastInvalidate(ctx, rc, full)
+	return err
+}
@@ -0,0 +1,179 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"web_app/dao/redis"
+	"web_app/dao/redis/redistest"
+	"web_app/settings"
+)
+
+func useLocal(t *testing.T) *redistest.Store {
+	t.Helper()
+	s := redistest.New()
+	restore := redis.UseWithLocal(s, settings.LocalCacheConfig{Enabled: true, TTL: time.Hour})
+	t.Cleanup(func() {
+		restore()
+		s.Close()
+	})
+	return s
+}
+
+func TestLocalNegativeTTL(t *testing.T) {
+	s := useLocal(t)
+	ctx := context.Background()
+	c := redis.NewCache[string]("local_negative", redis.CacheOptions{TTL: time.Hour, NegativeTTL: 20 * time.Millisecond})
+	load := func(context.Context) (string, error) { return "", errors.New("loader must not run") }
+
+	// 其他实例写入的负缓存，经 redis 读到后放入本地
+	if err := s.Set(ctx, "cache:local_negative:k", "!", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetOrLoad(ctx, "k", load); !errors.Is(err, redis.ErrNotFound) {
+		t.Fatalf("got %v, want %v", err, redis.ErrNotFound)
+	}
+	// 数据随后出现，本地的负缓存按 NegativeTTL 而不是 TTL 过期
+	if err := s.Set(ctx, "cache:local_negative:k", `"v"`, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	got, err := c.GetOrLoad(ctx, "k", load)
+	if err != nil || got != "v" {
+		t.Fatalf("got %q, %v; want v", got, err)
+	}
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	s, stop := redistest.Start()
+	defer stop()
+	ctx := context.Background()
+	c := redis.NewCache[int]("singleflight", redis.CacheOptions{TTL: time.Minute})
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 42, nil
+	}
+	const callers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.GetOrLoad(ctx, "k", load); err != nil || v != 42 {
+				errs <- fmt.Errorf("got %d, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loaded %d times, want 1", n)
+	}
+	// 加载结果写回redis，之后直接命中
+	if _, err := c.GetOrLoad(ctx, "k", func(context.Context) (int, error) { return 0, errors.New("loader must not run") }); err != nil {
+		t.Error(err)
+	}
+	if ttl := s.TTL("cache:singleflight:k"); ttl < 54*time.Second || ttl > 66*time.Second {
+		t.Errorf("ttl = %v, want a minute with 10%% jitter", ttl)
+	}
+}
+
+func TestCacheLoadOutlivesFirstCaller(t *testing.T) {
+	_, stop := redistest.Start()
+	defer stop()
+	c := redis.NewCache[string]("detached", redis.CacheOptions{TTL: time.Minute})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	load := func(ctx context.Context) (string, error) {
+		close(started)
+		select {
+		case <-release:
+			return "v", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := c.GetOrLoad(first, "k", load)
+		firstErr <- err
+	}()
+	<-started
+	second := make(chan string, 1)
+	go func() {
+		v, _ := c.GetOrLoad(context.Background(), "k", load)
+		second <- v
+	}()
+	// 第一个调用方取消不影响正在进行的加载
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if v := <-second; v != "v" {
+		t.Errorf("second caller got %q, want v", v)
+	}
+	<-firstErr
+}
+
+func TestCacheNegative(t *testing.T) {
+	s, stop := redistest.Start()
+	defer stop()
+	ctx := context.Background()
+	c := redis.NewCache[string]("negative", redis.CacheOptions{TTL: time.Hour, NegativeTTL: 10 * time.Second})
+	var loads int
+	missing := func(context.Context) (string, error) {
+		loads++
+		return "", redis.ErrNotFound
+	}
+	failing := func(context.Context) (string, error) {
+		loads++
+		return "", errors.New("db down")
+	}
+	tests := []struct {
+		name    string
+		key     string
+		load    func(context.Context) (string, error)
+		advance time.Duration
+		wantErr error
+		loads   int // 累计加载次数
+	}{
+		{"missing is loaded", "a", missing, 0, redis.ErrNotFound, 1},
+		{"missing is cached", "a", missing, 5 * time.Second, redis.ErrNotFound, 1},
+		{"negative entry expires", "a", missing, 10 * time.Second, redis.ErrNotFound, 2},
+		{"loader errors are not cached", "b", failing, 0, nil, 3},
+		{"failed load is retried", "b", failing, 0, nil, 4},
+	}
+	for _, tt := range tests {
+		s.FastForward(tt.advance)
+		_, err := c.GetOrLoad(ctx, tt.key, tt.load)
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) || tt.wantErr == nil && err == nil {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+		if loads != tt.loads {
+			t.Errorf("%s: loads = %d, want %d", tt.name, loads, tt.loads)
+		}
+	}
+	if ttl := s.TTL("cache:negative:a"); ttl <= 0 || ttl > 11*time.Second {
+		t.Errorf("negative ttl = %v, want about NegativeTTL", ttl)
+	}
+	// 失效后重新加载
+	if err := c.Invalidate(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.GetOrLoad(ctx, "a", func(context.Context) (string, error) { return "found", nil }); err != nil || v != "found" {
+		t.Errorf("after invalidate: got %q, %v", v, err)
+	}
+}
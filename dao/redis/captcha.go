@@ -0,0 +1,29 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+const captchaPrefix = "captcha:"
+
+// SaveCaptcha 保存验证码答案，ttl 后过期
+func SaveCaptcha(ctx context.Context, id, answer string, ttl time.Duration) error {
+	if Rdb() == nil {
+		return errNotInitialized
+	}
+	return Rdb().Set(ctx, captchaPrefix+id, answer, ttl)
+}
+
+// ConsumeCaptcha 校验验证码答案，无论是否正确验证码都会删除，同一验证码不能反复尝试
+func ConsumeCaptcha(ctx context.Context, id, answer string) (bool, error) {
+	if Rdb() == nil {
+		return false, errNotInitialized
+	}
+	ok, err := Rdb().CompareAndDelete(ctx, captchaPrefix+id, answer)
+	if err != nil || ok {
+		return ok, err
+	}
+	_, err = Rdb().Del(ctx, captchaPrefix+id)
+	return false, err
+}
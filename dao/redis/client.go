@@ -0,0 +1,348 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// clientStore 基于 go-redis 的 Store 实现，原子操作使用Lua脚本。
+// 单机、哨兵和集群模式共用这一个实现，集群模式下多key命令按key拆开执行
+type clientStore struct {
+	c       redis.UniversalClient
+	cluster bool
+	// with 返回绑定context的客户端，v6 的 UniversalClient 接口不包含 WithContext
+	with func(ctx context.Context) redis.Cmdable
+}
+
+func newClientStore(c redis.UniversalClient) *clientStore {
+	s := &clientStore{c: c}
+	switch c := c.(type) {
+	case *redis.Client:
+		s.with = func(ctx context.Context) redis.Cmdable { return c.WithContext(ctx) }
+	case *redis.ClusterClient:
+		s.cluster = true
+		s.with = func(ctx context.Context) redis.Cmdable { return c.WithContext(ctx) }
+	default:
+		s.with = func(context.Context) redis.Cmdable { return c }
+	}
+	return s
+}
+
+// 只有值一致（锁的持有者、幂等键的占位者）才能删除和续期
+var (
+	compareAndDeleteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	compareAndSwapScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1`)
+	compareAndExpireScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	incrExpireScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if redis.call("PTTL", KEYS[1]) == -1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n`)
+	zpopToStreamScript = redis.NewScript(`
+local due = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, tonumber(ARGV[2]))
+for _, member in ipairs(due) do
+	redis.call("ZREM", KEYS[1], member)
+	redis.call("XADD", KEYS[2], "*", ARGV[3], member)
+end
+return #due`)
+	// 消息可能已被其他消费者认领，只续期仍属于自己的
+	xtouchScript = redis.NewScript(`
+local n = 0
+for i = 3, #ARGV do
+	local p = redis.call("XPENDING", KEYS[1], ARGV[1], ARGV[i], ARGV[i], 1)
+	if p[1] and p[1][2] == ARGV[2] then
+		redis.call("XCLAIM", KEYS[1], ARGV[1], ARGV[2], 0, ARGV[i], "RETRYCOUNT", p[1][4], "JUSTID")
+		n = n + 1
+	end
+end
+return n`)
+)
+
+// 滑动窗口日志：有序集合中保存窗口内每次请求的时间戳
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	redis.call("PEXPIRE", KEYS[1], window)
+	count = count + 1
+	allowed = 1
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+local reset = window
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit - count, reset}`)
+
+// 令牌桶：哈希中保存剩余令牌数和上次更新时间，按时间差补充令牌
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(capacity / rate))
+return {allowed, math.floor(tokens), retry, math.ceil((capacity - tokens) / rate)}`)
+
+func (s *clientStore) Ping(ctx context.Context) error {
+	return s.with(ctx).Ping().Err()
+}
+
+func (s *clientStore) Close() error {
+	return s.c.Close()
+}
+
+// PoolStats 连接池统计，集群模式下为所有节点的合计
+func (s *clientStore) PoolStats() *redis.PoolStats {
+	if c, ok := s.c.(interface{ PoolStats() *redis.PoolStats }); ok {
+		return c.PoolStats()
+	}
+	return nil
+}
+
+func (s *clientStore) Get(ctx context.Context, key string) (string, error) {
+	return s.with(ctx).Get(key).Result()
+}
+
+func (s *clientStore) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return s.with(ctx).Set(key, value, ttl).Err()
+}
+
+func (s *clientStore) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return s.with(ctx).SetNX(key, value, ttl).Result()
+}
+
+func (s *clientStore) Incr(ctx context.Context, key string) (int64, error) {
+	return s.with(ctx).Incr(key).Result()
+}
+
+func (s *clientStore) IncrExpire(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return incrExpireScript.Run(s.with(ctx), []string{key}, ttl.Milliseconds()).Int64()
+}
+
+func (s *clientStore) Del(ctx context.Context, keys ...string) (int64, error) {
+	if !s.cluster || len(keys) <= 1 {
+		return s.with(ctx).Del(keys...).Result()
+	}
+	// 集群模式下不同槽位的key不能在一条命令中删除
+	var total int64
+	for _, k := range keys {
+		n, err := s.with(ctx).Del(k).Result()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (s *clientStore) CompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	n, err := compareAndDeleteScript.Run(s.with(ctx), []string{key}, value).Int64()
+	return n == 1, err
+}
+
+func (s *clientStore) CompareAndSwap(ctx context.Context, key, old, new string, ttl time.Duration) (bool, error) {
+	n, err := compareAndSwapScript.Run(s.with(ctx), []string{key}, old, new, ttl.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+func (s *clientStore) CompareAndExpire(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	n, err := compareAndExpireScript.Run(s.with(ctx), []string{key}, value, ttl.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+func (s *clientStore) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return s.with(ctx).PExpire(key, ttl).Result()
+}
+
+func (s *clientStore) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	return s.with(ctx).ZAdd(key, redis.Z{Score: score, Member: member}).Err()
+}
+
+func (s *clientStore) ZRem(ctx context.Context, key string, members ...string) (int64, error) {
+	args := make([]interface{}, len(members))
+	for i, m := range members {
+		args[i] = m
+	}
+	return s.with(ctx).ZRem(key, args...).Result()
+}
+
+func (s *clientStore) ZRangeByScore(ctx context.Context, key string, min, max float64) ([]string, error) {
+	return s.with(ctx).ZRangeByScore(key, redis.ZRangeBy{Min: scoreBound(min), Max: scoreBound(max)}).Result()
+}
+
+func (s *clientStore) ZPopToStream(ctx context.Context, key string, max float64, count int64, stream, field string) (int64, error) {
+	return zpopToStreamScript.Run(s.with(ctx), []string{key, stream}, max, count, field).Int64()
+}
+
+func (s *clientStore) SlidingWindow(ctx context.Context, key string, limit int, window time.Duration, member string) (*LimitResult, error) {
+	vals, err := int64s(slidingWindowScript.Run(s.with(ctx), []string{key},
+		time.Now().UnixMilli(), window.Milliseconds(), limit, member), 3)
+	if err != nil {
+		return nil, err
+	}
+	res := &LimitResult{
+		Allowed:   vals[0] == 1,
+		Limit:     limit,
+		Remaining: int(vals[1]),
+		Reset:     time.Duration(vals[2]) * time.Millisecond,
+	}
+	if !res.Allowed {
+		res.RetryAfter = res.Reset
+	}
+	return res, nil
+}
+
+func (s *clientStore) TokenBucket(ctx context.Context, key string, capacity int, period time.Duration) (*LimitResult, error) {
+	rate := float64(capacity) / float64(period.Milliseconds()) // 每毫秒补充的令牌数
+	vals, err := int64s(tokenBucketScript.Run(s.with(ctx), []string{key},
+		capacity, rate, time.Now().UnixMilli()), 4)
+	if err != nil {
+		return nil, err
+	}
+	return &LimitResult{
+		Allowed:    vals[0] == 1,
+		Limit:      capacity,
+		Remaining:  int(vals[1]),
+		RetryAfter: time.Duration(vals[2]) * time.Millisecond,
+		Reset:      time.Duration(vals[3]) * time.Millisecond,
+	}, nil
+}
+
+func (s *clientStore) Publish(ctx context.Context, channel, message string) error {
+	return s.with(ctx).Publish(channel, message).Err()
+}
+
+func (s *clientStore) Subscribe(channels ...string) Subscription {
+	return s.c.Subscribe(channels...)
+}
+
+func (s *clientStore) XGroupCreate(ctx context.Context, stream, group string) error {
+	err := s.with(ctx).XGroupCreateMkStream(stream, group, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+func (s *clientStore) XAdd(ctx context.Context, stream string, values map[string]interface{}) (string, error) {
+	return s.with(ctx).XAdd(&redis.XAddArgs{Stream: stream, Values: values}).Result()
+}
+
+func (s *clientStore) XReadGroup(ctx context.Context, group, consumer, stream string, count int64, block time.Duration) ([]XMessage, error) {
+	if block <= 0 {
+		block = -1 // go-redis 中0表示一直阻塞，-1表示不带BLOCK参数
+	}
+	streams, err := s.with(ctx).XReadGroup(&redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil || len(streams) == 0 {
+		return nil, err
+	}
+	return streams[0].Messages, nil
+}
+
+func (s *clientStore) XAck(ctx context.Context, stream, group string, ids ...string) error {
+	return s.with(ctx).XAck(stream, group, ids...).Err()
+}
+
+func (s *clientStore) XPending(ctx context.Context, stream, group string, count int64) ([]XPending, error) {
+	return s.with(ctx).XPendingExt(&redis.XPendingExtArgs{
+		Stream: stream, Group: group, Start: "-", End: "+", Count: count,
+	}).Result()
+}
+
+func (s *clientStore) XClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, ids ...string) ([]XMessage, error) {
+	return s.with(ctx).XClaim(&redis.XClaimArgs{
+		Stream: stream, Group: group, Consumer: consumer, MinIdle: minIdle, Messages: ids,
+	}).Result()
+}
+
+func (s *clientStore) XTouch(ctx context.Context, stream, group, consumer string, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := make([]interface{}, 0, len(ids)+2)
+	args = append(args, group, consumer)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return xtouchScript.Run(s.with(ctx), []string{stream}, args...).Int64()
+}
+
+// int64s 把脚本返回的整数数组转换为 []int64
+func int64s(cmd *redis.Cmd, n int) ([]int64, error) {
+	raw, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+	list, ok := raw.([]interface{})
+	if !ok || len(list) != n {
+		return nil, fmt.Errorf("redis: unexpected script result %v", raw)
+	}
+	out := make([]int64, n)
+	for i, v := range list {
+		if out[i], ok = v.(int64); !ok {
+			return nil, fmt.Errorf("redis: unexpected script result %v", raw)
+		}
+	}
+	return out, nil
+}
+
+// scoreBound 有序集合的分值区间端点，无穷大写作 -inf、+inf
+func scoreBound(f float64) string {
+	switch {
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsInf(f, 1):
+		return "+inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
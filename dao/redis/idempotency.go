@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// IdempotentResponse 幂等键对应的请求指纹和最终响应，Done 为 false 表示请求仍在处理中
+type IdempotentResponse struct {
+	Fingerprint string      `json:"fingerprint"`
+	Done        bool        `json:"done"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	// token 区分同一个键的不同处理者，只有占位者自己能释放占位
+	Token string `json:"token,omitempty"`
+}
+
+// IdempotentBegin 为幂等键占位，占位成功返回 nil；键已存在时返回已保存的记录，
+// 由调用方比较指纹、判断是否仍在处理中。占位在 processingTTL 后过期，防止进程崩溃后键永远不可用
+func IdempotentBegin(ctx context.Context, key, fingerprint string, processingTTL time.Duration) (existing *IdempotentResponse, marker string, err error) {
+	if Rdb() == nil {
+		return nil, "", errNotInitialized
+	}
+	b, err := json.Marshal(&IdempotentResponse{Fingerprint: fingerprint, Token: newToken()})
+	if err != nil {
+		return nil, "", err
+	}
+	marker = string(b)
+	ok, err := Rdb().SetNX(ctx, key, marker, processingTTL)
+	if err != nil {
+		return nil, "", err
+	}
+	if ok {
+		return nil, marker, nil
+	}
+	raw, err := Rdb().Get(ctx, key)
+	if err == Nil {
+		// 占位刚好过期，视为处理中让客户端稍后重试
+		return &IdempotentResponse{Fingerprint: fingerprint}, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	existing = new(IdempotentResponse)
+	if err = json.Unmarshal([]byte(raw), existing); err != nil {
+		return nil, "", err
+	}
+	return existing, "", nil
+}
+
+// IdempotentComplete 用最终响应替换占位，保留 retention 时长
+func IdempotentComplete(ctx context.Context, key string, resp *IdempotentResponse, retention time.Duration) error {
+	if Rdb() == nil {
+		return errNotInitialized
+	}
+	resp.Done = true
+	resp.Token = ""
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return Rdb().Set(ctx, key, b, retention)
+}
+
+// IdempotentRelease 释放占位，使用同一个键的重试可以重新执行；占位已被替换时什么都不做
+func IdempotentRelease(ctx context.Context, key, marker string) error {
+	if Rdb() == nil {
+		return errNotInitialized
+	}
+	_, err := Rdb().CompareAndDelete(ctx, key, marker)
+	return err
+}
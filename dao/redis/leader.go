@@ -0,0 +1,49 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RunAsLeader 在多个实例间竞选 name 的领导权，只有当选的实例会执行 fn。
+// 当选后 fn 的ctx在失去领导权或ctx结束时取消，fn 应随之尽快返回；
+// leader 宕机后锁在 ttl 内过期，其他实例重新当选。该函数阻塞直到ctx结束
+func RunAsLeader(ctx context.Context, name string, ttl time.Duration, fn func(ctx context.Context, fence int64)) {
+	log := zap.L().With(zap.String("election", name))
+	retry := ttl / 3
+	for {
+		lock, err := AcquireLock(ctx, "leader:"+name, ttl)
+		if err == nil {
+			log.Info("当选leader", zap.Int64("fence", lock.Fence()))
+			runLeader(ctx, lock, fn)
+			// 用新的context释放，ctx可能已经结束
+			releaseCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			lock.Release(releaseCtx)
+			cancel()
+			log.Info("卸任leader")
+		} else if !errors.Is(err, ErrLockNotAcquired) {
+			log.Warn("竞选leader失败", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+func runLeader(ctx context.Context, lock *Lock, fn func(ctx context.Context, fence int64)) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-lock.Lost():
+			cancel()
+		case <-leaderCtx.Done():
+		}
+	}()
+	fn(leaderCtx, lock.Fence())
+}
@@ -0,0 +1,135 @@
+package redis
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"web_app/settings"
+
+	"go.uber.org/zap"
+)
+
+// invalidateChannel 广播缓存失效的频道，消息内容为完整的缓存key
+const invalidateChannel = "cache:invalidate"
+
+const (
+	defaultLocalSize = 10000
+	// generationStripes 失效代数的分片数，不同key落在同一分片只会让本地缓存少命中一次
+	generationStripes = 1024
+)
+
+// localCache 进程内缓存层及其失效订阅，未开启时为 nil，方法对 nil 安全
+type localCache struct {
+	lru  *lru
+	skip []string
+	// gens 按key哈希分片的失效代数，每次失效递增。读取redis期间代数变了，
+	// 说明读到的可能是失效之前的旧值，不能写入本地
+	gens       [generationStripes]atomic.Uint64
+	pubsub     Subscription
+	listenerWg sync.WaitGroup
+}
+
+// newLocalCache 开启本地缓存并在 store 上订阅失效广播，本地副本最长存活 TTL，
+// 即使错过广播（如订阅重连期间）也不会长期读到旧数据
+func newLocalCache(cfg settings.LocalCacheConfig, store Store) *localCache {
+	if !cfg.Enabled || cfg.TTL <= 0 {
+		return nil
+	}
+	size := cfg.Size
+	if size <= 0 {
+		size = defaultLocalSize
+	}
+	l := &localCache{lru: newLRU(size, cfg.TTL), skip: cfg.SkipPrefixes}
+	l.pubsub = store.Subscribe(invalidateChannel)
+	ch := l.pubsub.Channel()
+	l.listenerWg.Add(1)
+	go func() {
+		defer l.listenerWg.Done()
+		for msg := range ch {
+			for _, key := range strings.Split(msg.Payload, "\n") {
+				l.invalidate(key)
+			}
+		}
+	}()
+	return l
+}
+
+func (l *localCache) close() {
+	if l == nil {
+		return
+	}
+	l.pubsub.Close()
+	l.listenerWg.Wait()
+	l.lru.Purge()
+}
+
+// use 判断key是否走本地缓存，变化频繁的key可以通过 skip_prefixes 排除，
+// 前缀匹配的是去掉 cache: 之后的部分，例如 exchange_rate:latest:USD/CNY
+func (l *localCache) use(key string) bool {
+	if l == nil {
+		return false
+	}
+	name := strings.TrimPrefix(key, cacheKeyPrefix)
+	for _, p := range l.skip {
+		if strings.HasPrefix(name, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *localCache) stripe(key string) *atomic.Uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &l.gens[h.Sum32()%generationStripes]
+}
+
+// generation 返回key当前的失效代数，读取redis之前获取，写入本地时传给 store
+func (l *localCache) generation(key string) uint64 {
+	if l == nil {
+		return 0
+	}
+	return l.stripe(key).Load()
+}
+
+// generation 未初始化或未开启本地缓存时返回0
+func (c *client) generation(key string) uint64 {
+	if c == nil {
+		return 0
+	}
+	return c.local.generation(key)
+}
+
+// invalidate 先递增代数再删除本地副本
+func (l *localCache) invalidate(key string) {
+	l.stripe(key).Add(1)
+	l.lru.Delete(key)
+}
+
+// store 写入本地副本，gen 之后发生过失效时放弃。写入后再检查一次代数：
+// invalidate 先递增再删除，无论与本次写入如何交错，旧值都不会留在本地
+func (l *localCache) store(key, value string, ttl time.Duration, gen uint64) {
+	if l.generation(key) != gen {
+		return
+	}
+	l.lru.Set(key, value, ttl)
+	if l.generation(key) != gen {
+		l.lru.Delete(key)
+	}
+}
+
+// broadcastInvalidate 通知所有实例（包括自己）删除本地副本
+func broadcastInvalidate(ctx context.Context, c *client, keys []string) {
+	if c.local == nil {
+		return
+	}
+	for _, k := range keys {
+		c.local.invalidate(k)
+	}
+	if err := c.Publish(ctx, invalidateChannel, strings.Join(keys, "\n")); err != nil {
+		zap.L().Warn("广播缓存失效失败", zap.Strings("keys", keys), zap.Error(err))
+	}
+}
@@ -0,0 +1,121 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrLockNotAcquired 锁已被其他持有者占用
+var ErrLockNotAcquired = errors.New("redis: lock not acquired")
+
+// ErrLockNotHeld 锁已过期或被其他持有者获取，释放和续期都会失败
+var ErrLockNotHeld = errors.New("redis: lock not held")
+
+// Lock 基于 SET NX PX 的分布式锁
+type Lock struct {
+	key   string
+	token string
+	ttl   time.Duration
+	fence int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	lost     chan struct{}
+	lostOnce sync.Once
+}
+
+// AcquireLock 尝试获取锁一次，被占用时返回 ErrLockNotAcquired。
+// 获取成功后在后台按 ttl/3 的间隔自动续期，续期失败时 Lost() 会被关闭
+func AcquireLock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	if Rdb() == nil {
+		return nil, errNotInitialized
+	}
+	l := &Lock{
+		key:   "lock:" + name,
+		token: newToken(),
+		ttl:   ttl,
+		stop:  make(chan struct{}),
+		lost:  make(chan struct{}),
+	}
+	ok, err := Rdb().SetNX(ctx, l.key, l.token, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockNotAcquired
+	}
+	// 防护令牌单调递增，下游写入时带上它可以拒绝已失去锁的旧持有者
+	if l.fence, err = Rdb().Incr(ctx, l.key+":fence"); err != nil {
+		l.Release(context.Background())
+		return nil, err
+	}
+	go l.keepAlive()
+	return l, nil
+}
+
+// Fence 返回本次获取锁时分配的防护令牌
+func (l *Lock) Fence() int64 {
+	return l.fence
+}
+
+// Lost 锁丢失（续期失败或已被他人持有）时关闭
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Refresh 手动续期
+func (l *Lock) Refresh(ctx context.Context) error {
+	ok, err := Rdb().CompareAndExpire(ctx, l.key, l.token, l.ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Release 停止续期并释放锁，只会删除自己持有的锁
+func (l *Lock) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	ok, err := Rdb().CompareAndDelete(ctx, l.key, l.token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+func (l *Lock) keepAlive() {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+		err := l.Refresh(ctx)
+		cancel()
+		if err != nil {
+			zap.L().Warn("分布式锁续期失败", zap.String("key", l.key), zap.Error(err))
+			l.lostOnce.Do(func() { close(l.lost) })
+			return
+		}
+	}
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
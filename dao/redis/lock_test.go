@@ -0,0 +1,153 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"web_app/dao/redis"
+	"web_app/dao/redis/redistest"
+)
+
+func TestLock(t *testing.T) {
+	s, stop := redistest.Start()
+	defer stop()
+	ctx := context.Background()
+	const ttl = time.Minute
+
+	first, err := redis.AcquireLock(ctx, "job", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := redis.AcquireLock(ctx, "job", ttl); !errors.Is(err, redis.ErrLockNotAcquired) {
+		t.Fatalf("second acquire: got %v, want %v", err, redis.ErrLockNotAcquired)
+	}
+	if err := first.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	second, err := redis.AcquireLock(ctx, "job", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Fence() <= first.Fence() {
+		t.Errorf("fence %d after %d, want increasing", second.Fence(), first.Fence())
+	}
+	// 锁过期后被他人获取，旧持有者不能释放或续期新持有者的锁
+	s.FastForward(ttl + time.Second)
+	third, err := redis.AcquireLock(ctx, "job", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Release(ctx)
+	if err := second.Release(ctx); !errors.Is(err, redis.ErrLockNotHeld) {
+		t.Errorf("release after expiry: got %v, want %v", err, redis.ErrLockNotHeld)
+	}
+	if err := second.Refresh(ctx); !errors.Is(err, redis.ErrLockNotHeld) {
+		t.Errorf("refresh after expiry: got %v, want %v", err, redis.ErrLockNotHeld)
+	}
+	if third.Fence() <= second.Fence() {
+		t.Errorf("fence %d after %d, want increasing", third.Fence(), second.Fence())
+	}
+	if !s.Exists("lock:job") {
+		t.Error("stale release deleted the current holder's lock")
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	s, stop := redistest.Start()
+	defer stop()
+	ctx := context.Background()
+	const ttl = 60 * time.Millisecond
+	l, err := redis.AcquireLock(ctx, "lost", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release(ctx)
+	// 续期在锁过期前进行，持有期间不会丢失
+	select {
+	case <-l.Lost():
+		t.Fatal("lock lost while renewing")
+	case <-time.After(3 * ttl):
+	}
+	s.FastForward(2 * ttl)
+	other, err := redis.AcquireLock(ctx, "lost", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Release(ctx)
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost not closed after the lock was taken over")
+	}
+}
+
+func TestRunAsLeader(t *testing.T) {
+	s, stop := redistest.Start()
+	defer stop()
+	const ttl = 60 * time.Millisecond
+	var (
+		mu     sync.Mutex
+		active int
+		fences []int64
+	)
+	state := func() (int, []int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		return active, append([]int64(nil), fences...)
+	}
+	waitFor := func(what string, cond func(active int, fences []int64) bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if a, f := state(); cond(a, f) {
+				return
+			}
+			if time.Now().After(deadline) {
+				a, f := state()
+				t.Fatalf("%s: active %d, fences %v", what, a, f)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lead := func(ctx context.Context, fence int64) {
+		mu.Lock()
+		active++
+		fences = append(fences, fence)
+		mu.Unlock()
+		// 锁丢失或 ctx 结束时卸任
+		<-ctx.Done()
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			redis.RunAsLeader(ctx, "test", ttl, lead)
+		}()
+	}
+	waitFor("first term", func(a int, f []int64) bool { return len(f) == 1 })
+	// leader 持续续期期间其他实例不会当选
+	time.Sleep(3 * ttl)
+	if a, f := state(); a != 1 || len(f) != 1 {
+		t.Fatalf("while the leader renews: active %d, fences %v", a, f)
+	}
+	// 锁被删除（如redis故障转移丢失数据）后其他实例当选，旧leader在下一次续期失败时卸任；
+	// 两者短暂重叠，旧leader的写入由更小的防护令牌拒绝
+	s.Del(context.Background(), "lock:leader:test")
+	waitFor("takeover", func(a int, f []int64) bool { return len(f) >= 2 && a == 1 })
+	if _, f := state(); f[1] <= f[0] {
+		t.Errorf("fences = %v, want increasing", f)
+	}
+	cancel()
+	wg.Wait()
+	if a, _ := state(); a != 0 {
+		t.Errorf("active = %d after cancel, want 0", a)
+	}
+}
@@ -0,0 +1,14 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// ClaimNonce 记录一次性随机数，ttl 内同一个 key 第二次出现时返回 false，用于防止请求重放
+func ClaimNonce(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if Rdb() == nil {
+		return false, errNotInitialized
+	}
+	return Rdb().SetNX(ctx, "nonce:"+key, 1, ttl)
+}
@@ -0,0 +1,33 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// LimitResult 一次限流判断的结果
+type LimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter 被拒绝时距离下一次可以通过的时间
+	RetryAfter time.Duration
+	// Reset 配额完全恢复所需的时间
+	Reset time.Duration
+}
+
+// SlidingWindow 滑动窗口限流，window 内最多 limit 次
+func SlidingWindow(ctx context.Context, key string, limit int, window time.Duration) (*LimitResult, error) {
+	if Rdb() == nil {
+		return nil, errNotInitialized
+	}
+	return Rdb().SlidingWindow(ctx, "ratelimit:sw:"+key, limit, window, newToken())
+}
+
+// TokenBucket 令牌桶限流，桶容量为 capacity，每 period 补满 capacity 个令牌
+func TokenBucket(ctx context.Context, key string, capacity int, period time.Duration) (*LimitResult, error) {
+	if Rdb() == nil {
+		return nil, errNotInitialized
+	}
+	return Rdb().TokenBucket(ctx, "ratelimit:tb:"+key, capacity, period)
+}
@@ -1,24 +1,140 @@
 package redis
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync/atomic"
 	"web_app/settings"
 
 	"github.com/go-redis/redis"
-	_ "github.com/go-redis/redis"
 )
 
-var Rdb *redis.Client
+var errNotInitialized = errors.New("redis: not initialized")
 
+// client 一次 Init 建立的存储和本地缓存层，重连时整体替换
+type client struct {
+	Store
+	local *localCache
+}
+
+var current atomic.Pointer[client]
+
+// Rdb 当前的redis存储，Init 后为 go-redis 实现，测试中可以通过 Use 换成 redistest.Store，
+// 未初始化时返回 nil。重连后会换成新的客户端，不要长期持有返回值
+func Rdb() Store {
+	if c := current.Load(); c != nil {
+		return c.Store
+	}
+	return nil
+}
+
+// Init 按部署模式连接redis，成功后替换当前客户端并关闭旧的；ping失败时只关闭新建的客户端，
+// 当前客户端保持不变，可以安全地重复调用
 func Init(cfg settings.RedisConfig) (err error) {
-	Rdb = redis.NewClient(&redis.Options{
-		Addr:     cfg.Host + ":" + cfg.Port,
-		Password: cfg.PassWord,
-		DB:       cfg.DB,
-		PoolSize: cfg.PoolSize,
-	})
-	err = Rdb.Ping().Err()
+	rc, err := newClient(cfg)
 	if err != nil {
+		return err
+	}
+	if err = rc.Ping().Err(); err != nil {
+		rc.Close()
 		return
 	}
+	store := newClientStore(rc)
+	c := &client{Store: store, local: newLocalCache(cfg.LocalCache, store)}
+	if old := current.Swap(c); old != nil {
+		old.close()
+	}
+	return nil
+}
+
+func (c *client) close() error {
+	c.local.close()
+	return c.Store.Close()
+}
+
+// newClient 根据 Mode 创建单机、哨兵或集群客户端，三者对外都是 UniversalClient
+func newClient(cfg settings.RedisConfig) (redis.UniversalClient, error) {
+	var tlsConfig *tls.Config
+	if cfg.TLS {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: cfg.TLSSkipVerify}
+	}
+	switch cfg.Mode {
+	case "", "standalone":
+		return redis.NewClient(&redis.Options{
+			Addr:            cfg.Host + ":" + cfg.Port,
+			Password:        cfg.PassWord,
+			DB:              cfg.DB,
+			PoolSize:        cfg.PoolSize,
+			DialTimeout:     cfg.DialTimeout,
+			ReadTimeout:     cfg.ReadTimeout,
+			WriteTimeout:    cfg.WriteTimeout,
+			MaxRetries:      cfg.MaxRetries,
+			MinRetryBackoff: cfg.MinRetryBackoff,
+			MaxRetryBackoff: cfg.MaxRetryBackoff,
+			TLSConfig:       tlsConfig,
+		}), nil
+	case "sentinel":
+		if cfg.MasterName == "" || len(cfg.Addrs) == 0 {
+			return nil, errors.New("redis: sentinel mode requires master_name and addrs")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:      cfg.MasterName,
+			SentinelAddrs:   cfg.Addrs,
+			Password:        cfg.PassWord,
+			DB:              cfg.DB,
+			PoolSize:        cfg.PoolSize,
+			DialTimeout:     cfg.DialTimeout,
+			ReadTimeout:     cfg.ReadTimeout,
+			WriteTimeout:    cfg.WriteTimeout,
+			MaxRetries:      cfg.MaxRetries,
+			MinRetryBackoff: cfg.MinRetryBackoff,
+			MaxRetryBackoff: cfg.MaxRetryBackoff,
+			TLSConfig:       tlsConfig,
+		}), nil
+	case "cluster":
+		if len(cfg.Addrs) == 0 {
+			return nil, errors.New("redis: cluster mode requires addrs")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:           cfg.Addrs,
+			Password:        cfg.PassWord,
+			PoolSize:        cfg.PoolSize,
+			DialTimeout:     cfg.DialTimeout,
+			ReadTimeout:     cfg.ReadTimeout,
+			WriteTimeout:    cfg.WriteTimeout,
+			MaxRetries:      cfg.MaxRetries,
+			MinRetryBackoff: cfg.MinRetryBackoff,
+			MaxRetryBackoff: cfg.MaxRetryBackoff,
+			TLSConfig:       tlsConfig,
+		}), nil
+	default:
+		return nil, fmt.Errorf("redis: unknown mode %q", cfg.Mode)
+	}
+}
+
+// Ping 检查redis连接
+func Ping(ctx context.Context) error {
+	rdb := Rdb()
+	if rdb == nil {
+		return errNotInitialized
+	}
+	return rdb.Ping(ctx)
+}
+
+// Close 关闭当前客户端，未初始化时什么都不做
+func Close() error {
+	if c := current.Load(); c != nil {
+		return c.close()
+	}
+	return nil
+}
+
+// Stats 返回连接池统计，未初始化或不是真实客户端时返回 nil
+func Stats() *redis.PoolStats {
+	if s, ok := Rdb().(interface{ PoolStats() *redis.PoolStats }); ok {
+		return s.PoolStats()
+	}
 	return nil
 }
@@ -0,0 +1,71 @@
+package redistest
+
+import (
+	"context"
+	"web_app/dao/redis"
+)
+
+// subscriptionBuffer 每个订阅的缓冲区大小，消费太慢时多出的消息被丢弃，与redis断开慢订阅者的效果类似
+const subscriptionBuffer = 100
+
+type subscription struct {
+	store    *Store
+	channels []string
+	ch       chan *redis.Message
+	closed   bool
+}
+
+func (s *Store) Publish(_ context.Context, channel, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.subs[channel] {
+		select {
+		case sub.ch <- &redis.Message{Channel: channel, Payload: message}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *Store) Subscribe(channels ...string) redis.Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub := &subscription{store: s, channels: channels, ch: make(chan *redis.Message, subscriptionBuffer)}
+	if s.closed {
+		sub.closeLocked()
+		return sub
+	}
+	for _, c := range channels {
+		s.subs[c] = append(s.subs[c], sub)
+	}
+	return sub
+}
+
+func (sub *subscription) Channel() <-chan *redis.Message {
+	return sub.ch
+}
+
+func (sub *subscription) Close() error {
+	s := sub.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range sub.channels {
+		subs := s.subs[c]
+		for i, other := range subs {
+			if other == sub {
+				s.subs[c] = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+	}
+	sub.closeLocked()
+	return nil
+}
+
+// closeLocked 关闭消息通道，调用方持有 Store 的锁，保证不会向已关闭的通道发送
+func (sub *subscription) closeLocked() {
+	if !sub.closed {
+		sub.closed = true
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,501 @@
+// Package redistest 提供进程内的 redis.Store 实现，用于单元测试，不需要启动redis服务。
+// 支持应用用到的字符串、哈希、有序集合、过期时间、pub/sub 和 stream 命令，
+// 所有操作在一把锁内完成，天然满足原子性要求
+package redistest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"web_app/dao/redis"
+)
+
+var (
+	errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInt    = errors.New("ERR value is not an integer or out of range")
+	errClosed    = errors.New("redis: client is closed")
+)
+
+var _ redis.Store = (*Store)(nil)
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindHash
+	kindZSet
+	kindStream
+)
+
+type entry struct {
+	kind     kind
+	str      string
+	hash     map[string]string
+	zset     map[string]float64
+	stream   *stream
+	expireAt time.Time // 零值表示不过期
+}
+
+// Store 进程内的redis实现，零值不可用，使用 New 创建
+type Store struct {
+	mu     sync.Mutex
+	data   map[string]*entry
+	subs   map[string][]*subscription
+	offset time.Duration
+	closed bool
+	// notify 在有新的stream消息时关闭并替换，唤醒阻塞中的 XReadGroup
+	notify chan struct{}
+}
+
+// New 创建空的 Store
+func New() *Store {
+	return &Store{
+		data:   make(map[string]*entry),
+		subs:   make(map[string][]*subscription),
+		notify: make(chan struct{}),
+	}
+}
+
+// Start 创建 Store 并替换 redis.Rdb()，返回的函数关闭 Store 并恢复原来的存储
+//
+//	s, stop := redistest.Start()
+//	defer stop()
+func Start() (*Store, func()) {
+	s := New()
+	restore := redis.Use(s)
+	return s, func() {
+		s.Close()
+		restore()
+	}
+}
+
+// FastForward 让内部时钟前进 d，用于测试过期时间，限流和stream的空闲时间同样受影响
+func (s *Store) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+}
+
+// TTL 返回key的剩余存活时间，不存在时返回 -2，没有过期时间时返回 -1，与 PTTL 一致
+func (s *Store) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key)
+	if e == nil {
+		return -2
+	}
+	if e.expireAt.IsZero() {
+		return -1
+	}
+	return e.expireAt.Sub(s.now())
+}
+
+// Exists 判断key是否存在（未过期）
+func (s *Store) Exists(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookup(key) != nil
+}
+
+// FlushAll 清空所有数据，订阅不受影响
+func (s *Store) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = make(map[string]*entry)
+}
+
+func (s *Store) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+// lookup 返回未过期的key，已过期的顺便删除
+func (s *Store) lookup(key string) *entry {
+	e, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !s.now().Before(e.expireAt) {
+		delete(s.data, key)
+		return nil
+	}
+	return e
+}
+
+// lookupKind 返回指定类型的key，类型不符时返回 WRONGTYPE
+func (s *Store) lookupKind(key string, k kind) (*entry, error) {
+	e := s.lookup(key)
+	if e != nil && e.kind != k {
+		return nil, errWrongType
+	}
+	return e, nil
+}
+
+func (s *Store) expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return s.now().Add(ttl)
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errClosed
+	}
+	return ctx.Err()
+}
+
+// Close 关闭所有订阅，之后的 Ping 返回错误
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	for _, subs := range s.subs {
+		for _, sub := range subs {
+			sub.closeLocked()
+		}
+	}
+	s.subs = make(map[string][]*subscription)
+	close(s.notify)
+	return nil
+}
+
+func (s *Store) Get(_ context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.lookupKind(key, kindString)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", redis.Nil
+	}
+	return e.str, nil
+}
+
+func (s *Store) Set(_ context.Context, key string, value interface{}, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = &entry{kind: kindString, str: toString(value), expireAt: s.expireAt(ttl)}
+	return nil
+}
+
+func (s *Store) SetNX(_ context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lookup(key) != nil {
+		return false, nil
+	}
+	s.data[key] = &entry{kind: kindString, str: toString(value), expireAt: s.expireAt(ttl)}
+	return true, nil
+}
+
+func (s *Store) Incr(_ context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, _, err := s.incr(key)
+	return n, err
+}
+
+func (s *Store) IncrExpire(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, e, err := s.incr(key)
+	if err == nil && e.expireAt.IsZero() {
+		e.expireAt = s.expireAt(ttl)
+	}
+	return n, err
+}
+
+// incr 调用方持有锁
+func (s *Store) incr(key string) (int64, *entry, error) {
+	e, err := s.lookupKind(key, kindString)
+	if err != nil {
+		return 0, nil, err
+	}
+	if e == nil {
+		e = &entry{kind: kindString, str: "0"}
+		s.data[key] = e
+	}
+	n, err := strconv.ParseInt(e.str, 10, 64)
+	if err != nil {
+		return 0, nil, errNotInt
+	}
+	n++
+	e.str = strconv.FormatInt(n, 10)
+	return n, e, nil
+}
+
+func (s *Store) Del(_ context.Context, keys ...string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, k := range keys {
+		if s.lookup(k) != nil {
+			delete(s.data, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) CompareAndDelete(_ context.Context, key, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key)
+	if e == nil || e.kind != kindString || e.str != value {
+		return false, nil
+	}
+	delete(s.data, key)
+	return true, nil
+}
+
+func (s *Store) CompareAndSwap(_ context.Context, key, old, new string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key)
+	if e == nil || e.kind != kindString || e.str != old {
+		return false, nil
+	}
+	e.str, e.expireAt = new, s.expireAt(ttl)
+	return true, nil
+}
+
+func (s *Store) CompareAndExpire(_ context.Context, key, value string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key)
+	if e == nil || e.kind != kindString || e.str != value {
+		return false, nil
+	}
+	e.expireAt = s.expireAt(ttl)
+	return true, nil
+}
+
+func (s *Store) Expire(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key)
+	if e == nil {
+		return false, nil
+	}
+	if ttl <= 0 {
+		delete(s.data, key)
+		return true, nil
+	}
+	e.expireAt = s.expireAt(ttl)
+	return true, nil
+}
+
+func (s *Store) ZAdd(_ context.Context, key string, score float64, member string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.zset(key)
+	if err != nil {
+		return err
+	}
+	e.zset[member] = score
+	return nil
+}
+
+func (s *Store) ZRem(_ context.Context, key string, members ...string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.lookupKind(key, kindZSet)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	var n int64
+	for _, m := range members {
+		if _, ok := e.zset[m]; ok {
+			delete(e.zset, m)
+			n++
+		}
+	}
+	if len(e.zset) == 0 {
+		delete(s.data, key)
+	}
+	return n, nil
+}
+
+func (s *Store) ZRangeByScore(_ context.Context, key string, min, max float64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.lookupKind(key, kindZSet)
+	if err != nil || e == nil {
+		return []string{}, err
+	}
+	members := []string{}
+	for _, m := range sortedMembers(e.zset) {
+		if score := e.zset[m]; score >= min && score <= max {
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
+
+func (s *Store) ZPopToStream(_ context.Context, key string, max float64, count int64, stream, field string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.lookupKind(key, kindZSet)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	st, err := s.stream(stream, true)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, m := range sortedMembers(e.zset) {
+		if n >= count || e.zset[m] > max {
+			break
+		}
+		delete(e.zset, m)
+		st.add(s.now(), map[string]interface{}{field: m})
+		n++
+	}
+	if len(e.zset) == 0 {
+		delete(s.data, key)
+	}
+	if n > 0 {
+		s.wake()
+	}
+	return n, nil
+}
+
+// zset 返回有序集合，不存在时创建
+func (s *Store) zset(key string) (*entry, error) {
+	e, err := s.lookupKind(key, kindZSet)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		e = &entry{kind: kindZSet, zset: make(map[string]float64)}
+		s.data[key] = e
+	}
+	return e, nil
+}
+
+// sortedMembers 按分值升序、分值相同按成员字典序排列，与redis一致
+func sortedMembers(z map[string]float64) []string {
+	members := make([]string, 0, len(z))
+	for m := range z {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := z[members[i]], z[members[j]]
+		if a != b {
+			return a < b
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+// SlidingWindow 与生产实现的Lua脚本逻辑相同：有序集合中保存窗口内每次请求的时间戳
+func (s *Store) SlidingWindow(_ context.Context, key string, limit int, window time.Duration, member string) (*redis.LimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.zset(key)
+	if err != nil {
+		return nil, err
+	}
+	now := float64(s.now().UnixMilli())
+	ms := float64(window.Milliseconds())
+	for m, score := range e.zset {
+		if score <= now-ms {
+			delete(e.zset, m)
+		}
+	}
+	res := &redis.LimitResult{Limit: limit}
+	if len(e.zset) < limit {
+		e.zset[member] = now
+		e.expireAt = s.expireAt(window)
+		res.Allowed = true
+	}
+	res.Remaining = limit - len(e.zset)
+	res.Reset = window
+	if members := sortedMembers(e.zset); len(members) > 0 {
+		res.Reset = time.Duration(e.zset[members[0]]+ms-now) * time.Millisecond
+	}
+	if len(e.zset) == 0 {
+		delete(s.data, key)
+	}
+	if !res.Allowed {
+		res.RetryAfter = res.Reset
+	}
+	return res, nil
+}
+
+// TokenBucket 与生产实现的Lua脚本逻辑相同：哈希中保存剩余令牌数和上次更新时间
+func (s *Store) TokenBucket(_ context.Context, key string, capacity int, period time.Duration) (*redis.LimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.lookupKind(key, kindHash)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		e = &entry{kind: kindHash, hash: make(map[string]string)}
+		s.data[key] = e
+	}
+	c := float64(capacity)
+	rate := c / float64(period.Milliseconds()) // 每毫秒补充的令牌数
+	now := float64(s.now().UnixMilli())
+	tokens, err := strconv.ParseFloat(e.hash["tokens"], 64)
+	if err != nil {
+		tokens = c
+	}
+	ts, err := strconv.ParseFloat(e.hash["ts"], 64)
+	if err != nil {
+		ts = now
+	}
+	tokens = math.Min(c, tokens+math.Max(0, now-ts)*rate)
+	res := &redis.LimitResult{Limit: capacity}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration(math.Ceil((1-tokens)/rate)) * time.Millisecond
+	}
+	e.hash["tokens"] = strconv.FormatFloat(tokens, 'f', -1, 64)
+	e.hash["ts"] = strconv.FormatFloat(now, 'f', -1, 64)
+	e.expireAt = s.expireAt(time.Duration(math.Ceil(c/rate)) * time.Millisecond)
+	res.Remaining = int(math.Floor(tokens))
+	res.Reset = time.Duration(math.Ceil((c-tokens)/rate)) * time.Millisecond
+	return res, nil
+}
+
+// toString 按 go-redis 的规则把参数转换为字符串
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
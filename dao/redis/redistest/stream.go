@@ -0,0 +1,297 @@
+package redistest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"web_app/dao/redis"
+)
+
+var errNoGroup = errors.New("NOGROUP No such key or consumer group")
+
+type streamID struct {
+	ms, seq int64
+}
+
+func (id streamID) String() string {
+	return strconv.FormatInt(id.ms, 10) + "-" + strconv.FormatInt(id.seq, 10)
+}
+
+func (id streamID) less(o streamID) bool {
+	return id.ms < o.ms || id.ms == o.ms && id.seq < o.seq
+}
+
+func parseID(s string) (streamID, bool) {
+	ms, seq, ok := strings.Cut(s, "-")
+	if !ok {
+		return streamID{}, false
+	}
+	a, err1 := strconv.ParseInt(ms, 10, 64)
+	b, err2 := strconv.ParseInt(seq, 10, 64)
+	return streamID{a, b}, err1 == nil && err2 == nil
+}
+
+type streamEntry struct {
+	id     streamID
+	values map[string]interface{}
+}
+
+type pendingEntry struct {
+	id          streamID
+	consumer    string
+	deliveredAt time.Time
+	count       int64
+}
+
+type group struct {
+	// next 下一条未投递消息在 entries 中的下标
+	next    int
+	pending map[string]*pendingEntry
+}
+
+type stream struct {
+	entries []streamEntry
+	last    streamID
+	groups  map[string]*group
+}
+
+// add 追加消息并生成自增ID，值与 go-redis 读取时一样转换为字符串
+func (st *stream) add(now time.Time, values map[string]interface{}) string {
+	id := streamID{ms: now.UnixMilli()}
+	if !st.last.less(id) {
+		id = streamID{st.last.ms, st.last.seq + 1}
+	}
+	st.last = id
+	vals := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		vals[k] = toString(v)
+	}
+	st.entries = append(st.entries, streamEntry{id: id, values: vals})
+	return id.String()
+}
+
+func (st *stream) find(id streamID) (streamEntry, bool) {
+	i := sort.Search(len(st.entries), func(i int) bool { return !st.entries[i].id.less(id) })
+	if i < len(st.entries) && st.entries[i].id == id {
+		return st.entries[i], true
+	}
+	return streamEntry{}, false
+}
+
+// stream 返回stream，不存在且 create 为 true 时创建
+func (s *Store) stream(key string, create bool) (*stream, error) {
+	e, err := s.lookupKind(key, kindStream)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		e = &entry{kind: kindStream, stream: &stream{groups: make(map[string]*group)}}
+		s.data[key] = e
+	}
+	return e.stream, nil
+}
+
+// wake 唤醒等待新消息的 XReadGroup，调用方持有锁
+func (s *Store) wake() {
+	if s.closed {
+		return
+	}
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+func (s *Store) group(stream, name string) (*stream, *group, error) {
+	st, err := s.stream(stream, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st == nil || st.groups[name] == nil {
+		return nil, nil, errNoGroup
+	}
+	return st, st.groups[name], nil
+}
+
+func (s *Store) XGroupCreate(_ context.Context, stream, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.stream(stream, true)
+	if err != nil {
+		return err
+	}
+	if st.groups[name] == nil {
+		st.groups[name] = &group{pending: make(map[string]*pendingEntry)}
+	}
+	return nil
+}
+
+func (s *Store) XAdd(_ context.Context, stream string, values map[string]interface{}) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.stream(stream, true)
+	if err != nil {
+		return "", err
+	}
+	id := st.add(s.now(), values)
+	s.wake()
+	return id, nil
+}
+
+// XReadGroup block 小于等于0时不等待
+func (s *Store) XReadGroup(ctx context.Context, name, consumer, stream string, count int64, block time.Duration) ([]redis.XMessage, error) {
+	var timeout <-chan time.Time
+	if block > 0 {
+		t := time.NewTimer(block)
+		defer t.Stop()
+		timeout = t.C
+	}
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil, errClosed
+		}
+		st, g, err := s.group(stream, name)
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		if g.next < len(st.entries) {
+			msgs := s.deliver(st, g, consumer, count)
+			s.mu.Unlock()
+			return msgs, nil
+		}
+		notify := s.notify
+		s.mu.Unlock()
+		if timeout == nil {
+			return nil, nil
+		}
+		select {
+		case <-notify:
+		case <-timeout:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// deliver 把未投递的消息交给 consumer 并记入pending，调用方持有锁
+func (s *Store) deliver(st *stream, g *group, consumer string, count int64) []redis.XMessage {
+	var msgs []redis.XMessage
+	for ; g.next < len(st.entries) && (count <= 0 || int64(len(msgs)) < count); g.next++ {
+		e := st.entries[g.next]
+		g.pending[e.id.String()] = &pendingEntry{id: e.id, consumer: consumer, deliveredAt: s.now(), count: 1}
+		msgs = append(msgs, message(e))
+	}
+	return msgs
+}
+
+func (s *Store) XAck(_ context.Context, stream, name string, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, g, err := s.group(stream, name)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(g.pending, id)
+	}
+	return nil
+}
+
+func (s *Store) XPending(_ context.Context, stream, name string, count int64) ([]redis.XPending, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, g, err := s.group(stream, name)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*pendingEntry, 0, len(g.pending))
+	for _, p := range g.pending {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id.less(list[j].id) })
+	if count > 0 && int64(len(list)) > count {
+		list = list[:count]
+	}
+	out := make([]redis.XPending, len(list))
+	for i, p := range list {
+		out[i] = redis.XPending{
+			Id:         p.id.String(),
+			Consumer:   p.consumer,
+			Idle:       s.now().Sub(p.deliveredAt),
+			RetryCount: p.count,
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) XClaim(_ context.Context, stream, name, consumer string, minIdle time.Duration, ids ...string) ([]redis.XMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, g, err := s.group(stream, name)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []redis.XMessage
+	for _, raw := range ids {
+		p, ok := g.pending[raw]
+		if !ok || s.now().Sub(p.deliveredAt) < minIdle {
+			continue
+		}
+		id, _ := parseID(raw)
+		e, ok := st.find(id)
+		if !ok {
+			// 消息已被删除，redis 同样会把它从pending中移除
+			delete(g.pending, raw)
+			continue
+		}
+		p.consumer = consumer
+		p.deliveredAt = s.now()
+		p.count++
+		msgs = append(msgs, message(e))
+	}
+	return msgs, nil
+}
+
+func (s *Store) XTouch(_ context.Context, stream, name, consumer string, ids ...string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, g, err := s.group(stream, name)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, raw := range ids {
+		if p, ok := g.pending[raw]; ok && p.consumer == consumer {
+			p.deliveredAt = s.now()
+			n++
+		}
+	}
+	return n, nil
+}
+
+// StreamLen 返回stream中的消息数，不存在时返回0，供测试断言
+func (s *Store) StreamLen(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.stream(key, false)
+	if err != nil || st == nil {
+		return 0
+	}
+	return len(st.entries)
+}
+
+func message(e streamEntry) redis.XMessage {
+	values := make(map[string]interface{}, len(e.values))
+	for k, v := range e.values {
+		values[k] = v
+	}
+	return redis.XMessage{ID: e.id.String(), Values: values}
+}
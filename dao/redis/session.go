@@ -0,0 +1,166 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"web_app/models"
+)
+
+const (
+	sessionPrefix = "session:"
+	// userSessionsPrefix 用户的会话索引，有序集合，成员为会话ID，分值为创建时间
+	userSessionsPrefix = "session:user:"
+	// sessionSeenSuffix 最近访问时间和IP单独保存，会话本身创建后不再改写
+	sessionSeenSuffix = ":seen"
+)
+
+// CreateSession 保存新会话并加入用户的会话索引，会话在 ttl 后过期，索引在 indexTTL 后过期
+func CreateSession(ctx context.Context, s *models.Session, ttl, indexTTL time.Duration) error {
+	if Rdb() == nil {
+		return errNotInitialized
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err = Rdb().Set(ctx, sessionPrefix+s.ID, b, ttl); err != nil {
+		return err
+	}
+	index := userSessionsPrefix + s.UserID
+	if err = Rdb().ZAdd(ctx, index, float64(s.CreatedAt.Unix()), s.ID); err != nil {
+		return err
+	}
+	_, err = Rdb().Expire(ctx, index, indexTTL)
+	return err
+}
+
+// GetSession 查询会话，不存在或已过期时返回 nil
+func GetSession(ctx context.Context, id string) (*models.Session, error) {
+	s, _, err := getSession(ctx, id)
+	return s, err
+}
+
+// TouchSession 会话仍然存在时把过期时间顺延为 ttl 并记录本次访问，返回会话是否存在。
+// 只比较后续期不重写会话，已被吊销的会话不会因为并发的访问而恢复
+func TouchSession(ctx context.Context, id, ip string, now time.Time, ttl time.Duration) (bool, error) {
+	if Rdb() == nil {
+		return false, errNotInitialized
+	}
+	_, raw, err := getSession(ctx, id)
+	if err != nil || raw == "" {
+		return false, err
+	}
+	ok, err := Rdb().CompareAndExpire(ctx, sessionPrefix+id, raw, ttl)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, Rdb().Set(ctx, sessionPrefix+id+sessionSeenSuffix, strconv.FormatInt(now.UnixMilli(), 10)+" "+ip, ttl)
+}
+
+// ListUserSessions 用户所有未过期的会话，按创建时间排序；索引中已过期的会话顺便清理
+func ListUserSessions(ctx context.Context, userID string) ([]*models.Session, error) {
+	if Rdb() == nil {
+		return nil, errNotInitialized
+	}
+	index := userSessionsPrefix + userID
+	ids, err := Rdb().ZRangeByScore(ctx, index, math.Inf(-1), math.Inf(1))
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*models.Session, 0, len(ids))
+	var stale []string
+	for _, id := range ids {
+		s, err := GetSession(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil || s.UserID != userID {
+			stale = append(stale, id)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	if len(stale) > 0 {
+		if _, err = Rdb().ZRem(ctx, index, stale...); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+// DeleteSession 删除会话并移出用户的会话索引，返回会话是否存在
+func DeleteSession(ctx context.Context, userID, id string) (bool, error) {
+	if Rdb() == nil {
+		return false, errNotInitialized
+	}
+	n, err := Rdb().Del(ctx, sessionPrefix+id, sessionPrefix+id+sessionSeenSuffix)
+	if err != nil {
+		return false, err
+	}
+	if _, err = Rdb().ZRem(ctx, userSessionsPrefix+userID, id); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeleteUserSessions 删除用户的所有会话，返回删除的数量
+func DeleteUserSessions(ctx context.Context, userID string) (int, error) {
+	if Rdb() == nil {
+		return 0, errNotInitialized
+	}
+	index := userSessionsPrefix + userID
+	ids, err := Rdb().ZRangeByScore(ctx, index, math.Inf(-1), math.Inf(1))
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	keys := make([]string, len(ids))
+	seen := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i], seen[i] = sessionPrefix+id, sessionPrefix+id+sessionSeenSuffix
+	}
+	n, err := Rdb().Del(ctx, keys...)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = Rdb().Del(ctx, seen...); err != nil {
+		return 0, err
+	}
+	// 只移除查到的成员，并发登录新建的会话保留在索引中
+	if _, err = Rdb().ZRem(ctx, index, ids...); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// getSession 返回会话和它在redis中的原始值，原始值用于比较后续期
+func getSession(ctx context.Context, id string) (*models.Session, string, error) {
+	if Rdb() == nil {
+		return nil, "", errNotInitialized
+	}
+	raw, err := Rdb().Get(ctx, sessionPrefix+id)
+	if err == Nil {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	s := new(models.Session)
+	if err = json.Unmarshal([]byte(raw), s); err != nil {
+		return nil, "", err
+	}
+	seen, err := Rdb().Get(ctx, sessionPrefix+id+sessionSeenSuffix)
+	if err != nil && err != Nil {
+		return nil, "", err
+	}
+	if ts, ip, ok := strings.Cut(seen, " "); ok {
+		if ms, err := strconv.ParseInt(ts, 10, 64); err == nil {
+			s.LastSeenAt = time.UnixMilli(ms).UTC()
+			s.IP = ip
+		}
+	}
+	return s, raw, nil
+}
@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"context"
+	"time"
+	"web_app/settings"
+
+	"github.com/go-redis/redis"
+)
+
+// Nil key不存在时 Get 返回的错误
+const Nil = redis.Nil
+
+type (
+	// Message pub/sub 消息
+	Message = redis.Message
+	// XMessage stream 中的一条消息
+	XMessage = redis.XMessage
+	// XPending 消费组中一条未确认消息的状态
+	XPending = redis.XPendingExt
+)
+
+// Subscription 频道订阅，Close 后 Channel 会被关闭
+type Subscription interface {
+	Channel() <-chan *Message
+	Close() error
+}
+
+// Store 应用用到的redis命令子集。生产环境由 go-redis 实现，单元测试可以换成
+// redistest 包中的进程内实现。需要多条命令原子执行的操作（限流、比较后删除等）
+// 作为整体方法出现在接口中，实现方自行保证原子性，调用方不依赖Lua脚本
+type Store interface {
+	Ping(ctx context.Context) error
+	Close() error
+
+	// 字符串，ttl 为0表示不过期
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error)
+	Incr(ctx context.Context, key string) (int64, error)
+	// IncrExpire 加一，key 没有过期时间（包括新建）时设置为 ttl，固定窗口计数用
+	IncrExpire(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	Del(ctx context.Context, keys ...string) (int64, error)
+	// CompareAndDelete 值等于 value 时删除，返回是否删除
+	CompareAndDelete(ctx context.Context, key, value string) (bool, error)
+	// CompareAndSwap 值等于 old 时替换为 new 并设置过期时间，返回是否替换
+	CompareAndSwap(ctx context.Context, key, old, new string, ttl time.Duration) (bool, error)
+	// CompareAndExpire 值等于 value 时重设过期时间，返回是否设置
+	CompareAndExpire(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	// Expire 设置任意类型key的过期时间，key不存在时返回 false
+	Expire(ctx context.Context, key string, ttl time.Duration) (bool, error)
+
+	// 有序集合
+	ZAdd(ctx context.Context, key string, score float64, member string) error
+	ZRem(ctx context.Context, key string, members ...string) (int64, error)
+	// ZRangeByScore 分值在 [min, max] 内的成员，按分值升序；用 math.Inf 表示不设上下限
+	ZRangeByScore(ctx context.Context, key string, min, max float64) ([]string, error)
+	// ZPopToStream 把分值不大于 max 的成员（最多 count 个）从有序集合移到stream，
+	// 成员作为 field 字段的值，返回移动的数量。集群模式下两个key需要用 {hash tag} 放在同一槽位
+	ZPopToStream(ctx context.Context, key string, max float64, count int64, stream, field string) (int64, error)
+
+	// 限流，member 为本次请求在窗口中的唯一标识
+	SlidingWindow(ctx context.Context, key string, limit int, window time.Duration, member string) (*LimitResult, error)
+	TokenBucket(ctx context.Context, key string, capacity int, period time.Duration) (*LimitResult, error)
+
+	// pub/sub
+	Publish(ctx context.Context, channel, message string) error
+	Subscribe(channels ...string) Subscription
+
+	// stream 和消费组
+	// XGroupCreate 创建消费组，stream 不存在时一并创建，消费组已存在时不报错
+	XGroupCreate(ctx context.Context, stream, group string) error
+	XAdd(ctx context.Context, stream string, values map[string]interface{}) (string, error)
+	// XReadGroup 读取尚未投递给消费组的新消息，最多阻塞 block（小于等于0时不阻塞），超时返回空切片
+	XReadGroup(ctx context.Context, group, consumer, stream string, count int64, block time.Duration) ([]XMessage, error)
+	XAck(ctx context.Context, stream, group string, ids ...string) error
+	XPending(ctx context.Context, stream, group string, count int64) ([]XPending, error)
+	// XClaim 把空闲超过 minIdle 的未确认消息转给 consumer，返回成功认领的消息
+	XClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, ids ...string) ([]XMessage, error)
+	// XTouch 把仍属于 consumer 的未确认消息的空闲时间清零，不增加投递次数，返回续期的消息数
+	XTouch(ctx context.Context, stream, group, consumer string, ids ...string) (int64, error)
+}
+
+// Use 替换当前的存储（不带本地缓存），返回恢复原值的函数，供测试注入 redistest.Store
+func Use(s Store) (restore func()) {
+	prev := current.Swap(&client{Store: s})
+	return func() { current.Store(prev) }
+}
+
+// UseWithLocal 与 Use 相同，同时按 cfg 开启本地缓存，供测试本地缓存层
+func UseWithLocal(s Store, cfg settings.LocalCacheConfig) (restore func()) {
+	c := &client{Store: s, local: newLocalCache(cfg, s)}
+	prev := current.Swap(c)
+	return func() {
+		current.Store(prev)
+		c.local.close()
+	}
+}
@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+const (
+	revokedTokenPrefix  = "auth:revoked:"
+	refreshFamilyPrefix = "auth:refresh:"
+	subjectCutoffPrefix = "auth:revoked_before:"
+)
+
+// RevokeToken 把令牌ID加入吊销列表，ttl 为令牌剩余有效期，过期后记录自动清理
+func RevokeToken(ctx context.Context, jti string, ttl time.Duration) error {
+	if Rdb() == nil {
+		return errNotInitialized
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	return Rdb().Set(ctx, revokedTokenPrefix+jti, 1, ttl)
+}
+
+// TokenRevoked 令牌ID是否在吊销列表中
+func TokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if Rdb() == nil {
+		return false, errNotInitialized
+	}
+	_, err := Rdb().Get(ctx, revokedTokenPrefix+jti)
+	if err == Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SetRefreshFamily 记录刷新令牌族当前有效的令牌ID，同一族中只有最新签发的刷新令牌可用
+func SetRefreshFamily(ctx context.Context, family, jti string, ttl time.Duration) error {
+	if Rdb() == nil {
+		return errNotInitialized
+	}
+	return Rdb().Set(ctx, refreshFamilyPrefix+family, jti, ttl)
+}
+
+// RotateRefreshFamily 当前有效令牌为 oldJTI 时原子地替换为 newJTI。返回 false 时 current 为族中
+// 现在的令牌ID，为空表示族已被吊销或过期，不为空说明 oldJTI 是已经轮换掉的旧令牌
+func RotateRefreshFamily(ctx context.Context, family, oldJTI, newJTI string, ttl time.Duration) (ok bool, current string, err error) {
+	if Rdb() == nil {
+		return false, "", errNotInitialized
+	}
+	key := refreshFamilyPrefix + family
+	ok, err = Rdb().CompareAndSwap(ctx, key, oldJTI, newJTI, ttl)
+	if err != nil || ok {
+		return ok, "", err
+	}
+	current, err = Rdb().Get(ctx, key)
+	if err == Nil {
+		return false, "", nil
+	}
+	return false, current, err
+}
+
+// RevokeRefreshFamily 吊销整个刷新令牌族，族中所有刷新令牌都不能再使用
+func RevokeRefreshFamily(ctx context.Context, family string) error {
+	if Rdb() == nil {
+		return errNotInitialized
+	}
+	_, err := Rdb().Del(ctx, refreshFamilyPrefix+family)
+	return err
+}
+
+// RevokeSubjectTokens 吊销主体在 before 之前签发的所有令牌，精确到微秒；ttl 为令牌的最长有效期，之后记录自动清理
+func RevokeSubjectTokens(ctx context.Context, subject string, before time.Time, ttl time.Duration) error {
+	if Rdb() == nil {
+		return errNotInitialized
+	}
+	return Rdb().Set(ctx, subjectCutoffPrefix+subject, before.UnixMicro(), ttl)
+}
+
+// SubjectTokensRevokedBefore 主体的令牌吊销时间点，在此之前签发的令牌无效；没有记录时返回零值
+func SubjectTokensRevokedBefore(ctx context.Context, subject string) (time.Time, error) {
+	if Rdb() == nil {
+		return time.Time{}, errNotInitialized
+	}
+	v, err := Rdb().Get(ctx, subjectCutoffPrefix+subject)
+	if err == Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	us, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMicro(us), nil
+}
@@ -0,0 +1,241 @@
+package deps
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 内置依赖名称
+const (
+	MySQL = "mysql"
+	Redis = "redis"
+)
+
+const (
+	defaultStartupTimeout = 30 * time.Second
+	defaultRetryInterval  = time.Second
+	defaultCheckInterval  = 10 * time.Second
+	maxRetryInterval      = 30 * time.Second
+	pingTimeout           = 2 * time.Second
+)
+
+// Dependency 服务启动时需要连接的外部依赖
+type Dependency struct {
+	Name string
+	// Required 为 true 时启动截止前仍连接失败会导致启动失败，
+	// 否则以降级模式启动，依赖的路由返回503，并在后台持续重连
+	Required bool
+	// Connect 建立新连接并替换当前连接，失败时必须保持当前连接不变，
+	// 重连期间其他goroutine可能仍在使用旧连接
+	Connect func() error
+	Ping    func(ctx context.Context) error
+	Close   func() error
+
+	up         atomic.Bool
+	connecting atomic.Bool
+}
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]*Dependency)
+	ordered  []*Dependency
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+)
+
+// Register 注册依赖，需要在 Start 之前调用
+func Register(d *Dependency) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[d.Name] = d
+	ordered = append(ordered, d)
+}
+
+// Up 返回依赖当前是否可用，未注册的依赖视为不可用
+func Up(name string) bool {
+	mu.RLock()
+	d, ok := registry[name]
+	mu.RUnlock()
+	return ok && d.up.Load()
+}
+
+// Start 按注册顺序连接所有依赖，失败时指数退避重试，每个依赖单独计算截止时间，
+// 前面的依赖耗尽时间不会挤占后面的依赖。必需依赖最终失败时返回错误；可选依赖失败则转入后台重连。
+// 启动成功后会定期检查依赖，断开的依赖同样转入后台重连。
+func Start(cfg settings.StartupConfig) error {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultStartupTimeout
+	}
+	retry := cfg.RetryInterval
+	if retry <= 0 {
+		retry = defaultRetryInterval
+	}
+	var ctx context.Context
+	ctx, cancel = context.WithCancel(context.Background())
+	for _, d := range ordered {
+		deadline, stop := context.WithTimeout(ctx, timeout)
+		err := connect(deadline, d, retry)
+		stop()
+		if err != nil {
+			if d.Required {
+				return fmt.Errorf("connect %s: %w", d.Name, err)
+			}
+			zap.L().Warn("可选依赖不可用，以降级模式启动", zap.String("dependency", d.Name), zap.Error(err))
+			reconnect(ctx, d, retry)
+		}
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		monitor(ctx, retry)
+	}()
+	return nil
+}
+
+// Stop 停止后台重连和检查，并关闭所有依赖。断开后重连失败的依赖仍持有旧连接，同样需要关闭
+func Stop() {
+	if cancel != nil {
+		cancel()
+	}
+	wg.Wait()
+	for i := len(ordered) - 1; i >= 0; i-- {
+		d := ordered[i]
+		d.up.Store(false)
+		if d.Close != nil {
+			if err := d.Close(); err != nil {
+				zap.L().Warn("关闭依赖失败", zap.String("dependency", d.Name), zap.Error(err))
+			}
+		}
+	}
+}
+
+// connect 在ctx结束前不断重试连接，间隔按指数增长
+func connect(ctx context.Context, d *Dependency, interval time.Duration) error {
+	for attempt := 1; ; attempt++ {
+		err := d.Connect()
+		if err == nil {
+			d.up.Store(true)
+			zap.L().Info("依赖连接成功", zap.String("dependency", d.Name), zap.Int("attempt", attempt))
+			return nil
+		}
+		zap.L().Warn("依赖连接失败", zap.String("dependency", d.Name), zap.Int("attempt", attempt), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
+
+// reconnect 在后台重连依赖，同一依赖同时只有一个重连goroutine。
+// 不先关闭旧连接：Connect 成功时会自行替换并关闭它，失败时旧连接保留，恢复后可以继续使用
+func reconnect(ctx context.Context, d *Dependency, interval time.Duration) {
+	if !d.connecting.CompareAndSwap(false, true) {
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer d.connecting.Store(false)
+		connect(ctx, d, interval)
+	}()
+}
+
+// monitor 定期ping已连接的依赖，失败的标记为不可用并后台重连
+func monitor(ctx context.Context, retry time.Duration) {
+	ticker := time.NewTicker(defaultCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, d := range ordered {
+			if !d.up.Load() || d.Ping == nil {
+				continue
+			}
+			pctx, cancel := context.WithTimeout(ctx, pingTimeout)
+			err := d.Ping(pctx)
+			cancel()
+			if err != nil && ctx.Err() == nil {
+				d.up.Store(false)
+				zap.L().Error("依赖断开，开始后台重连", zap.String("dependency", d.Name), zap.Error(err))
+				reconnect(ctx, d, retry)
+			}
+		}
+	}
+}
+
+// Require 依赖不可用时直接返回503，用于降级模式下保护依赖这些服务的路由
+func Require(names ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, name := range names {
+			if !Up(name) {
+				c.Header("Retry-After", "10")
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+					"error": fmt.Sprintf("%s is unavailable", name),
+				})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// Status 依赖的一次检查结果
+type Status struct {
+	Name     string        `json:"name"`
+	Required bool          `json:"required"`
+	Up       bool          `json:"up"`
+	Latency  time.Duration `json:"latency"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Check 并发ping所有依赖，单个依赖最多等待 timeout；
+// 后台正在重连的依赖直接视为不可用
+func Check(ctx context.Context, timeout time.Duration) []Status {
+	mu.RLock()
+	list := append([]*Dependency(nil), ordered...)
+	mu.RUnlock()
+	statuses := make([]Status, len(list))
+	var checks sync.WaitGroup
+	for i, d := range list {
+		statuses[i] = Status{Name: d.Name, Required: d.Required}
+		if !d.up.Load() || d.Ping == nil {
+			statuses[i].Up = d.up.Load()
+			if !statuses[i].Up {
+				statuses[i].Error = "not connected"
+			}
+			continue
+		}
+		checks.Add(1)
+		go func(s *Status, d *Dependency) {
+			defer checks.Done()
+			pctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := time.Now()
+			err := d.Ping(pctx)
+			s.Latency = time.Since(start)
+			s.Up = err == nil
+			if err != nil {
+				s.Error = err.Error()
+			}
+		}(&statuses[i], d)
+	}
+	checks.Wait()
+	return statuses
+}
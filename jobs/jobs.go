@@ -0,0 +1,91 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+	"web_app/dao/redis"
+)
+
+const (
+	// {jobs} 保证集群模式下这些key在同一个槽位，延迟任务可以原子地移回stream
+	streamKey  = "{jobs}:stream"
+	delayedKey = "{jobs}:delayed"
+	deadKey    = "{jobs}:dead"
+	groupName  = "workers"
+	// 任务序列化后保存在stream消息的该字段中
+	jobField = "job"
+)
+
+// Job 一个待执行的任务
+type Job struct {
+	// ID 任务在stream中的消息ID，入队时由redis生成
+	ID         string          `json:"-"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempt    int             `json:"attempt"` // 从1开始
+	EnqueuedAt time.Time       `json:"enqueued_at"`
+}
+
+// Bind 把任务参数解析到v
+func (j *Job) Bind(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Handler 任务处理函数，返回错误时按退避策略重试，超过最大次数进入死信队列
+type Handler func(ctx context.Context, job *Job) error
+
+var (
+	mu       sync.RWMutex
+	handlers = make(map[string]Handler)
+)
+
+// Register 注册任务类型的处理函数，需要在 Start 之前调用
+func Register(jobType string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[jobType] = h
+}
+
+func handlerFor(jobType string) (Handler, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	h, ok := handlers[jobType]
+	return h, ok
+}
+
+// ErrUnavailable redis 不可用，任务无法入队
+var ErrUnavailable = errors.New("jobs: redis is not available")
+
+// Enqueue 把任务加入队列，payload 序列化为JSON，返回任务ID；redis 不可用时返回 ErrUnavailable。
+// 任务由任意启动了任务队列的实例执行，入队的实例自己不需要启动队列
+func Enqueue(ctx context.Context, jobType string, payload interface{}) (string, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return add(ctx, &Job{Type: jobType, Payload: raw, Attempt: 1, EnqueuedAt: time.Now()})
+}
+
+func add(ctx context.Context, job *Job) (string, error) {
+	if redis.Rdb() == nil {
+		return "", ErrUnavailable
+	}
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	return redis.Rdb().XAdd(ctx, streamKey, map[string]interface{}{jobField: string(raw)})
+}
+
+// decode 解析stream消息，内容损坏时返回的任务 Type 为空，会直接进入死信队列
+func decode(msg redis.XMessage) *Job {
+	job := new(Job)
+	if raw, ok := msg.Values[jobField].(string); ok {
+		json.Unmarshal([]byte(raw), job)
+	}
+	job.ID = msg.ID
+	return job
+}
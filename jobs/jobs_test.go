@@ -0,0 +1,265 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+	"web_app/dao/redis"
+	"web_app/dao/redis/redistest"
+	"web_app/settings"
+)
+
+func setup(t *testing.T, c settings.JobsConfig) (context.Context, *redistest.Store) {
+	t.Helper()
+	ctx := context.Background()
+	s, stop := redistest.Start()
+	t.Cleanup(stop)
+	prevCfg, prevConsumer, prevQueue := cfg, consumer, queue
+	cfg, consumer, queue = withDefaults(c), "test", make(chan *Job, 10)
+	t.Cleanup(func() {
+		cfg, consumer, queue = prevCfg, prevConsumer, prevQueue
+		held.Range(func(k, _ interface{}) bool {
+			held.Delete(k)
+			return true
+		})
+	})
+	if err := s.XGroupCreate(ctx, streamKey, groupName); err != nil {
+		t.Fatal(err)
+	}
+	return ctx, s
+}
+
+func register(t *testing.T, jobType string, h Handler) {
+	t.Helper()
+	Register(jobType, h)
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(handlers, jobType)
+		mu.Unlock()
+	})
+}
+
+// read 以 who 的身份读取一条新任务
+func read(t *testing.T, ctx context.Context, who string) *Job {
+	t.Helper()
+	msgs, err := redis.Rdb().XReadGroup(ctx, groupName, who, streamKey, 1, 0)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("read: %v, %d messages", err, len(msgs))
+	}
+	return decode(msgs[0])
+}
+
+// deadJobs 死信stream中的全部任务
+func deadJobs(t *testing.T, ctx context.Context) []*Job {
+	t.Helper()
+	if err := redis.Rdb().XGroupCreate(ctx, deadKey, "inspect"); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := redis.Rdb().XReadGroup(ctx, "inspect", "test", deadKey, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]*Job, len(msgs))
+	for i, msg := range msgs {
+		out[i] = decode(msg)
+	}
+	return out
+}
+
+func pending(t *testing.T, ctx context.Context) []redis.XPending {
+	t.Helper()
+	p, err := redis.Rdb().XPending(ctx, streamKey, groupName, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestEnqueueWithoutRedis(t *testing.T) {
+	restore := redis.Use(nil)
+	defer restore()
+	if _, err := Enqueue(context.Background(), "noop", nil); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("got %v, want %v", err, ErrUnavailable)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	setup(t, settings.JobsConfig{Backoff: time.Second})
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{10, 512 * time.Second},
+		{11, maxBackoff},
+		{70, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	failing := errors.New("boom")
+	tests := []struct {
+		name    string
+		jobType string
+		handler Handler
+		attempt int
+		retry   bool // 放入延迟队列等待重试
+		dead    bool // 进入死信队列
+	}{
+		{"success", "ok", func(context.Context, *Job) error { return nil }, 1, false, false},
+		{"failure is retried", "fail", func(context.Context, *Job) error { return failing }, 1, true, false},
+		{"panic is retried", "panic", func(context.Context, *Job) error { panic("boom") }, 2, true, false},
+		{"last attempt goes to dead letter", "fail", func(context.Context, *Job) error { return failing }, 3, false, true},
+		{"unknown type goes to dead letter", "unknown", nil, 1, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := setup(t, settings.JobsConfig{MaxAttempts: 3, Backoff: time.Minute})
+			if tt.handler != nil {
+				register(t, tt.jobType, tt.handler)
+			}
+			if _, err := add(ctx, &Job{Type: tt.jobType, Payload: json.RawMessage(`{"n":1}`), Attempt: tt.attempt}); err != nil {
+				t.Fatal(err)
+			}
+			job := read(t, ctx, consumer)
+			start := time.Now()
+			process(ctx, job)
+
+			if p := pending(t, ctx); len(p) != 0 {
+				t.Errorf("job left unacknowledged: %+v", p)
+			}
+			delayed, err := redis.Rdb().ZRangeByScore(ctx, delayedKey, math.Inf(-1), math.Inf(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(delayed) == 1; got != tt.retry {
+				t.Fatalf("scheduled retries = %d, want retry %v", len(delayed), tt.retry)
+			}
+			if tt.retry {
+				var retry Job
+				if err := json.Unmarshal([]byte(delayed[0]), &retry); err != nil {
+					t.Fatal(err)
+				}
+				if retry.Attempt != tt.attempt+1 || string(retry.Payload) != `{"n":1}` {
+					t.Errorf("retry = %+v", retry)
+				}
+				// 到期时间按退避计算，此前不会被搬回stream
+				due := start.Add(backoff(tt.attempt))
+				early, _ := redis.Rdb().ZRangeByScore(ctx, delayedKey, math.Inf(-1), float64(due.Add(-time.Second).UnixMilli()))
+				if len(early) != 0 {
+					t.Errorf("retry due before %v", due)
+				}
+			}
+			dead := deadJobs(t, ctx)
+			if got := len(dead) == 1; got != tt.dead {
+				t.Fatalf("dead letters = %d, want dead %v", len(dead), tt.dead)
+			}
+			if tt.dead && (dead[0].Type != tt.jobType || dead[0].Attempt != tt.attempt) {
+				t.Errorf("dead letter = %+v", dead[0])
+			}
+		})
+	}
+}
+
+func TestRetryPromoted(t *testing.T) {
+	ctx, _ := setup(t, settings.JobsConfig{MaxAttempts: 3})
+	register(t, "fail", func(context.Context, *Job) error { return errors.New("boom") })
+	if _, err := add(ctx, &Job{Type: "fail", Attempt: 1}); err != nil {
+		t.Fatal(err)
+	}
+	process(ctx, read(t, ctx, consumer))
+	// 到期的重试任务原样放回stream
+	n, err := redis.Rdb().ZPopToStream(ctx, delayedKey, float64(time.Now().Add(time.Hour).UnixMilli()), 100, streamKey, jobField)
+	if err != nil || n != 1 {
+		t.Fatalf("promoted %d, %v", n, err)
+	}
+	if job := read(t, ctx, consumer); job.Type != "fail" || job.Attempt != 2 {
+		t.Errorf("promoted job = %+v", job)
+	}
+}
+
+func TestClaimStale(t *testing.T) {
+	const visibility = time.Minute
+	tests := []struct {
+		name       string
+		idle       time.Duration // 持有者读取后经过的时间
+		deliveries int           // 读取前已经被认领过的次数
+		held       bool          // 任务由本实例持有
+		claimed    bool
+		dead       bool
+	}{
+		{"stale job is claimed", 2 * visibility, 0, false, true, false},
+		{"job within visibility timeout is left alone", 0, 0, false, false, false},
+		{"job held by this worker is renewed", 2 * visibility, 0, true, false, false},
+		{"job delivered too many times goes to dead letter", 2 * visibility, 3, false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, s := setup(t, settings.JobsConfig{MaxAttempts: 3, VisibilityTimeout: visibility})
+			id, err := add(ctx, &Job{Type: "slow", Attempt: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			owner := "crashed"
+			if tt.held {
+				owner = consumer
+				held.Store(id, struct{}{})
+			}
+			read(t, ctx, owner)
+			for i := 0; i < tt.deliveries; i++ {
+				s.FastForward(visibility)
+				if _, err := s.XClaim(ctx, streamKey, groupName, "other", 0, id); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.FastForward(tt.idle)
+			touchHeld(ctx)
+			claimStale(ctx)
+			var got *Job
+			select {
+			case got = <-queue:
+			default:
+			}
+
+			if (got != nil) != tt.claimed {
+				t.Fatalf("claimed %+v, want claimed %v", got, tt.claimed)
+			}
+			p := pending(t, ctx)
+			if tt.dead {
+				if len(p) != 0 {
+					t.Errorf("dead-lettered job still pending: %+v", p)
+				}
+				if dead := deadJobs(t, ctx); len(dead) != 1 {
+					t.Errorf("dead letters = %d, want 1", len(dead))
+				}
+				return
+			}
+			if got != nil && got.ID != id {
+				t.Errorf("claimed %s, want %s", got.ID, id)
+			}
+			if len(p) != 1 {
+				t.Fatalf("pending = %+v", p)
+			}
+			wantOwner := owner
+			if tt.claimed {
+				wantOwner = consumer
+			}
+			if p[0].Consumer != wantOwner {
+				t.Errorf("pending owner = %s, want %s", p[0].Consumer, wantOwner)
+			}
+			if tt.held && p[0].Idle >= visibility {
+				t.Errorf("held job not renewed, idle %v", p[0].Idle)
+			}
+		})
+	}
+}
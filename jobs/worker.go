@@ -0,0 +1,317 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"web_app/dao/redis"
+	"web_app/settings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWorkers           = 4
+	defaultMaxAttempts       = 5
+	defaultBackoff           = time.Second
+	maxBackoff               = 10 * time.Minute
+	defaultVisibilityTimeout = 5 * time.Minute
+	defaultDrainTimeout      = 30 * time.Second
+	readBlock                = 2 * time.Second
+	promoteInterval          = time.Second
+)
+
+var (
+	cfg      settings.JobsConfig
+	consumer string
+	queue    chan *Job
+	// held 本实例已读取、尚未确认的任务ID（排队中或执行中），claimLoop 为它们续期而不是认领
+	held sync.Map
+
+	stopFetch context.CancelFunc
+	stopWork  context.CancelFunc
+	fetchWg   sync.WaitGroup
+	workWg    sync.WaitGroup
+)
+
+// Start 创建消费组并启动拉取、延迟任务搬运、超时认领和 Workers 个工作goroutine
+func Start(c settings.JobsConfig) error {
+	cfg = withDefaults(c)
+	host, _ := os.Hostname()
+	consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	if redis.Rdb() == nil {
+		return ErrUnavailable
+	}
+	if err := redis.Rdb().XGroupCreate(context.Background(), streamKey, groupName); err != nil {
+		return err
+	}
+	queue = make(chan *Job, cfg.Workers)
+	var fetchCtx, workCtx context.Context
+	fetchCtx, stopFetch = context.WithCancel(context.Background())
+	workCtx, stopWork = context.WithCancel(context.Background())
+	for _, loop := range []func(context.Context){fetchLoop, promoteLoop, claimLoop} {
+		fetchWg.Add(1)
+		go func(loop func(context.Context)) {
+			defer fetchWg.Done()
+			loop(fetchCtx)
+		}(loop)
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		workWg.Add(1)
+		go func() {
+			defer workWg.Done()
+			for job := range queue {
+				process(workCtx, job)
+				held.Delete(job.ID)
+			}
+		}()
+	}
+	zap.L().Info("任务队列已启动", zap.String("consumer", consumer), zap.Int("workers", cfg.Workers))
+	return nil
+}
+
+// Stop 停止拉取新任务，等待执行中的任务完成；超过 DrainTimeout 后取消它们，
+// 未确认的任务会在可见性超时后被其他实例认领
+func Stop() {
+	if stopFetch == nil {
+		return
+	}
+	stopFetch()
+	fetchWg.Wait()
+	close(queue)
+	done := make(chan struct{})
+	go func() {
+		workWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(cfg.DrainTimeout):
+		zap.L().Warn("任务未在超时前完成，强制取消")
+		stopWork()
+		<-done
+	}
+	stopWork()
+	stopFetch = nil
+	// 未执行的任务留在pending中，由其他实例在可见性超时后认领
+	held.Range(func(k, _ interface{}) bool {
+		held.Delete(k)
+		return true
+	})
+}
+
+func withDefaults(c settings.JobsConfig) settings.JobsConfig {
+	if c.Workers <= 0 {
+		c.Workers = defaultWorkers
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultMaxAttempts
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = defaultBackoff
+	}
+	if c.VisibilityTimeout <= 0 {
+		c.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if c.DrainTimeout <= 0 {
+		c.DrainTimeout = defaultDrainTimeout
+	}
+	return c
+}
+
+// fetchLoop 从消费组读取新任务，队列满时阻塞，形成背压
+func fetchLoop(ctx context.Context) {
+	for ctx.Err() == nil {
+		msgs, err := redis.Rdb().XReadGroup(ctx, groupName, consumer, streamKey, int64(cfg.Workers), readBlock)
+		if err != nil {
+			zap.L().Warn("读取任务失败", zap.Error(err))
+			sleep(ctx, readBlock)
+			continue
+		}
+		for _, msg := range msgs {
+			held.Store(msg.ID, struct{}{})
+			select {
+			case queue <- decode(msg):
+			case <-ctx.Done():
+				// 已读取但未处理的任务留在pending中，之后会被认领
+				return
+			}
+		}
+	}
+}
+
+// promoteLoop 定期把到期的重试任务放回stream
+func promoteLoop(ctx context.Context) {
+	ticker := time.NewTicker(promoteInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		_, err := redis.Rdb().ZPopToStream(ctx, delayedKey, float64(time.Now().UnixMilli()), 100, streamKey, jobField)
+		if err != nil {
+			zap.L().Warn("搬运延迟任务失败", zap.Error(err))
+		}
+	}
+}
+
+// claimLoop 为本实例持有的任务续期，并认领超过可见性超时仍未确认的任务（执行它的实例可能已经崩溃）
+func claimLoop(ctx context.Context) {
+	ticker := time.NewTicker(cfg.VisibilityTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		touchHeld(ctx)
+		claimStale(ctx)
+	}
+}
+
+// claimStale 认领其他实例超时未确认的任务放入本地队列，
+// 投递次数过多的任务直接进入死信队列，防止有问题的任务反复拖垮worker
+func claimStale(ctx context.Context) {
+	pending, err := redis.Rdb().XPending(ctx, streamKey, groupName, 100)
+	if err != nil {
+		zap.L().Warn("查询未确认任务失败", zap.Error(err))
+		return
+	}
+	for _, p := range pending {
+		if p.Idle < cfg.VisibilityTimeout {
+			continue
+		}
+		if _, ok := held.Load(p.Id); ok {
+			continue
+		}
+		msgs, err := redis.Rdb().XClaim(ctx, streamKey, groupName, consumer, cfg.VisibilityTimeout, p.Id)
+		if err != nil || len(msgs) == 0 {
+			continue
+		}
+		job := decode(msgs[0])
+		zap.L().Warn("认领超时任务", zap.String("id", job.ID), zap.String("from", p.Consumer), zap.Int64("deliveries", p.RetryCount))
+		if int(p.RetryCount) > cfg.MaxAttempts {
+			deadLetter(job, fmt.Errorf("delivered %d times without ack", p.RetryCount))
+			continue
+		}
+		held.Store(job.ID, struct{}{})
+		select {
+		case queue <- job:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// touchHeld 重置本实例持有任务的空闲时间，执行时间超过可见性超时的任务不会被其他实例重复认领；
+// 实例崩溃后不再续期，任务照常在超时后被接管
+func touchHeld(ctx context.Context) {
+	var ids []string
+	held.Range(func(k, _ interface{}) bool {
+		ids = append(ids, k.(string))
+		return true
+	})
+	if len(ids) == 0 {
+		return
+	}
+	if _, err := redis.Rdb().XTouch(ctx, streamKey, groupName, consumer, ids...); err != nil {
+		zap.L().Warn("任务续期失败", zap.Int("count", len(ids)), zap.Error(err))
+	}
+}
+
+func process(ctx context.Context, job *Job) {
+	log := zap.L().With(zap.String("job_id", job.ID), zap.String("type", job.Type), zap.Int("attempt", job.Attempt))
+	h, ok := handlerFor(job.Type)
+	if !ok {
+		deadLetter(job, fmt.Errorf("no handler for job type %q", job.Type))
+		return
+	}
+	start := time.Now()
+	err := safeRun(ctx, h, job)
+	if err == nil {
+		ack(job)
+		log.Info("任务执行成功", zap.Duration("cost", time.Since(start)))
+		return
+	}
+	if job.Attempt >= cfg.MaxAttempts {
+		deadLetter(job, err)
+		return
+	}
+	delay := backoff(job.Attempt)
+	log.Warn("任务执行失败，稍后重试", zap.Duration("delay", delay), zap.Error(err))
+	retry := *job
+	retry.Attempt++
+	if err := schedule(&retry, time.Now().Add(delay)); err != nil {
+		// 不确认，可见性超时后会被重新认领
+		log.Error("安排重试失败", zap.Error(err))
+		return
+	}
+	ack(job)
+}
+
+// safeRun 执行处理函数，panic 视为失败
+func safeRun(ctx context.Context, h Handler, job *Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return h(ctx, job)
+}
+
+// backoff 指数退避: Backoff * 2^(attempt-1)，上限10分钟
+func backoff(attempt int) time.Duration {
+	d := cfg.Backoff << uint(attempt-1)
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+// schedule 把任务放入延迟队列，到期后由 promoteLoop 放回stream
+func schedule(job *Job, at time.Time) error {
+	member, err := json.Marshal(struct {
+		*Job
+		// 不同任务内容相同时避免在有序集合中被合并
+		Nonce int64 `json:"nonce"`
+	}{job, time.Now().UnixNano()})
+	if err != nil {
+		return err
+	}
+	return redis.Rdb().ZAdd(context.Background(), delayedKey, float64(at.UnixMilli()), string(member))
+}
+
+// deadLetter 写入死信stream并确认原任务
+func deadLetter(job *Job, cause error) {
+	raw, _ := json.Marshal(job)
+	values := map[string]interface{}{
+		jobField:      string(raw),
+		"error":       cause.Error(),
+		"original_id": job.ID,
+	}
+	if _, err := redis.Rdb().XAdd(context.Background(), deadKey, values); err != nil {
+		zap.L().Error("写入死信队列失败", zap.String("job_id", job.ID), zap.Error(err))
+		return
+	}
+	ack(job)
+	zap.L().Error("任务进入死信队列", zap.String("job_id", job.ID), zap.String("type", job.Type), zap.Error(cause))
+}
+
+func ack(job *Job) {
+	if err := redis.Rdb().XAck(context.Background(), streamKey, groupName, job.ID); err != nil {
+		zap.L().Warn("确认任务失败", zap.String("job_id", job.ID), zap.Error(err))
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
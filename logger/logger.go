@@ -111,6 +111,7 @@ func GinLogger() gin.HandlerFunc {
 			zap.String("ip", c.ClientIP()),
 			zap.String("user-agent", c.Request.UserAgent()),
 			zap.String("errors", c.Errors.ByType(gin.ErrorTypePrivate).String()),
+			zap.String("request_id", RequestIDFromContext(c.Request.Context())),
 			zap.Duration("cost", cost),
 		)
 	}
@@ -0,0 +1,38 @@
+package logic
+
+import (
+	"context"
+	"strings"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/dao/redis"
+	"web_app/models"
+
+	"go.uber.org/zap"
+)
+
+// latestRateCache 货币对最新汇率的缓存，key 为 USD/CNY 形式的货币对
+var latestRateCache = redis.NewCache[*models.ExchangeRate]("exchange_rate:latest", redis.CacheOptions{
+	TTL: 5 * time.Minute,
+})
+
+func init() {
+	// 写入新汇率后清除对应货币对的缓存
+	mysql.OnWrite("exchange_rates", func(ctx context.Context, pairs []string) {
+		if err := latestRateCache.Invalidate(ctx, pairs...); err != nil {
+			zap.L().Warn("清除汇率缓存失败", zap.Strings("pairs", pairs), zap.Error(err))
+		}
+	})
+}
+
+// GetLatestExchangeRate 查询货币对最新汇率，优先读缓存，不存在时返回 redis.ErrNotFound
+func GetLatestExchangeRate(ctx context.Context, base, quote string) (*models.ExchangeRate, error) {
+	base, quote = strings.ToUpper(base), strings.ToUpper(quote)
+	return latestRateCache.GetOrLoad(ctx, base+"/"+quote, func(ctx context.Context) (*models.ExchangeRate, error) {
+		rate, err := mysql.GetLatestExchangeRate(ctx, base, quote)
+		if err == nil && rate == nil {
+			return nil, redis.ErrNotFound
+		}
+		return rate, err
+	})
+}
@@ -0,0 +1,190 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+	"web_app/captcha"
+	"web_app/dao/redis"
+	"web_app/settings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxFailures   = 5
+	defaultIPMaxFailures = 20
+	defaultFailureWindow = 15 * time.Minute
+	defaultLockoutBase   = time.Minute
+	defaultLockoutMax    = time.Hour
+	defaultCaptchaAfter  = 3
+	// lockLevelTTL 锁定时长按这段时间内被锁定的次数翻倍
+	lockLevelTTL = 24 * time.Hour
+)
+
+var (
+	// ErrAccountLocked 失败次数过多，账号或IP暂时锁定，具体的剩余时长见 LockoutError
+	ErrAccountLocked = errors.New("too many failed attempts, try again later")
+	// ErrCaptchaRequired 失败次数较多，需要先获取并填写验证码
+	ErrCaptchaRequired = errors.New("captcha required")
+	// ErrInvalidCaptcha 验证码错误或已过期，需要重新获取
+	ErrInvalidCaptcha = errors.New("invalid or expired captcha")
+)
+
+// LockoutError 账号或IP处于锁定中，RetryAfter 为剩余的锁定时长
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string { return ErrAccountLocked.Error() }
+
+func (e *LockoutError) Unwrap() error { return ErrAccountLocked }
+
+// accountKey 已注册用户按ID计数，用户名和邮箱登录共用一个计数；
+// 不存在的用户按登录名计数，锁定行为与已注册用户相同，不暴露用户是否存在
+func accountKey(userID int64, login string) string {
+	if userID > 0 {
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+	return "login:" + login
+}
+
+func ipKey(ip string) string { return "ip:" + ip }
+
+func registerIPKey(ip string) string { return "register:ip:" + ip }
+
+// checkLocked 任意一个 key 处于锁定中时返回 LockoutError。redis 不可用时放行，
+// 账号保护不应让登录整体不可用
+func checkLocked(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		until, err := redis.LockedOutUntil(ctx, key)
+		if err != nil {
+			zap.L().Warn("查询锁定状态失败", zap.String("key", key), zap.Error(err))
+			continue
+		}
+		if !until.IsZero() {
+			return &LockoutError{RetryAfter: time.Until(until)}
+		}
+	}
+	return nil
+}
+
+// checkCaptcha 任意一个 key 的失败次数达到阈值时要求验证码，验证码无论对错都会作废
+func checkCaptcha(ctx context.Context, id, answer string, keys ...string) error {
+	if !captchaRequired(ctx, keys...) {
+		return nil
+	}
+	if id == "" || answer == "" {
+		return ErrCaptchaRequired
+	}
+	ok, err := captcha.Verify(ctx, id, answer)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCaptcha
+	}
+	return nil
+}
+
+func captchaRequired(ctx context.Context, keys ...string) bool {
+	after := settings.Config().SecurityConfig.CaptchaAfter
+	if after <= 0 {
+		after = defaultCaptchaAfter
+	}
+	for _, key := range keys {
+		n, err := redis.Failures(ctx, key)
+		if err != nil {
+			zap.L().Warn("查询失败次数失败", zap.String("key", key), zap.Error(err))
+			continue
+		}
+		if n >= int64(after) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordFailure 记录一次失败，达到 limit 时锁定 key 并返回 LockoutError。
+// 锁定时长从 LockoutBase 开始，24小时内每再锁定一次翻倍，不超过 LockoutMax。
+// 只有计数恰好等于 limit 的请求执行锁定，并发的失败请求不会各自锁定一次把时长连续翻倍；
+// 超过 limit 的请求是在锁定生效前通过了检查的，同样返回 LockoutError
+func recordFailure(ctx context.Context, key string, limit int) error {
+	cfg := settings.Config().SecurityConfig
+	window := cfg.FailureWindow
+	if window <= 0 {
+		window = defaultFailureWindow
+	}
+	n, err := redis.RecordFailure(ctx, key, window)
+	if err != nil {
+		zap.L().Warn("记录失败次数失败", zap.String("key", key), zap.Error(err))
+		return nil
+	}
+	if limit <= 0 || n < int64(limit) {
+		return nil
+	}
+	if n > int64(limit) {
+		if until, err := redis.LockedOutUntil(ctx, key); err == nil && !until.IsZero() {
+			return &LockoutError{RetryAfter: time.Until(until)}
+		}
+		return nil
+	}
+	level, err := redis.LockoutLevel(ctx, key)
+	if err != nil {
+		zap.L().Warn("查询锁定次数失败", zap.String("key", key), zap.Error(err))
+	}
+	d := lockoutDuration(level)
+	if _, err = redis.LockOut(ctx, key, time.Now().Add(d), lockLevelTTL); err != nil {
+		zap.L().Warn("锁定失败", zap.String("key", key), zap.Error(err))
+		return nil
+	}
+	zap.L().Warn("失败次数过多，暂时锁定", zap.String("key", key), zap.Duration("duration", d))
+	return &LockoutError{RetryAfter: d}
+}
+
+// recordLoginFailure 登录失败同时计入账号和IP，任一达到上限时返回 LockoutError
+func recordLoginFailure(ctx context.Context, account, ip string) error {
+	cfg := settings.Config().SecurityConfig
+	maxFailures, ipMaxFailures := cfg.MaxFailures, cfg.IPMaxFailures
+	if maxFailures <= 0 {
+		maxFailures = defaultMaxFailures
+	}
+	if ipMaxFailures <= 0 {
+		ipMaxFailures = defaultIPMaxFailures
+	}
+	err := recordFailure(ctx, account, maxFailures)
+	if ip != "" {
+		if ipErr := recordFailure(ctx, ipKey(ip), ipMaxFailures); err == nil {
+			err = ipErr
+		}
+	}
+	return err
+}
+
+// resetFailures 登录成功后清零账号的失败计数。IP的计数不清零，
+// 否则持有一个有效账号就能不断重置同一IP对其他账号的尝试次数
+func resetFailures(ctx context.Context, account string) {
+	if err := redis.ResetFailures(ctx, account); err != nil {
+		zap.L().Warn("清零失败次数失败", zap.String("key", account), zap.Error(err))
+	}
+}
+
+func lockoutDuration(level int64) time.Duration {
+	cfg := settings.Config().SecurityConfig
+	base, max := cfg.LockoutBase, cfg.LockoutMax
+	if base <= 0 {
+		base = defaultLockoutBase
+	}
+	if max <= 0 {
+		max = defaultLockoutMax
+	}
+	d := base
+	for i := int64(0); i < level && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
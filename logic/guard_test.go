@@ -0,0 +1,117 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"web_app/dao/redis"
+	"web_app/dao/redis/redistest"
+	"web_app/settings"
+)
+
+// useSecurity 在测试期间使用给定的安全配置
+func useSecurity(t *testing.T, cfg settings.SecurityConfig) {
+	t.Helper()
+	prev := settings.Config().SecurityConfig
+	settings.Config().SecurityConfig = cfg
+	t.Cleanup(func() { settings.Config().SecurityConfig = prev })
+}
+
+func TestLockoutDuration(t *testing.T) {
+	useSecurity(t, settings.SecurityConfig{LockoutBase: time.Minute, LockoutMax: 5 * time.Minute})
+	tests := []struct {
+		level int64
+		want  time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{2, 4 * time.Minute},
+		{3, 5 * time.Minute},
+		{10, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.level); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %s, want %s", tt.level, got, tt.want)
+		}
+	}
+}
+
+// TestRecordFailure 每轮失败达到上限时锁定，锁定时长逐轮翻倍直到上限
+func TestRecordFailure(t *testing.T) {
+	store, stop := redistest.Start()
+	defer stop()
+	useSecurity(t, settings.SecurityConfig{FailureWindow: time.Hour, LockoutBase: time.Minute, LockoutMax: 3 * time.Minute})
+	ctx := context.Background()
+	const key, limit = "user:1", 3
+	for round, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		for i := 1; i < limit; i++ {
+			if err := recordFailure(ctx, key, limit); err != nil {
+				t.Fatalf("round %d, failure %d: %v", round, i, err)
+			}
+		}
+		var lockErr *LockoutError
+		if err := recordFailure(ctx, key, limit); !errors.As(err, &lockErr) || lockErr.RetryAfter != want {
+			t.Fatalf("round %d: got %v, want lockout for %s", round, err, want)
+		}
+		if err := checkLocked(ctx, key); !errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("round %d: checkLocked = %v, want %v", round, err, ErrAccountLocked)
+		}
+		store.FastForward(want + time.Second)
+		if err := checkLocked(ctx, key); err != nil {
+			t.Fatalf("round %d: still locked after %s: %v", round, want, err)
+		}
+	}
+}
+
+// TestRecordFailureConcurrent 达到上限时并发的失败请求只锁定一次，锁定时长不会被连续翻倍
+func TestRecordFailureConcurrent(t *testing.T) {
+	_, stop := redistest.Start()
+	defer stop()
+	useSecurity(t, settings.SecurityConfig{FailureWindow: time.Hour, LockoutBase: time.Minute})
+	ctx := context.Background()
+	const key, limit = "ip:192.0.2.1", 3
+	for i := 1; i < limit; i++ {
+		recordFailure(ctx, key, limit)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recordFailure(ctx, key, limit)
+		}()
+	}
+	wg.Wait()
+	if level, err := redis.LockoutLevel(ctx, key); err != nil || level != 1 {
+		t.Errorf("lockout level = %d (%v), want 1", level, err)
+	}
+}
+
+func TestCaptchaRequired(t *testing.T) {
+	_, stop := redistest.Start()
+	defer stop()
+	useSecurity(t, settings.SecurityConfig{FailureWindow: time.Hour, CaptchaAfter: 2})
+	ctx := context.Background()
+	tests := []struct {
+		failures int
+		want     bool
+	}{
+		{0, false},
+		{1, false},
+		{2, true},
+	}
+	for _, tt := range tests {
+		key := "login:" + string(rune('a'+tt.failures))
+		for i := 0; i < tt.failures; i++ {
+			recordFailure(ctx, key, 10)
+		}
+		if got := captchaRequired(ctx, "ip:192.0.2.9", key); got != tt.want {
+			t.Errorf("%d failures: captchaRequired = %v, want %v", tt.failures, got, tt.want)
+		}
+		if err := checkCaptcha(ctx, "", "", key); tt.want != errors.Is(err, ErrCaptchaRequired) {
+			t.Errorf("%d failures: checkCaptcha without answer = %v", tt.failures, err)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package logic
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/dao/redis"
+	"web_app/models"
+	"web_app/settings"
+	"web_app/totp"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 10
+	// totpSkew 允许前后各一个时间步的时钟偏差
+	totpSkew = 1
+)
+
+var (
+	// ErrOTPRequired 账号已开启两步验证，需要提供认证器App的验证码或恢复码
+	ErrOTPRequired = errors.New("two-factor code required")
+	// ErrInvalidOTP 验证码或恢复码不正确，或验证码已经使用过
+	ErrInvalidOTP = errors.New("invalid two-factor code")
+	// ErrTOTPNotConfigured 没有配置加密TOTP密钥的密钥
+	ErrTOTPNotConfigured = errors.New("two-factor authentication not configured")
+	// ErrTOTPAlreadyEnabled 已经开启两步验证
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	// ErrTOTPNotEnabled 没有开启两步验证
+	ErrTOTPNotEnabled = errors.New("two-factor authentication not enabled")
+	// ErrTOTPNotEnrolled 没有待确认的绑定，需要先发起绑定
+	ErrTOTPNotEnrolled = errors.New("no pending two-factor enrolment")
+)
+
+// GetTOTPStatus 查询用户两步验证的状态
+func GetTOTPStatus(ctx context.Context, userID int64) (*models.TOTPStatus, error) {
+	t, err := mysql.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	status := new(models.TOTPStatus)
+	if t == nil {
+		return status, nil
+	}
+	if t.EnabledAt == nil {
+		status.Pending = true
+		return status, nil
+	}
+	status.Enabled, status.EnabledAt = true, t.EnabledAt
+	if status.RecoveryCodesLeft, err = mysql.CountRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// EnrollTOTP 发起绑定，生成新的密钥，返回密钥和供认证器App扫码的 otpauth 地址。
+// 用户用App中的验证码调用 ConfirmTOTP 后才真正开启，重复发起会替换之前未确认的密钥
+func EnrollTOTP(ctx context.Context, userID int64) (secret, uri string, err error) {
+	user, err := GetUser(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	secret = totp.NewSecret()
+	sealed, err := sealSecret(secret)
+	if err != nil {
+		return "", "", err
+	}
+	if err = mysql.CreatePendingTOTP(ctx, userID, sealed); errors.Is(err, mysql.ErrDuplicate) {
+		return "", "", ErrTOTPAlreadyEnabled
+	}
+	if err != nil {
+		return "", "", err
+	}
+	issuer := settings.Config().SecurityConfig.TOTPIssuer
+	if issuer == "" {
+		issuer = settings.Config().Name
+	}
+	return secret, totp.URI(secret, issuer, user.Username), nil
+}
+
+// ConfirmTOTP 用认证器App的验证码确认绑定，开启两步验证并返回恢复码。恢复码只在这里明文出现一次
+func ConfirmTOTP(ctx context.Context, userID int64, code string) ([]string, error) {
+	t, err := mysql.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, ErrTOTPNotEnrolled
+	}
+	if t.EnabledAt != nil {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if err = guardOTP(ctx, userID, func() error { return checkTOTP(ctx, t, code) }); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err = mysql.EnableTOTP(ctx, userID, hashes); errors.Is(err, mysql.ErrNotFound) {
+		// 并发的另一个请求已经确认或重新发起了绑定
+		return nil, ErrTOTPNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP 关闭两步验证，需要同时提供密码和验证码（或恢复码），防止会话被盗用后关闭
+func DisableTOTP(ctx context.Context, userID int64, password, otp string) error {
+	user, err := GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	t, err := enabledTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	err = guardOTP(ctx, userID, func() error {
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+			return ErrInvalidCredentials
+		}
+		return verifyOTP(ctx, t, otp)
+	})
+	if err != nil {
+		return err
+	}
+	if err = mysql.DeleteTOTP(ctx, userID); errors.Is(err, mysql.ErrNotFound) {
+		return ErrTOTPNotEnabled
+	}
+	return err
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，之前的恢复码全部失效，需要提供认证器App的验证码
+func RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) ([]string, error) {
+	t, err := enabledTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err = guardOTP(ctx, userID, func() error { return checkTOTP(ctx, t, code) }); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err = mysql.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// guardOTP 两步验证管理接口的验证码校验同样受账号锁定保护，
+// 否则拿到访问令牌就可以通过这些接口穷举验证码
+func guardOTP(ctx context.Context, userID int64, check func() error) error {
+	key := accountKey(userID, "")
+	if err := checkLocked(ctx, key); err != nil {
+		return err
+	}
+	err := check()
+	if errors.Is(err, ErrInvalidOTP) || errors.Is(err, ErrInvalidCredentials) {
+		maxFailures := settings.Config().SecurityConfig.MaxFailures
+		if maxFailures <= 0 {
+			maxFailures = defaultMaxFailures
+		}
+		if lockErr := recordFailure(ctx, key, maxFailures); lockErr != nil {
+			return lockErr
+		}
+	}
+	return err
+}
+
+// enabledTOTP 查询已开启的两步验证，未开启时返回 ErrTOTPNotEnabled
+func enabledTOTP(ctx context.Context, userID int64) (*models.UserTOTP, error) {
+	t, err := mysql.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || t.EnabledAt == nil {
+		return nil, ErrTOTPNotEnabled
+	}
+	return t, nil
+}
+
+// verifyOTP 校验登录时提供的验证码，6位数字按TOTP校验，其他按恢复码校验
+func verifyOTP(ctx context.Context, t *models.UserTOTP, otp string) error {
+	otp = strings.TrimSpace(otp)
+	if otp == "" {
+		return ErrOTPRequired
+	}
+	if len(otp) == totp.Digits && isDigits(otp) {
+		return checkTOTP(ctx, t, otp)
+	}
+	hash, err := hashRecoveryCode(normalizeRecoveryCode(otp))
+	if err != nil {
+		return err
+	}
+	ok, err := mysql.UseRecoveryCode(ctx, t.UserID, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidOTP
+	}
+	zap.L().Info("使用恢复码登录", zap.Int64("user_id", t.UserID))
+	return nil
+}
+
+// checkTOTP 校验认证器App的验证码，同一时间步的验证码只能使用一次；redis 不可用时返回错误
+func checkTOTP(ctx context.Context, t *models.UserTOTP, code string) error {
+	secret, err := openSecret(t.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Validate(secret, strings.TrimSpace(code), time.Now(), totpSkew)
+	if !ok {
+		return ErrInvalidOTP
+	}
+	ttl := time.Duration(2*totpSkew+1) * totp.Period
+	fresh, err := redis.ClaimNonce(ctx, "totp:"+strconv.FormatInt(t.UserID, 10)+":"+strconv.FormatInt(step, 10), ttl)
+	if err != nil {
+		// 无法记录已使用的验证码时拒绝登录，否则截获的验证码在有效期内可以重放
+		return err
+	}
+	if !fresh {
+		return ErrInvalidOTP
+	}
+	return nil
+}
+
+// newRecoveryCodes 生成恢复码，每个80位随机数，形如 k3xq-7vha-2m4p-9tbe，返回明文和保存到数据库的哈希
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+		hash, err := hashRecoveryCode(code)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code[:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:])
+		hashes = append(hashes, hash)
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 用由 totp_key 派生的密钥计算 HMAC-SHA256，
+// 只拿到数据库中的哈希无法离线穷举恢复码
+func hashRecoveryCode(code string) (string, error) {
+	key := settings.Config().SecurityConfig.TOTPKey
+	if len(key) < 32 {
+		return "", ErrTOTPNotConfigured
+	}
+	mac := hmac.New(sha256.New, []byte("recovery-code:"+key))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// totpCipher 由配置的密钥派生 AES-256-GCM，密钥不足32字节时返回 ErrTOTPNotConfigured
+func totpCipher() (cipher.AEAD, error) {
+	key := settings.Config().SecurityConfig.TOTPKey
+	if len(key) < 32 {
+		return nil, ErrTOTPNotConfigured
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSecret 加密TOTP密钥，结果为 base64(nonce || 密文)
+func sealSecret(secret string) (string, error) {
+	aead, err := totpCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func openSecret(sealed string) (string, error) {
+	aead, err := totpCipher()
+	if err != nil {
+		return "", err
+	}
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(b) < aead.NonceSize() {
+		return "", errors.New("totp: malformed secret")
+	}
+	secret, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("totp: cannot decrypt secret, was totp_key changed?")
+	}
+	return string(secret), nil
+}
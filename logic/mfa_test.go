@@ -0,0 +1,117 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/dao/redis"
+	"web_app/dao/redis/redistest"
+	"web_app/models"
+	"web_app/settings"
+	"web_app/totp"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// setupTOTP 创建开启了两步验证的用户，返回用户ID、TOTP密钥和恢复码
+func setupTOTP(t *testing.T) (context.Context, int64, string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	_, stop := redistest.Start()
+	t.Cleanup(stop)
+	if err := mysql.Init(settings.MysqlConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "test.db")}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mysql.Close() })
+	if err := mysql.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	useSecurity(t, settings.SecurityConfig{TOTPKey: strings.Repeat("k", 32), MaxFailures: 3, LockoutBase: time.Minute})
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: string(hash)}
+	if err := mysql.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	secret, _, err := EnrollTOTP(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := totp.Code(secret, time.Now())
+	codes, err := ConfirmTOTP(ctx, user.ID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx, user.ID, secret, codes
+}
+
+func TestVerifyOTP(t *testing.T) {
+	ctx, userID, secret, codes := setupTOTP(t)
+	current, _ := totp.Code(secret, time.Now())
+	// 下一个时间步在允许的偏差内，且一定没有被确认绑定时使用过
+	next, _ := totp.Code(secret, time.Now().Add(totp.Period))
+	tests := []struct {
+		name string
+		otp  string
+		want error
+	}{
+		{"empty", " ", ErrOTPRequired},
+		{"code used to confirm enrolment", current, ErrInvalidOTP},
+		{"wrong code", "000000", ErrInvalidOTP},
+		{"code within skew", next, nil},
+		{"same code again", next, ErrInvalidOTP},
+		{"recovery code", codes[0], nil},
+		{"recovery code reused", codes[0], ErrInvalidOTP},
+		{"recovery code in upper case without dashes", strings.ToUpper(strings.ReplaceAll(codes[1], "-", " ")), nil},
+		{"unknown recovery code", "aaaa-bbbb-cccc-dddd", ErrInvalidOTP},
+	}
+	rec, err := enabledTOTP(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyOTP(ctx, rec, tt.otp); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if n, err := mysql.CountRecoveryCodes(ctx, userID); err != nil || n != len(codes)-2 {
+		t.Errorf("recovery codes left = %d (%v), want %d", n, err, len(codes)-2)
+	}
+}
+
+// TestGuardOTPLockout 管理接口的验证码错误次数过多后锁定账号，锁定期间正确的验证码同样被拒绝
+func TestGuardOTPLockout(t *testing.T) {
+	ctx, userID, secret, _ := setupTOTP(t)
+	for i := 1; i < 3; i++ {
+		if _, err := RegenerateRecoveryCodes(ctx, userID, "000000"); !errors.Is(err, ErrInvalidOTP) {
+			t.Fatalf("attempt %d: got %v, want %v", i, err, ErrInvalidOTP)
+		}
+	}
+	if _, err := RegenerateRecoveryCodes(ctx, userID, "000000"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("attempt 3: got %v, want %v", err, ErrAccountLocked)
+	}
+	next, _ := totp.Code(secret, time.Now().Add(totp.Period))
+	if _, err := RegenerateRecoveryCodes(ctx, userID, next); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("valid code while locked: got %v, want %v", err, ErrAccountLocked)
+	}
+}
+
+// TestVerifyOTPWithoutRedis 无法记录已使用的验证码时拒绝正确的验证码，而不是放弃防重放
+func TestVerifyOTPWithoutRedis(t *testing.T) {
+	ctx, userID, secret, _ := setupTOTP(t)
+	rec, err := enabledTOTP(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore := redis.Use(nil)
+	defer restore()
+	next, _ := totp.Code(secret, time.Now().Add(totp.Period))
+	if err := verifyOTP(ctx, rec, next); err == nil || errors.Is(err, ErrInvalidOTP) {
+		t.Errorf("got %v, want a redis error", err)
+	}
+}
@@ -0,0 +1,31 @@
+package logic
+
+import (
+	"context"
+	"strconv"
+	"web_app/auth"
+	"web_app/models"
+	"web_app/session"
+)
+
+// StartSession 用用户名或邮箱和密码登录，为浏览器创建会话，返回写入cookie的值
+func StartSession(ctx context.Context, p LoginParams, userAgent string) (*models.User, string, *models.Session, error) {
+	user, err := Authenticate(ctx, p)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	cookie, s, err := session.Create(ctx, strconv.FormatInt(user.ID, 10), p.IP, userAgent)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return user, cookie, s, nil
+}
+
+// SignOutEverywhere 在所有设备上退出登录：吊销用户的全部会话，以及此前签发的访问令牌和刷新令牌
+func SignOutEverywhere(ctx context.Context, userID string) (int, error) {
+	n, err := session.RevokeAll(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return n, auth.RevokeAll(ctx, userID)
+}
@@ -0,0 +1,108 @@
+package logic
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"web_app/auth"
+	"web_app/session"
+	"web_app/settings"
+)
+
+func useSessions(t *testing.T) {
+	t.Helper()
+	prev := settings.Config().SessionConfig
+	settings.Config().SessionConfig = settings.SessionConfig{Secrets: []string{strings.Repeat("c", 32)}}
+	t.Cleanup(func() { settings.Config().SessionConfig = prev })
+}
+
+func TestStartSession(t *testing.T) {
+	tests := []struct {
+		name, login, password string
+		want                  error
+	}{
+		{"ok", "alice", "password", nil},
+		{"wrong password", "alice", "wrong password", ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := setupUsers(t)
+			useSessions(t)
+			alice := registerUser(t, ctx, "alice", "alice@example.com")
+			user, cookie, s, err := StartSession(ctx, LoginParams{Login: tt.login, Password: tt.password, IP: "192.0.2.1"}, "curl/8.0")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if user.ID != alice.ID || s.UserID != strconv.FormatInt(alice.ID, 10) || s.Device != "curl" {
+				t.Errorf("user = %+v, session = %+v", user, s)
+			}
+			if loaded, err := session.Load(ctx, cookie, "192.0.2.1"); err != nil || loaded.ID != s.ID {
+				t.Errorf("load: %+v, %v", loaded, err)
+			}
+		})
+	}
+}
+
+func TestSignOutEverywhere(t *testing.T) {
+	ctx, _ := setupUsers(t)
+	useSessions(t)
+	alice := registerUser(t, ctx, "alice", "alice@example.com")
+	registerUser(t, ctx, "bob", "bob@example.com")
+	aliceID := strconv.FormatInt(alice.ID, 10)
+	login := func(name string) (string, *auth.TokenPair) {
+		t.Helper()
+		p := LoginParams{Login: name, Password: "password", IP: "192.0.2.1"}
+		_, cookie, _, err := StartSession(ctx, p, "curl/8.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, pair, err := Login(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cookie, pair
+	}
+	aliceCookie, alicePair := login("alice")
+	aliceCookie2, _ := login("alice")
+	bobCookie, bobPair := login("bob")
+
+	n, err := SignOutEverywhere(ctx, aliceID)
+	if err != nil || n != 2 {
+		t.Fatalf("revoked %d sessions, %v; want 2", n, err)
+	}
+	tests := []struct {
+		name string
+		// check 返回使用会话或令牌时的错误
+		check func() error
+		want  error
+	}{
+		{"first session", func() error { _, err := session.Load(ctx, aliceCookie, "192.0.2.1"); return err }, session.ErrInvalidSession},
+		{"second session", func() error { _, err := session.Load(ctx, aliceCookie2, "192.0.2.1"); return err }, session.ErrInvalidSession},
+		{"access token", func() error { _, err := auth.Verify(ctx, alicePair.AccessToken); return err }, auth.ErrTokenRevoked},
+		{"refresh token", func() error { _, err := auth.Refresh(ctx, alicePair.RefreshToken); return err }, auth.ErrTokenRevoked},
+		{"other user's session", func() error { _, err := session.Load(ctx, bobCookie, "192.0.2.1"); return err }, nil},
+		{"other user's token", func() error { _, err := auth.Verify(ctx, bobPair.AccessToken); return err }, nil},
+		{"signing in again", func() error {
+			cookie, pair := login("alice")
+			if _, err := session.Load(ctx, cookie, "192.0.2.1"); err != nil {
+				return err
+			}
+			_, err := auth.Verify(ctx, pair.AccessToken)
+			return err
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.check(); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if n, err = SignOutEverywhere(ctx, aliceID); err != nil || n != 1 {
+		t.Errorf("second sign-out revoked %d sessions, %v; want the new one", n, err)
+	}
+}
@@ -0,0 +1,282 @@
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"web_app/auth"
+	"web_app/dao/mysql"
+	"web_app/mailer"
+	"web_app/models"
+	"web_app/settings"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultBcryptCost      = 12
+	defaultVerificationTTL = 24 * time.Hour
+	minPasswordLen         = 8
+	// bcrypt 只使用前72字节，更长的密码拒绝而不是静默截断
+	maxPasswordLen = 72
+)
+
+var (
+	// ErrInvalidUsername 用户名不合法
+	ErrInvalidUsername = errors.New("username must be 3-32 lowercase letters, digits or underscores")
+	// ErrInvalidEmail 邮箱格式不正确
+	ErrInvalidEmail = errors.New("invalid email address")
+	// ErrWeakPassword 密码长度不符合要求
+	ErrWeakPassword = errors.New("password must be 8-72 bytes")
+	// ErrUsernameTaken 用户名已被注册
+	ErrUsernameTaken = errors.New("username already taken")
+	// ErrEmailTaken 邮箱已被注册
+	ErrEmailTaken = errors.New("email already registered")
+	// ErrInvalidCredentials 用户不存在或密码错误，两种情况不做区分
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrEmailNotVerified 配置要求验证邮箱后才能登录
+	ErrEmailNotVerified = errors.New("email not verified")
+	// ErrInvalidVerificationToken 邮箱验证令牌不存在、已使用或已过期
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	// ErrEmailAlreadyVerified 邮箱已经验证过
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+
+	usernameRe = regexp.MustCompile(`^[a-z0-9_]{3,32}$`)
+
+	// dummyHash 用户不存在时也做一次比对，避免通过响应时间判断用户是否存在
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// RegisterParams 注册参数，同一IP注册失败次数较多时需要验证码
+type RegisterParams struct {
+	Username, Email, Password string
+	CaptchaID, CaptchaAnswer  string
+	IP                        string
+}
+
+// Register 注册用户并发送验证邮件，邮件发送失败不影响注册，用户可以重新发送。
+// 参数不合法和用户名、邮箱已被注册都计为该IP的注册失败，用于限制批量探测已注册的邮箱
+func Register(ctx context.Context, p RegisterParams) (*models.User, error) {
+	key := registerIPKey(p.IP)
+	if err := checkCaptcha(ctx, p.CaptchaID, p.CaptchaAnswer, key); err != nil {
+		return nil, err
+	}
+	user, err := register(ctx, p.Username, p.Email, p.Password)
+	if errors.Is(err, ErrInvalidUsername) || errors.Is(err, ErrInvalidEmail) || errors.Is(err, ErrWeakPassword) ||
+		errors.Is(err, ErrUsernameTaken) || errors.Is(err, ErrEmailTaken) {
+		// 注册失败只用于决定是否要求验证码，不锁定
+		recordFailure(ctx, key, 0)
+	}
+	return user, err
+}
+
+func register(ctx context.Context, username, email, password string) (*models.User, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !usernameRe.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return nil, ErrInvalidEmail
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{Username: username, Email: email, PasswordHash: hash}
+	if err = mysql.CreateUser(ctx, user); errors.Is(err, mysql.ErrDuplicate) {
+		return nil, takenError(ctx, username, email)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = sendVerification(ctx, user); err != nil {
+		zap.L().Error("发送验证邮件失败", zap.Int64("user_id", user.ID), zap.Error(err))
+	}
+	return user, nil
+}
+
+// LoginParams 登录参数。OTP 为认证器App的验证码或恢复码，账号开启两步验证时必填；
+// 账号或IP失败次数较多时需要验证码
+type LoginParams struct {
+	Login, Password          string
+	OTP                      string
+	CaptchaID, CaptchaAnswer string
+	IP                       string
+}
+
+// Login 用用户名或邮箱和密码登录，签发新的令牌对
+func Login(ctx context.Context, p LoginParams) (*models.User, *auth.TokenPair, error) {
+	user, err := Authenticate(ctx, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	pair, err := auth.Issue(ctx, strconv.FormatInt(user.ID, 10))
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, pair, nil
+}
+
+// Authenticate 校验用户名或邮箱和密码，配置要求时还需邮箱已验证，开启两步验证时还需验证码。
+// 密码或验证码错误同时计入账号和IP的失败次数，达到上限后锁定，锁定期间即使密码正确也不能登录
+func Authenticate(ctx context.Context, p LoginParams) (*models.User, error) {
+	login := strings.ToLower(strings.TrimSpace(p.Login))
+	user, err := mysql.GetUserByLogin(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	var userID int64
+	if user != nil {
+		userID = user.ID
+	}
+	account := accountKey(userID, login)
+	keys := []string{account}
+	if p.IP != "" {
+		keys = append(keys, ipKey(p.IP))
+	}
+	if err = checkLocked(ctx, keys...); err != nil {
+		return nil, err
+	}
+	if err = checkCaptcha(ctx, p.CaptchaID, p.CaptchaAnswer, keys...); err != nil {
+		return nil, err
+	}
+	if user == nil {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcryptCost())
+		})
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(p.Password))
+		return nil, loginFailed(ctx, account, p.IP, ErrInvalidCredentials)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(p.Password)) != nil {
+		return nil, loginFailed(ctx, account, p.IP, ErrInvalidCredentials)
+	}
+	if settings.Config().AccountConfig.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	t, err := mysql.GetUserTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil && t.EnabledAt != nil {
+		if err = verifyOTP(ctx, t, p.OTP); errors.Is(err, ErrInvalidOTP) {
+			return nil, loginFailed(ctx, account, p.IP, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	resetFailures(ctx, account)
+	return user, nil
+}
+
+// loginFailed 记录登录失败，本次失败导致锁定时返回 LockoutError，否则返回 err
+func loginFailed(ctx context.Context, account, ip string, err error) error {
+	if lockErr := recordLoginFailure(ctx, account, ip); lockErr != nil {
+		return lockErr
+	}
+	return err
+}
+
+// GetUser 按ID查询用户，不存在时返回 mysql.ErrNotFound
+func GetUser(ctx context.Context, id int64) (*models.User, error) {
+	user, err := mysql.GetUserByID(ctx, id)
+	if err == nil && user == nil {
+		return nil, mysql.ErrNotFound
+	}
+	return user, err
+}
+
+// VerifyEmail 使用邮件中的令牌验证邮箱
+func VerifyEmail(ctx context.Context, token string) (*models.User, error) {
+	id, err := mysql.ConsumeEmailVerification(ctx, hashToken(token))
+	if errors.Is(err, mysql.ErrNotFound) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetUser(mysql.WithPrimary(ctx), id)
+}
+
+// ResendVerification 重新发送验证邮件，之前发出的令牌失效
+func ResendVerification(ctx context.Context, userID int64) error {
+	user, err := GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	return sendVerification(ctx, user)
+}
+
+// sendVerification 生成验证令牌并发送验证邮件
+func sendVerification(ctx context.Context, user *models.User) error {
+	cfg := settings.Config().AccountConfig
+	ttl := cfg.VerificationTTL
+	if ttl <= 0 {
+		ttl = defaultVerificationTTL
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if err := mysql.CreateEmailVerification(ctx, user.ID, hashToken(token), time.Now().Add(ttl)); err != nil {
+		return err
+	}
+	validity := strconv.Itoa(int(ttl.Minutes())) + " 分钟"
+	if ttl%time.Hour == 0 {
+		validity = strconv.Itoa(int(ttl.Hours())) + " 小时"
+	}
+	body := "你好，" + user.Username + "：\n\n请使用下面的链接验证邮箱，链接 " + validity + "内有效：\n\n"
+	if cfg.VerificationURL != "" {
+		body += cfg.VerificationURL + token
+	} else {
+		body += "验证令牌：" + token
+	}
+	body += "\n\n如果不是你本人注册，请忽略这封邮件。\n"
+	return mailer.Send(ctx, &mailer.Message{To: user.Email, Subject: "验证你的邮箱", Body: body})
+}
+
+// takenError 注册冲突时说明是用户名还是邮箱已被注册
+func takenError(ctx context.Context, username, email string) error {
+	usernameTaken, _, err := mysql.UserExists(ctx, username, email)
+	if err != nil {
+		return err
+	}
+	if usernameTaken {
+		return ErrUsernameTaken
+	}
+	return ErrEmailTaken
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLen || len(password) > maxPasswordLen {
+		return "", ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost())
+	return string(hash), err
+}
+
+func bcryptCost() int {
+	if cost := settings.Config().AccountConfig.BcryptCost; cost > 0 {
+		return cost
+	}
+	return defaultBcryptCost
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,291 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"web_app/auth"
+	"web_app/dao/mysql"
+	"web_app/dao/redis/redistest"
+	"web_app/mailer"
+	"web_app/models"
+	"web_app/settings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// sentMail 记录发出的邮件，代替真正的发送方式
+type sentMail struct {
+	mu   sync.Mutex
+	msgs []*mailer.Message
+}
+
+func (m *sentMail) Send(_ context.Context, msg *mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.msgs = append(m.msgs, msg)
+	return nil
+}
+
+// token 取出最近一封发给 to 的验证邮件中的令牌
+func (m *sentMail) token(t *testing.T, to string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.msgs) - 1; i >= 0; i-- {
+		if m.msgs[i].To != to {
+			continue
+		}
+		_, token, ok := strings.Cut(m.msgs[i].Body, "验证令牌：")
+		if !ok {
+			t.Fatalf("no token in %q", m.msgs[i].Body)
+		}
+		token, _, _ = strings.Cut(token, "\n")
+		return token
+	}
+	t.Fatalf("no mail sent to %s", to)
+	return ""
+}
+
+func (m *sentMail) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.msgs)
+}
+
+func useAccount(t *testing.T, cfg settings.AccountConfig) {
+	t.Helper()
+	prev := settings.Config().AccountConfig
+	settings.Config().AccountConfig = cfg
+	t.Cleanup(func() { settings.Config().AccountConfig = prev })
+}
+
+// setupUsers 准备sqlite、redis和令牌密钥，邮件记录在返回的 sentMail 中
+func setupUsers(t *testing.T) (context.Context, *sentMail) {
+	t.Helper()
+	ctx := context.Background()
+	_, stop := redistest.Start()
+	t.Cleanup(stop)
+	if err := mysql.Init(settings.MysqlConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "test.db")}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mysql.Close() })
+	if err := mysql.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	useSecurity(t, settings.SecurityConfig{})
+	useAccount(t, settings.AccountConfig{BcryptCost: bcrypt.MinCost})
+	err := auth.Init(settings.AuthConfig{
+		ActiveKey: "k1",
+		Keys:      []settings.AuthKey{{Kid: "k1", Alg: "HS256", Secret: strings.Repeat("s", 32)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := &sentMail{}
+	mailer.Use(sent)
+	return ctx, sent
+}
+
+func registerUser(t *testing.T, ctx context.Context, username, email string) *models.User {
+	t.Helper()
+	user, err := Register(ctx, RegisterParams{Username: username, Email: email, Password: "password", IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name                      string
+		username, email, password string
+		want                      error
+	}{
+		{"ok", "Bob", " Bob@Example.com ", "password", nil},
+		{"username taken", "alice", "bob@example.com", "password", ErrUsernameTaken},
+		{"username taken in other case", "ALICE", "bob@example.com", "password", ErrUsernameTaken},
+		{"email taken", "bob", "Alice@example.com", "password", ErrEmailTaken},
+		{"invalid username", "b!", "bob@example.com", "password", ErrInvalidUsername},
+		{"email with display name", "bob", "Bob <bob@example.com>", "password", ErrInvalidEmail},
+		{"short password", "bob", "bob@example.com", "short", ErrWeakPassword},
+		{"long password", "bob", "bob@example.com", strings.Repeat("p", 73), ErrWeakPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, sent := setupUsers(t)
+			registerUser(t, ctx, "alice", "alice@example.com")
+			user, err := Register(ctx, RegisterParams{Username: tt.username, Email: tt.email, Password: tt.password, IP: "192.0.2.1"})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				if sent.count() != 1 {
+					t.Errorf("sent %d mails, want only alice's", sent.count())
+				}
+				return
+			}
+			if user.Username != "bob" || user.Email != "bob@example.com" || user.EmailVerifiedAt != nil {
+				t.Errorf("user = %+v", user)
+			}
+			if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(tt.password)) != nil {
+				t.Error("password hash does not match")
+			}
+			sent.token(t, "bob@example.com")
+		})
+	}
+}
+
+func TestRegisterCaptcha(t *testing.T) {
+	ctx, _ := setupUsers(t)
+	registerUser(t, ctx, "alice", "alice@example.com")
+	// 探测已注册的邮箱也计为注册失败，达到次数后需要验证码
+	for i := 0; i < defaultCaptchaAfter; i++ {
+		_, err := Register(ctx, RegisterParams{Username: "bob", Email: "alice@example.com", Password: "password", IP: "192.0.2.1"})
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Fatalf("attempt %d: got %v, want %v", i+1, err, ErrEmailTaken)
+		}
+	}
+	_, err := Register(ctx, RegisterParams{Username: "bob", Email: "bob@example.com", Password: "password", IP: "192.0.2.1"})
+	if !errors.Is(err, ErrCaptchaRequired) {
+		t.Fatalf("got %v, want %v", err, ErrCaptchaRequired)
+	}
+	// 其他IP不受影响
+	if _, err = Register(ctx, RegisterParams{Username: "bob", Email: "bob@example.com", Password: "password", IP: "192.0.2.2"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name          string
+		requireVerify bool
+		verified      bool
+		login, passwd string
+		want          error
+	}{
+		{"username", false, false, "alice", "password", nil},
+		{"email in other case", false, false, " Alice@Example.com", "password", nil},
+		{"wrong password", false, false, "alice", "wrong password", ErrInvalidCredentials},
+		{"unknown user", false, false, "bob", "password", ErrInvalidCredentials},
+		{"unverified email", true, false, "alice", "password", ErrEmailNotVerified},
+		{"unverified email with wrong password", true, false, "alice", "wrong password", ErrInvalidCredentials},
+		{"verified email", true, true, "alice", "password", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, sent := setupUsers(t)
+			useAccount(t, settings.AccountConfig{BcryptCost: bcrypt.MinCost, RequireVerifiedEmail: tt.requireVerify})
+			alice := registerUser(t, ctx, "alice", "alice@example.com")
+			if tt.verified {
+				if _, err := VerifyEmail(ctx, sent.token(t, "alice@example.com")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			user, pair, err := Login(ctx, LoginParams{Login: tt.login, Password: tt.passwd, IP: "192.0.2.1"})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if user.ID != alice.ID {
+				t.Errorf("logged in as %d, want %d", user.ID, alice.ID)
+			}
+			claims, err := auth.Verify(ctx, pair.AccessToken)
+			if err != nil || claims.Subject != strconv.FormatInt(alice.ID, 10) {
+				t.Errorf("access token: %+v, %v", claims, err)
+			}
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	tests := []struct {
+		name string
+		// token 准备好 alice 的验证令牌，返回要提交的令牌
+		token func(t *testing.T, ctx context.Context, sent *sentMail, alice *models.User) string
+		want  error
+	}{
+		{"valid", func(t *testing.T, _ context.Context, sent *sentMail, _ *models.User) string {
+			return sent.token(t, "alice@example.com")
+		}, nil},
+		{"used twice", func(t *testing.T, ctx context.Context, sent *sentMail, _ *models.User) string {
+			token := sent.token(t, "alice@example.com")
+			if _, err := VerifyEmail(ctx, token); err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}, ErrInvalidVerificationToken},
+		{"unknown", func(*testing.T, context.Context, *sentMail, *models.User) string {
+			return "unknown"
+		}, ErrInvalidVerificationToken},
+		{"replaced by resend", func(t *testing.T, ctx context.Context, sent *sentMail, alice *models.User) string {
+			token := sent.token(t, "alice@example.com")
+			if err := ResendVerification(ctx, alice.ID); err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}, ErrInvalidVerificationToken},
+		{"resent", func(t *testing.T, ctx context.Context, sent *sentMail, alice *models.User) string {
+			if err := ResendVerification(ctx, alice.ID); err != nil {
+				t.Fatal(err)
+			}
+			return sent.token(t, "alice@example.com")
+		}, nil},
+		{"expired", func(t *testing.T, ctx context.Context, sent *sentMail, alice *models.User) string {
+			useAccount(t, settings.AccountConfig{BcryptCost: bcrypt.MinCost, VerificationTTL: time.Millisecond})
+			if err := ResendVerification(ctx, alice.ID); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+			return sent.token(t, "alice@example.com")
+		}, ErrInvalidVerificationToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, sent := setupUsers(t)
+			alice := registerUser(t, ctx, "alice", "alice@example.com")
+			// 另一个用户的令牌不受影响
+			bob := registerUser(t, ctx, "bob", "bob@example.com")
+			user, err := VerifyEmail(ctx, tt.token(t, ctx, sent, alice))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err == nil && (user.ID != alice.ID || user.EmailVerifiedAt == nil) {
+				t.Errorf("user = %+v", user)
+			}
+			if user, err = VerifyEmail(ctx, sent.token(t, "bob@example.com")); err != nil || user.ID != bob.ID {
+				t.Errorf("bob: %+v, %v", user, err)
+			}
+		})
+	}
+}
+
+func TestResendVerification(t *testing.T) {
+	ctx, sent := setupUsers(t)
+	alice := registerUser(t, ctx, "alice", "alice@example.com")
+	if err := ResendVerification(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if sent.count() != 2 {
+		t.Fatalf("sent %d mails, want 2", sent.count())
+	}
+	if _, err := VerifyEmail(ctx, sent.token(t, "alice@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResendVerification(ctx, alice.ID); !errors.Is(err, ErrEmailAlreadyVerified) {
+		t.Errorf("after verification: got %v, want %v", err, ErrEmailAlreadyVerified)
+	}
+	if err := ResendVerification(ctx, alice.ID+100); !errors.Is(err, mysql.ErrNotFound) {
+		t.Errorf("unknown user: got %v, want %v", err, mysql.ErrNotFound)
+	}
+	if sent.count() != 2 {
+		t.Errorf("sent %d mails, want 2", sent.count())
+	}
+}
@@ -0,0 +1,227 @@
+// Package mailer 发送邮件。业务代码只依赖 Mailer 接口，本地开发和测试使用 file 驱动，
+// 邮件写入目录而不真正发出，生产环境使用 smtp 驱动
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+	"web_app/settings"
+)
+
+const (
+	defaultOutboxDir   = "outbox"
+	defaultSMTPTimeout = 30 * time.Second
+)
+
+// Message 纯文本邮件，From 为空时使用配置中的发件人
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件发送方式
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+var (
+	current atomic.Pointer[Mailer]
+	from    atomic.Value // string
+)
+
+// Init 按配置创建发送方式
+func Init(cfg settings.MailConfig) error {
+	var m Mailer
+	switch cfg.Driver {
+	case "", "file":
+		dir := cfg.OutboxDir
+		if dir == "" {
+			dir = defaultOutboxDir
+		}
+		m = &FileOutbox{Dir: dir}
+	case "smtp":
+		m = &SMTP{Addr: cfg.Host + ":" + cfg.Port, Host: cfg.Host, Username: cfg.Username, Password: cfg.Password, Timeout: cfg.Timeout}
+	default:
+		return fmt.Errorf("unsupported mail driver %q", cfg.Driver)
+	}
+	Use(m)
+	from.Store(cfg.From)
+	return nil
+}
+
+// Use 替换发送方式，测试中可以换成自己的实现
+func Use(m Mailer) {
+	current.Store(&m)
+}
+
+// Send 用当前的发送方式发送邮件，未初始化时写入默认的 outbox 目录
+func Send(ctx context.Context, msg *Message) error {
+	if msg.From == "" {
+		msg.From, _ = from.Load().(string)
+	}
+	if msg.From == "" {
+		msg.From = "noreply@localhost"
+	}
+	m := current.Load()
+	if m == nil {
+		return (&FileOutbox{Dir: defaultOutboxDir}).Send(ctx, msg)
+	}
+	return (*m).Send(ctx, msg)
+}
+
+// FileOutbox 把邮件保存为 .eml 文件，可以直接用邮件客户端打开
+type FileOutbox struct {
+	Dir string
+}
+
+// Send 文件名以时间开头，按文件名排序即为发送顺序
+func (o *FileOutbox) Send(_ context.Context, msg *Message) error {
+	raw, err := encode(msg)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(o.Dir, 0o755); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + randomID() + ".eml"
+	return os.WriteFile(filepath.Join(o.Dir, name), raw, 0o644)
+}
+
+// SMTP 通过SMTP服务器发送，Username 为空时不认证
+type SMTP struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	// Timeout 连接和整个发送过程的超时，默认30s；ctx 先结束时以 ctx 为准
+	Timeout time.Duration
+}
+
+// Send 流程与 smtp.SendMail 相同（服务器支持时升级TLS），但连接受 ctx 和 Timeout 约束，
+// 服务器无响应时不会一直阻塞调用方
+func (s *SMTP) Send(ctx context.Context, msg *Message) (err error) {
+	raw, err := encode(msg)
+	if err != nil {
+		return err
+	}
+	fromAddr, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return err
+	}
+	toAddr, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultSMTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	defer func() {
+		// 超时或取消导致的连接错误统一报告为 ctx 的错误
+		if err != nil && ctx.Err() != nil {
+			err = fmt.Errorf("mailer: smtp send: %w", ctx.Err())
+		}
+	}()
+	conn, err := (&net.Dialer{Timeout: timeout}).DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	// ctx 被取消时关闭连接，中断正在进行的读写
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("mailer: smtp server doesn't support AUTH")
+		}
+		if err = c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(fromAddr.Address); err != nil {
+		return err
+	}
+	if err = c.Rcpt(toAddr.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(raw); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// encode 生成 RFC 5322 格式的邮件，主题按需编码，正文使用 quoted-printable
+func encode(msg *Message) ([]byte, error) {
+	for _, v := range []string{msg.From, msg.To, msg.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, fmt.Errorf("mailer: header contains newline")
+		}
+	}
+	var buf bytes.Buffer
+	host := "localhost"
+	if addr, err := mail.ParseAddress(msg.From); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			host = addr.Address[i+1:]
+		}
+	}
+	fmt.Fprintf(&buf, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", randomID(), host)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,156 @@
+package mailer
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"web_app/settings"
+)
+
+// useOutbox 按 file 驱动初始化，返回邮件目录
+func useOutbox(t *testing.T, sender string) string {
+	t.Helper()
+	prev := current.Load()
+	prevFrom, _ := from.Load().(string)
+	t.Cleanup(func() {
+		current.Store(prev)
+		from.Store(prevFrom)
+	})
+	dir := filepath.Join(t.TempDir(), "outbox")
+	if err := Init(settings.MailConfig{Driver: "file", From: sender, OutboxDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// outbox 按文件名顺序读出目录中的邮件
+func outbox(t *testing.T, dir string) []*mail.Message {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) != ".eml" {
+			t.Errorf("unexpected file %s", e.Name())
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	var msgs []*mail.Message
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		msg, err := mail.ReadMessage(f)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestFileOutbox(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string // 配置中的发件人
+		msg     Message
+		wantErr bool
+		// 期望的发件人和解码后的主题、正文
+		wantFrom, subject, body string
+	}{
+		{"configured sender", "Web App <app@example.com>",
+			Message{To: "bob@example.com", Subject: "hello", Body: "line 1\nline 2\n"},
+			false, "Web App <app@example.com>", "hello", "line 1\r\nline 2\r\n"},
+		{"default sender", "",
+			Message{To: "bob@example.com", Subject: "hi", Body: "hi"},
+			false, "noreply@localhost", "hi", "hi"},
+		{"explicit sender", "app@example.com",
+			Message{From: "ops@example.com", To: "bob@example.com", Subject: "hi", Body: "hi"},
+			false, "ops@example.com", "hi", "hi"},
+		{"non-ascii subject and body", "app@example.com",
+			Message{To: "bob@example.com", Subject: "验证你的邮箱", Body: "你好，bob：" + strings.Repeat("=", 100)},
+			false, "app@example.com", "验证你的邮箱", "你好，bob：" + strings.Repeat("=", 100)},
+		{"newline in header", "app@example.com",
+			Message{To: "bob@example.com\r\nBcc: eve@example.com", Subject: "hi", Body: "hi"},
+			true, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := useOutbox(t, tt.from)
+			msg := tt.msg
+			err := Send(context.Background(), &msg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				if _, err := os.Stat(dir); !os.IsNotExist(err) {
+					t.Error("outbox written for a rejected message")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			msgs := outbox(t, dir)
+			if len(msgs) != 1 {
+				t.Fatalf("outbox has %d messages, want 1", len(msgs))
+			}
+			h := msgs[0].Header
+			if got := h.Get("From"); got != tt.wantFrom {
+				t.Errorf("From = %q, want %q", got, tt.wantFrom)
+			}
+			if got := h.Get("To"); got != msg.To {
+				t.Errorf("To = %q, want %q", got, msg.To)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(h.Get("Subject"))
+			if err != nil || subject != tt.subject {
+				t.Errorf("Subject = %q (%v), want %q", subject, err, tt.subject)
+			}
+			if h.Get("Message-ID") == "" || h.Get("Date") == "" {
+				t.Errorf("missing Message-ID or Date: %v", h)
+			}
+			body, err := io.ReadAll(quotedprintable.NewReader(msgs[0].Body))
+			if err != nil || string(body) != tt.body {
+				t.Errorf("body = %q (%v), want %q", body, err, tt.body)
+			}
+		})
+	}
+}
+
+func TestFileOutboxOrder(t *testing.T) {
+	dir := useOutbox(t, "app@example.com")
+	subjects := []string{"first", "second", "third"}
+	for _, s := range subjects {
+		if err := Send(context.Background(), &Message{To: "bob@example.com", Subject: s, Body: s}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 文件名按发送时间排序
+	msgs := outbox(t, dir)
+	if len(msgs) != len(subjects) {
+		t.Fatalf("outbox has %d messages, want %d", len(msgs), len(subjects))
+	}
+	for i, msg := range msgs {
+		if got := msg.Header.Get("Subject"); got != subjects[i] {
+			t.Errorf("message %d: Subject = %q, want %q", i, got, subjects[i])
+		}
+	}
+}
+
+func TestInitUnsupportedDriver(t *testing.T) {
+	if err := Init(settings.MailConfig{Driver: "carrier-pigeon"}); err == nil {
+		t.Fatal("want an error")
+	}
+}
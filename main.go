@@ -9,15 +9,25 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/staticlock/web_app/auth"
+	"github.com/staticlock/web_app/controllers"
 	"github.com/staticlock/web_app/dao/mysql"
 	"github.com/staticlock/web_app/dao/redis"
+	"github.com/staticlock/web_app/deps"
+	"github.com/staticlock/web_app/jobs"
 	"github.com/staticlock/web_app/logger"
+	"github.com/staticlock/web_app/mailer"
+	"github.com/staticlock/web_app/rates"
+	"github.com/staticlock/web_app/rbac"
 	"github.com/staticlock/web_app/router"
 	"github.com/staticlock/web_app/settings"
 
 	"go.uber.org/zap"
 )
 
+// defaultDrainDelay 关机时等待负载均衡摘除实例的默认时长，大于常见的就绪探针间隔
+const defaultDrainDelay = 10 * time.Second
+
 // go web开发通用脚手架
 func main() {
 	//1.加载配置
@@ -27,32 +37,63 @@ func main() {
 		fmt.Printf("初始化配置成功!\n")
 	}
 	//2.初始化日志
-	if err := logger.Init(settings.Config.LogConfig); err != nil {
+	if err := logger.Init(settings.Config().LogConfig); err != nil {
 		fmt.Printf("初始化日志失败：%v\n", err)
 	} else {
 		zap.L().Info("初始化日志成功!\n")
 	}
 	defer zap.L().Sync()
-	//3.初始化mysql
-	if err := mysql.Init(settings.Config.MysqlConfig); err != nil {
-		zap.L().Error("初始化mysql失败:", zap.Error(err))
-	} else {
-		zap.L().Info("初始化mysql成功:\n")
+	//3.连接mysql和redis，失败时按配置重试，可选依赖失败以降级模式启动
+	deps.Register(&deps.Dependency{
+		Name:     deps.MySQL,
+		Required: !settings.Config().MysqlConfig.Optional,
+		Connect:  func() error { return mysql.Init(settings.Config().MysqlConfig) },
+		Ping:     mysql.Ping,
+		Close:    mysql.Close,
+	})
+	deps.Register(&deps.Dependency{
+		Name:     deps.Redis,
+		Required: !settings.Config().RedisConfig.Optional,
+		Connect:  func() error { return redis.Init(settings.Config().RedisConfig) },
+		Ping:     redis.Ping,
+		Close:    redis.Close,
+	})
+	if err := deps.Start(settings.Config().StartupConfig); err != nil {
+		zap.L().Fatal("初始化依赖失败:", zap.Error(err))
+	}
+	defer deps.Stop()
+	//4.加载令牌签名密钥、权限数据和邮件配置，未配置密钥时认证接口返回401/503，其余接口不受影响
+	if err := auth.Init(settings.Config().AuthConfig); err != nil {
+		zap.L().Error("加载令牌密钥失败:", zap.Error(err))
 	}
-	defer mysql.DB.Close()
-	//4.初始化redis
-	if err := redis.Init(settings.Config.RedisConfig); err != nil {
-		zap.L().Error("初始化redis失败:", zap.Error(err))
+	rbac.Start()
+	defer rbac.Stop()
+	if err := mailer.Init(settings.Config().MailConfig); err != nil {
+		zap.L().Error("初始化邮件发送失败，邮件将写入默认的outbox目录:", zap.Error(err))
+	}
+	//5.启动汇率定时拉取
+	scheduler, err := rates.NewScheduler(settings.Config().RatesConfig)
+	if err != nil {
+		zap.L().Error("初始化汇率调度失败:", zap.Error(err))
 	} else {
-		zap.L().Info("初始化redis成功:\n")
+		scheduler.Start(context.Background())
+		defer scheduler.Stop()
+		jobs.Register(rates.IngestJobType, scheduler.HandleIngestJob)
+	}
+	//6.启动后台任务队列
+	if settings.Config().JobsConfig.Enabled {
+		if err := jobs.Start(settings.Config().JobsConfig); err != nil {
+			zap.L().Error("启动任务队列失败:", zap.Error(err))
+		} else {
+			defer jobs.Stop()
+		}
 	}
-	defer redis.Rdb.Close()
 
-	//5.注册路由
+	//7.注册路由
 	r := router.SetRouters()
-	//6.启动服务（优雅关机）
+	//8.启动服务（优雅关机）
 	srv := &http.Server{
-		Addr:    settings.Config.Port,
+		Addr:    settings.Config().Port,
 		Handler: r,
 	}
 	go func() {
@@ -70,6 +111,19 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM) // 此处不会阻塞
 	<-quit                                               // 阻塞在此，当接收到上述两种信号时才会往下执行
 	zap.L().Info("Shutdown Server ...")
+	// 先让就绪探针失败，等负载均衡摘除本实例后再关闭；期间再次收到信号则立即关闭
+	controllers.MarkShuttingDown()
+	drain := settings.Config().StartupConfig.DrainDelay
+	if drain == 0 {
+		drain = defaultDrainDelay
+	}
+	if drain > 0 {
+		zap.L().Info("等待负载均衡摘除实例", zap.Duration("delay", drain))
+		select {
+		case <-time.After(drain):
+		case <-quit:
+		}
+	}
 	// 创建一个5秒超时的context
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"sort"
+	"sync"
+)
+
+// DefaultLatencyBuckets 以秒为单位的默认延迟分桶
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram 累计分桶直方图，counts[i] 为小于等于 buckets[i] 的观测次数
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe 记录一次观测值
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets); i++ {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+type histogramSnapshot struct {
+	Buckets map[string]uint64 `json:"buckets"`
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"`
+}
+
+func (h *Histogram) snapshot() histogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := histogramSnapshot{Buckets: make(map[string]uint64, len(h.buckets)), Count: h.count, Sum: h.sum}
+	for i, b := range h.buckets {
+		raw, _ := json.Marshal(b)
+		s.Buckets[string(raw)] = h.counts[i]
+	}
+	return s
+}
+
+// HistogramVec 按标签区分的一组直方图，例如按查询名统计延迟
+type HistogramVec struct {
+	mu      sync.RWMutex
+	buckets []float64
+	m       map[string]*Histogram
+}
+
+// NewHistogramVec 创建并以 name 注册一组直方图，buckets 必须升序
+func NewHistogramVec(name string, buckets []float64) *HistogramVec {
+	v := &HistogramVec{buckets: buckets, m: make(map[string]*Histogram)}
+	expvar.Publish(name, v)
+	return v
+}
+
+// With 返回标签对应的直方图，不存在时创建
+func (v *HistogramVec) With(label string) *Histogram {
+	v.mu.RLock()
+	h, ok := v.m[label]
+	v.mu.RUnlock()
+	if ok {
+		return h
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if h, ok = v.m[label]; !ok {
+		h = newHistogram(v.buckets)
+		v.m[label] = h
+	}
+	return h
+}
+
+// String 实现 expvar.Var
+func (v *HistogramVec) String() string {
+	v.mu.RLock()
+	out := make(map[string]histogramSnapshot, len(v.m))
+	for label, h := range v.m {
+		out[label] = h.snapshot()
+	}
+	v.mu.RUnlock()
+	raw, _ := json.Marshal(out)
+	return string(raw)
+}
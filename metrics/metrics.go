@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// Publish 注册一个在每次抓取时计算的指标，name 重复注册会panic
+func Publish(name string, f func() interface{}) {
+	expvar.Publish(name, expvar.Func(f))
+}
+
+// Handler 以JSON格式输出所有已注册的指标
+func Handler() http.Handler {
+	return expvar.Handler()
+}
+
+// NewCounterMap 创建并以 name 注册一组按key累加的计数器
+func NewCounterMap(name string) *expvar.Map {
+	return expvar.NewMap(name)
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminTokenHeader 管理接口令牌请求头
+const AdminTokenHeader = "X-Admin-Token"
+
+// AdminOnly 只允许携带正确管理令牌的请求通过，未配置令牌时拒绝所有请求
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expected := settings.Config().AdminToken
+		got := c.GetHeader(AdminTokenHeader)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(got), []byte(expected)) != 1 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"web_app/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextClaims 认证中间件写入的令牌声明，类型为 *auth.Claims
+const ContextClaims = "claims"
+
+// Auth 校验 Authorization: Bearer 访问令牌，通过后把声明和用户ID写入上下文，
+// 同时放入请求的 context，logic 层通过 auth.FromContext 读取
+func Auth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer`)
+			abortAuth(c, http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		claims, err := auth.Verify(c.Request.Context(), raw)
+		if err != nil {
+			desc := "invalid token"
+			if errors.Is(err, auth.ErrTokenRevoked) {
+				desc = "token revoked"
+			}
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token", error_description="`+desc+`"`)
+			abortAuth(c, http.StatusUnauthorized, gin.H{"error": desc})
+			return
+		}
+		c.Set(ContextClaims, claims)
+		c.Set(ContextUserID, claims.Subject)
+		c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), claims))
+		if !limitDeferred(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
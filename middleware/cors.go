@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"web_app/settings"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// defaultCORSPolicy 配置中没有 cors 段时使用的策略，与前端开发服务器配合
+var defaultCORSPolicy = settings.CORSPolicy{
+	AllowOrigins:     []string{"http://localhost:5173"},
+	AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+	AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", IdempotencyKeyHeader},
+	ExposeHeaders:    []string{"Content-Length"},
+	AllowCredentials: boolPtr(true),
+	MaxAge:           12 * time.Hour,
+}
+
+// corsTable 编译好的策略，配置热加载时整体替换
+type corsTable struct {
+	def    *corsPolicy
+	groups []corsGroup // 按前缀长度降序
+}
+
+type corsGroup struct {
+	prefix string
+	policy *corsPolicy
+}
+
+// corsPolicy 一个编译好的策略，match 和 credentials 同时供会话的来源校验使用
+type corsPolicy struct {
+	handler     gin.HandlerFunc
+	match       func(origin string) bool
+	credentials bool
+}
+
+var corsPolicies atomic.Pointer[corsTable]
+
+// CORS 跨域中间件，策略来自配置的 cors 段，修改配置文件后立即生效。
+// 按请求路径选择路由组策略，必须注册在engine上：没有对应路由的预检请求不会经过路由组的中间件
+func CORS() gin.HandlerFunc {
+	reloadCORS()
+	settings.OnChange(reloadCORS)
+	return func(c *gin.Context) {
+		corsPolicies.Load().policyFor(c.Request.URL.Path).handler(c)
+	}
+}
+
+func (t *corsTable) policyFor(path string) *corsPolicy {
+	for _, g := range t.groups {
+		if path == g.prefix || strings.HasPrefix(path, g.prefix+"/") {
+			return g.policy
+		}
+	}
+	return t.def
+}
+
+// corsAllowsCredentials 路径的跨域策略是否允许 origin 携带cookie访问，CORS 未注册时返回 false
+func corsAllowsCredentials(path, origin string) bool {
+	t := corsPolicies.Load()
+	if t == nil {
+		return false
+	}
+	p := t.policyFor(path)
+	return p.credentials && p.match(origin)
+}
+
+func reloadCORS() {
+	cfg := settings.Config().CORSConfig
+	base := mergeCORS(defaultCORSPolicy, cfg.CORSPolicy)
+	t := &corsTable{def: newCORSPolicy("default", base)}
+	for prefix, p := range cfg.Groups {
+		prefix = "/" + strings.Trim(prefix, "/")
+		t.groups = append(t.groups, corsGroup{prefix: prefix, policy: newCORSPolicy(prefix, mergeCORS(base, p))})
+	}
+	sort.Slice(t.groups, func(i, j int) bool { return len(t.groups[i].prefix) > len(t.groups[j].prefix) })
+	corsPolicies.Store(t)
+}
+
+// mergeCORS 用 override 中配置了的字段覆盖 base
+func mergeCORS(base, override settings.CORSPolicy) settings.CORSPolicy {
+	if len(override.AllowOrigins) > 0 {
+		base.AllowOrigins = override.AllowOrigins
+	}
+	if len(override.AllowMethods) > 0 {
+		base.AllowMethods = override.AllowMethods
+	}
+	if len(override.AllowHeaders) > 0 {
+		base.AllowHeaders = override.AllowHeaders
+	}
+	if len(override.ExposeHeaders) > 0 {
+		base.ExposeHeaders = override.ExposeHeaders
+	}
+	if override.AllowCredentials != nil {
+		base.AllowCredentials = override.AllowCredentials
+	}
+	if override.MaxAge > 0 {
+		base.MaxAge = override.MaxAge
+	}
+	return base
+}
+
+// newCORSPolicy 来源统一由 AllowOriginFunc 判断，gin-contrib/cors 遇到非法配置会panic，
+// 这里跳过无法解析的来源并记录日志，热加载时写错配置不会拖垮服务
+func newCORSPolicy(name string, p settings.CORSPolicy) *corsPolicy {
+	match := compileOrigins(name, p.AllowOrigins)
+	credentials := p.AllowCredentials != nil && *p.AllowCredentials
+	if credentials && slices.Contains(p.AllowOrigins, "*") {
+		// 允许所有来源时 AllowOriginFunc 会原样回显请求的 Origin，加上凭据等于任何网站都能带着用户的cookie读取响应
+		zap.L().Error("CORS策略允许所有来源，不能同时允许携带凭据，已关闭 allow_credentials", zap.String("policy", name))
+		credentials = false
+	}
+	return &corsPolicy{
+		handler: cors.New(cors.Config{
+			AllowOriginFunc:  match,
+			AllowMethods:     p.AllowMethods,
+			AllowHeaders:     p.AllowHeaders,
+			ExposeHeaders:    p.ExposeHeaders,
+			AllowCredentials: credentials,
+			MaxAge:           p.MaxAge,
+		}),
+		match:       match,
+		credentials: credentials,
+	}
+}
+
+// compileOrigins 把来源列表编译为匹配函数：* 允许所有来源，/.../ 为正则，含 * 的为通配，其余精确匹配（忽略大小写）
+func compileOrigins(name string, origins []string) func(string) bool {
+	exact := make(map[string]bool)
+	var patterns []*regexp.Regexp
+	for _, o := range origins {
+		switch {
+		case o == "*":
+			return func(string) bool { return true }
+		case len(o) > 2 && strings.HasPrefix(o, "/") && strings.HasSuffix(o, "/"):
+			re, err := regexp.Compile("(?i)^(?:" + o[1:len(o)-1] + ")$")
+			if err != nil {
+				zap.L().Error("CORS来源正则无效，已忽略", zap.String("policy", name), zap.String("origin", o), zap.Error(err))
+				continue
+			}
+			patterns = append(patterns, re)
+		case strings.Contains(o, "*"):
+			// 通配符只匹配一段主机名标签或端口，https://*.example.com 不匹配 https://a.b.example.com
+			expr := strings.ReplaceAll(regexp.QuoteMeta(strings.ToLower(o)), `\*`, `[a-z0-9-]+`)
+			patterns = append(patterns, regexp.MustCompile("^"+expr+"$"))
+		default:
+			exact[strings.ToLower(o)] = true
+		}
+	}
+	return func(origin string) bool {
+		origin = strings.ToLower(origin)
+		if exact[origin] {
+			return true
+		}
+		for _, re := range patterns {
+			if re.MatchString(origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
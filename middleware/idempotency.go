@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+	"web_app/dao/redis"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// IdempotencyKeyHeader 客户端为每个逻辑请求生成的唯一键，超时重试时原样带上
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader 响应来自保存的结果时返回 true
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// 处理中占位的最长时间，超过后视为处理者已崩溃，键可以重新使用
+	idempotencyProcessingTTL = time.Minute
+	maxIdempotencyKeyLen     = 255
+)
+
+// 回放时不覆盖的响应头，这些头由前面的中间件按本次请求重新设置
+var idempotencySkipHeaders = map[string]bool{
+	"Ratelimit-Limit":     true,
+	"Ratelimit-Remaining": true,
+	"Ratelimit-Reset":     true,
+	"X-Request-Id":        true,
+}
+
+// Idempotency 按 Idempotency-Key 请求头保证POST请求只执行一次，最终响应在redis中保留 retention 时长。
+// 相同键的重放返回保存的响应；上一个请求仍在处理时返回409；同一个键用于不同请求时返回422。
+// 5xx响应和panic不保存，客户端可以用同一个键重试。没有携带该请求头或redis不可用时照常执行
+func Idempotency(retention time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idemKey := c.GetHeader(IdempotencyKeyHeader)
+		if idemKey == "" {
+			c.Next()
+			return
+		}
+		if len(idemKey) > maxIdempotencyKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key too long"})
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "read body failed"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := "idem:" + idempotencyScope(c) + ":" + idemKey
+		fingerprint := requestFingerprint(c.Request, body)
+		ctx := c.Request.Context()
+		existing, marker, err := redis.IdempotentBegin(ctx, key, fingerprint, idempotencyProcessingTTL)
+		if err != nil {
+			zap.L().Warn("幂等键检查失败，直接执行请求", zap.String("key", key), zap.Error(err))
+			c.Next()
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key reused with a different request"})
+			case !existing.Done:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is in progress"})
+			default:
+				replay(c, existing)
+			}
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			// 请求上下文可能已取消，释放占位使用独立的context
+			if err := redis.IdempotentRelease(context.Background(), key, marker); err != nil {
+				zap.L().Warn("释放幂等键失败", zap.String("key", key), zap.Error(err))
+			}
+		}()
+		c.Next()
+		if rec.Status() >= http.StatusInternalServerError {
+			return
+		}
+		resp := &redis.IdempotentResponse{
+			Fingerprint: fingerprint,
+			Status:      rec.Status(),
+			Header:      rec.Header().Clone(),
+			Body:        rec.body.Bytes(),
+		}
+		if err := redis.IdempotentComplete(context.Background(), key, resp, retention); err != nil {
+			zap.L().Error("保存幂等响应失败", zap.String("key", key), zap.Error(err))
+			return
+		}
+		completed = true
+	}
+}
+
+// idempotencyScope 幂等键的作用范围，避免不同调用方的键互相冲突；
+// 匿名请求不按IP区分，移动网络重试时IP可能变化
+func idempotencyScope(c *gin.Context) string {
+	if id := c.GetString(ContextUserID); id != "" {
+		return "user:" + id
+	}
+	if k := c.GetHeader(APIKeyHeader); k != "" {
+		return "key:" + k
+	}
+	return "anon"
+}
+
+// requestFingerprint 方法、路径、查询参数和请求体的摘要
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+"\n"+r.URL.Path+"\n"+r.URL.RawQuery+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(c *gin.Context, resp *redis.IdempotentResponse) {
+	for k, v := range resp.Header {
+		if idempotencySkipHeaders[k] {
+			continue
+		}
+		c.Writer.Header()[k] = v
+	}
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Data(resp.Status, resp.Header.Get("Content-Type"), resp.Body)
+	c.Abort()
+}
+
+// responseRecorder 在写给客户端的同时保存响应体
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
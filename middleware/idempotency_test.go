@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"web_app/dao/redis/redistest"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testRetention = time.Hour
+
+func TestIdempotency(t *testing.T) {
+	type request struct {
+		advance  time.Duration // 请求前时钟前进
+		key      string
+		body     string
+		status   int
+		replayed bool
+	}
+	created := func(c *gin.Context, calls int) { c.String(http.StatusCreated, "call %d", calls) }
+	tests := []struct {
+		name string
+		// handle 第 calls 次执行处理函数时的行为
+		handle    func(c *gin.Context, calls int)
+		requests  []request
+		wantCalls int
+	}{
+		{"replay returns the saved response", created, []request{
+			{key: "k1", body: `{"a":1}`, status: http.StatusCreated},
+			{key: "k1", body: `{"a":1}`, status: http.StatusCreated, replayed: true},
+			{key: "k1", body: `{"a":1}`, status: http.StatusCreated, replayed: true},
+		}, 1},
+		{"same key with another body", created, []request{
+			{key: "k1", body: `{"a":1}`, status: http.StatusCreated},
+			{key: "k1", body: `{"a":2}`, status: http.StatusUnprocessableEntity},
+		}, 1},
+		{"different keys", created, []request{
+			{key: "k1", body: `{"a":1}`, status: http.StatusCreated},
+			{key: "k2", body: `{"a":1}`, status: http.StatusCreated},
+		}, 2},
+		{"without header", created, []request{
+			{body: `{"a":1}`, status: http.StatusCreated},
+			{body: `{"a":1}`, status: http.StatusCreated},
+		}, 2},
+		{"key too long", created, []request{
+			{key: strings.Repeat("k", maxIdempotencyKeyLen+1), status: http.StatusBadRequest},
+		}, 0},
+		{"client errors are saved", func(c *gin.Context, calls int) { c.String(http.StatusBadRequest, "bad") }, []request{
+			{key: "k1", status: http.StatusBadRequest},
+			{key: "k1", status: http.StatusBadRequest, replayed: true},
+		}, 1},
+		{"server errors are not saved", func(c *gin.Context, calls int) {
+			if calls == 1 {
+				c.String(http.StatusServiceUnavailable, "down")
+				return
+			}
+			created(c, calls)
+		}, []request{
+			{key: "k1", status: http.StatusServiceUnavailable},
+			{key: "k1", status: http.StatusCreated},
+			{key: "k1", status: http.StatusCreated, replayed: true},
+		}, 2},
+		{"panic releases the key", func(c *gin.Context, calls int) {
+			if calls == 1 {
+				panic("boom")
+			}
+			created(c, calls)
+		}, []request{
+			{key: "k1", status: http.StatusInternalServerError},
+			{key: "k1", status: http.StatusCreated},
+		}, 2},
+		{"saved response expires after retention", created, []request{
+			{key: "k1", status: http.StatusCreated},
+			{advance: testRetention + time.Second, key: "k1", status: http.StatusCreated},
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, stop := redistest.Start()
+			defer stop()
+			calls := 0
+			r := gin.New()
+			r.Use(gin.CustomRecovery(func(c *gin.Context, _ interface{}) { c.AbortWithStatus(http.StatusInternalServerError) }))
+			r.POST("/orders", Idempotency(testRetention), func(c *gin.Context) {
+				calls++
+				tt.handle(c, calls)
+			})
+			var first string
+			for i, req := range tt.requests {
+				store.FastForward(req.advance)
+				w := postOrder(r, req.key, req.body)
+				if w.Code != req.status {
+					t.Fatalf("request %d: status = %d, want %d", i, w.Code, req.status)
+				}
+				if got := w.Header().Get(IdempotentReplayedHeader) == "true"; got != req.replayed {
+					t.Errorf("request %d: replayed = %v, want %v", i, got, req.replayed)
+				}
+				if req.replayed && w.Body.String() != first {
+					t.Errorf("request %d: replayed body = %q, want %q", i, w.Body.String(), first)
+				}
+				if !req.replayed {
+					first = w.Body.String()
+				}
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler ran %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// TestIdempotencyInProgress 第一个请求处理期间使用同一个键的请求返回409
+func TestIdempotencyInProgress(t *testing.T) {
+	_, stop := redistest.Start()
+	defer stop()
+	entered, release := make(chan struct{}), make(chan struct{})
+	r := gin.New()
+	r.POST("/orders", Idempotency(testRetention), func(c *gin.Context) {
+		close(entered)
+		<-release
+		c.String(http.StatusCreated, "done")
+	})
+	done := make(chan int)
+	go func() { done <- postOrder(r, "k1", "").Code }()
+	<-entered
+	if w := postOrder(r, "k1", ""); w.Code != http.StatusConflict {
+		t.Errorf("concurrent request: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	close(release)
+	if code := <-done; code != http.StatusCreated {
+		t.Errorf("first request: status = %d, want %d", code, http.StatusCreated)
+	}
+	if w := postOrder(r, "k1", ""); w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("retry after completion: status = %d, replayed = %q", w.Code, w.Header().Get(IdempotentReplayedHeader))
+	}
+}
+
+func postOrder(r http.Handler, key, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"web_app/dao/redis"
+	"web_app/models"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// ContextUserID 认证中间件写入的用户ID，按用户限流时使用
+	ContextUserID = "user_id"
+	// APIKeyHeader API Key 的公开标识所在的请求头
+	APIKeyHeader = "X-API-Key"
+	// contextDeferredLimits 按用户或API Key限流、但执行时还没有认证的路由组，类型为 []string
+	contextDeferredLimits = "rate_limit_deferred"
+)
+
+// RateLimit 按路由组的策略限流，策略在每次请求时读取，配置热加载后立即生效。
+// redis 不可用时退化为进程内令牌桶，多实例下总配额会相应放大。
+//
+// 路由组的中间件在认证之前执行，此时还不知道用户和API Key。key_by 为 user 或 api_key 时先推迟，
+// 由认证中间件在校验通过后按身份计数；没有经过认证的请求由 RateLimitFallback 在处理函数之前按IP计数
+func RateLimit(group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy, ok := policyFor(group)
+		if !ok {
+			c.Next()
+			return
+		}
+		key := identityKey(c, policy.KeyBy)
+		if key == "" && (policy.KeyBy == "user" || policy.KeyBy == "api_key") {
+			deferred, _ := c.Get(contextDeferredLimits)
+			groups, _ := deferred.([]string)
+			c.Set(contextDeferredLimits, append(groups, group))
+			c.Next()
+			return
+		}
+		if key == "" {
+			key = "ip:" + c.ClientIP()
+		}
+		if !limit(c, group+":"+key, policy) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimitFallback 放在每个路由的处理函数之前，推迟的限流到这里仍未执行说明请求没有经过认证，按IP计数
+func RateLimitFallback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !limitDeferred(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// limitDeferred 执行推迟的限流，认证中间件在写入身份后调用；超出配额时中止请求并返回 false
+func limitDeferred(c *gin.Context) bool {
+	deferred, ok := c.Get(contextDeferredLimits)
+	if !ok {
+		return true
+	}
+	c.Set(contextDeferredLimits, nil)
+	groups, _ := deferred.([]string)
+	for _, group := range groups {
+		policy, ok := policyFor(group)
+		if !ok {
+			continue
+		}
+		key := identityKey(c, policy.KeyBy)
+		if key == "" {
+			key = "ip:" + c.ClientIP()
+		}
+		if !limit(c, group+":"+key, policy) {
+			return false
+		}
+	}
+	return true
+}
+
+// abortAuth 认证失败时拒绝请求。推迟的限流先按IP执行，认证失败的请求同样计入配额，
+// 否则用无效凭据反复请求就能绕过限流；超出配额时返回429
+func abortAuth(c *gin.Context, status int, body interface{}) {
+	if limitDeferred(c) {
+		c.AbortWithStatusJSON(status, body)
+	}
+}
+
+// policyFor 路由组的限流策略，未开启限流或策略无效时返回 false
+func policyFor(group string) (settings.RateLimitPolicy, bool) {
+	cfg := settings.Config().RateLimitConfig
+	policy, ok := cfg.Policies[group]
+	if !ok {
+		policy, ok = cfg.Policies["default"]
+	}
+	return policy, cfg.Enabled && ok && policy.Limit > 0 && policy.Window > 0
+}
+
+// limit 按策略计数并写入 RateLimit-* 响应头，超出配额时中止请求并返回 false
+func limit(c *gin.Context, key string, policy settings.RateLimitPolicy) bool {
+	var res *redis.LimitResult
+	var err error
+	if policy.Algorithm == "token_bucket" {
+		res, err = redis.TokenBucket(c.Request.Context(), key, policy.Limit, policy.Window)
+	} else {
+		res, err = redis.SlidingWindow(c.Request.Context(), key, policy.Limit, policy.Window)
+	}
+	if err != nil {
+		zap.L().Warn("redis限流失败，使用本地限流", zap.String("key", key), zap.Error(err))
+		res = localLimiter.take(key, policy.Limit, policy.Window)
+	}
+	c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	if !res.Allowed {
+		c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+		return false
+	}
+	return true
+}
+
+// identityKey 按用户或校验通过的API Key限流时的维度，尚未认证时返回空字符串。
+// 只认可认证中间件写入的身份，未经校验的请求头可以随意伪造，不能作为限流维度
+func identityKey(c *gin.Context, keyBy string) string {
+	switch keyBy {
+	case "user":
+		if id := c.GetString(ContextUserID); id != "" {
+			return "user:" + id
+		}
+	case "api_key":
+		if v, ok := c.Get(ContextAPIKey); ok {
+			if key, ok := v.(*models.APIKey); ok {
+				return "key:" + key.KeyID
+			}
+		}
+	}
+	return ""
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// localLimiter redis不可用时的进程内令牌桶
+var localLimiter = &memoryLimiter{buckets: make(map[string]*bucket)}
+
+type bucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+type memoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func (m *memoryLimiter) take(key string, capacity int, period time.Duration) *redis.LimitResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	rate := float64(capacity) / float64(period) // 每纳秒补充的令牌数
+	m.sweep(now, period)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(capacity), ts: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(capacity), b.tokens+float64(now.Sub(b.ts))*rate)
+	b.ts = now
+	res := &redis.LimitResult{Limit: capacity}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((float64(capacity) - b.tokens) / rate)
+	return res
+}
+
+// sweep 每分钟清理一次已经补满的桶，避免key无限增长
+func (m *memoryLimiter) sweep(now time.Time, period time.Duration) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for k, b := range m.buckets {
+		if now.Sub(b.ts) > period {
+			delete(m.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"web_app/dao/redis"
+	"web_app/dao/redis/redistest"
+	"web_app/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// useRateLimit 在测试期间使用给定的限流策略
+func useRateLimit(t *testing.T, policies map[string]settings.RateLimitPolicy) {
+	t.Helper()
+	prev := settings.Config().RateLimitConfig
+	settings.Config().RateLimitConfig = settings.RateLimitConfig{Enabled: true, Policies: policies}
+	t.Cleanup(func() { settings.Config().RateLimitConfig = prev })
+}
+
+func TestRateLimit(t *testing.T) {
+	type step struct {
+		advance    time.Duration // 请求前时钟前进
+		ip         string
+		status     int
+		remaining  string
+		retryAfter string
+	}
+	tests := []struct {
+		name   string
+		policy settings.RateLimitPolicy
+		steps  []step
+	}{
+		{
+			name:   "sliding window",
+			policy: settings.RateLimitPolicy{Limit: 2, Window: time.Minute},
+			steps: []step{
+				{ip: "192.0.2.1", status: http.StatusOK, remaining: "1"},
+				{advance: 30 * time.Second, ip: "192.0.2.1", status: http.StatusOK, remaining: "0"},
+				{ip: "192.0.2.1", status: http.StatusTooManyRequests, remaining: "0", retryAfter: "30"},
+				{ip: "192.0.2.2", status: http.StatusOK, remaining: "1"},
+				// 第一次请求滑出窗口，腾出一个名额
+				{advance: 30 * time.Second, ip: "192.0.2.1", status: http.StatusOK, remaining: "0"},
+				{ip: "192.0.2.1", status: http.StatusTooManyRequests, remaining: "0", retryAfter: "30"},
+			},
+		},
+		{
+			name:   "token bucket",
+			policy: settings.RateLimitPolicy{Algorithm: "token_bucket", Limit: 2, Window: 10 * time.Second},
+			steps: []step{
+				{ip: "192.0.2.1", status: http.StatusOK, remaining: "1"},
+				{ip: "192.0.2.1", status: http.StatusOK, remaining: "0"},
+				{ip: "192.0.2.1", status: http.StatusTooManyRequests, remaining: "0", retryAfter: "5"},
+				// 每5秒补充一个令牌
+				{advance: 5 * time.Second, ip: "192.0.2.1", status: http.StatusOK, remaining: "0"},
+				{advance: 10 * time.Second, ip: "192.0.2.1", status: http.StatusOK, remaining: "1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, stop := redistest.Start()
+			defer stop()
+			useRateLimit(t, map[string]settings.RateLimitPolicy{"test": tt.policy})
+			r := gin.New()
+			r.GET("/", RateLimit("test"), func(c *gin.Context) { c.Status(http.StatusOK) })
+			for i, s := range tt.steps {
+				store.FastForward(s.advance)
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = s.ip + ":1234"
+				r.ServeHTTP(w, req)
+				if w.Code != s.status {
+					t.Fatalf("step %d: status = %d, want %d", i, w.Code, s.status)
+				}
+				if got := w.Header().Get("RateLimit-Remaining"); got != s.remaining {
+					t.Errorf("step %d: RateLimit-Remaining = %s, want %s", i, got, s.remaining)
+				}
+				if got := w.Header().Get("Retry-After"); got != s.retryAfter {
+					t.Errorf("step %d: Retry-After = %q, want %q", i, got, s.retryAfter)
+				}
+			}
+		})
+	}
+}
+
+// TestRateLimitDeferred 按用户限流的路由组，未认证的请求在 RateLimitFallback 按IP计数
+func TestRateLimitDeferred(t *testing.T) {
+	_, stop := redistest.Start()
+	defer stop()
+	useRateLimit(t, map[string]settings.RateLimitPolicy{"test": {Limit: 1, Window: time.Minute, KeyBy: "user"}})
+	r := gin.New()
+	authenticated := func(c *gin.Context) {
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			c.Set(ContextUserID, user)
+			if !limitDeferred(c) {
+				return
+			}
+		}
+		c.Next()
+	}
+	r.GET("/", RateLimit("test"), authenticated, RateLimitFallback(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	tests := []struct {
+		user   string
+		status int
+	}{
+		{"1", http.StatusOK},
+		{"1", http.StatusTooManyRequests},
+		{"2", http.StatusOK},
+		{"", http.StatusOK},
+		{"", http.StatusTooManyRequests},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Test-User", tt.user)
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("request %d (user %q): status = %d, want %d", i, tt.user, w.Code, tt.status)
+		}
+	}
+}
+
+// TestRateLimitWithoutRedis redis 不可用时退化为进程内令牌桶
+func TestRateLimitWithoutRedis(t *testing.T) {
+	restore := redis.Use(nil)
+	defer restore()
+	useRateLimit(t, map[string]settings.RateLimitPolicy{"test": {Limit: 1, Window: time.Hour}})
+	r := gin.New()
+	r.GET("/", RateLimit("test"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "198.51.100.7:1234"
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("request %d: status = %d, want %d", i, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"web_app/apikey"
+	"web_app/models"
+	"web_app/rbac"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Require 要求当前用户拥有权限，需要注册在 Auth 或 Authenticate 之后；拒绝原因写入日志，
+// 完整的判断过程可以通过 /api/v1/rbac/explain 查询。API Key 请求按Key的权限范围判断
+func Require(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v, ok := c.Get(ContextAPIKey); ok {
+			key := v.(*models.APIKey)
+			if !apikey.Allows(key, permission) {
+				zap.L().Info("API Key权限不足", zap.String("key_id", key.KeyID), zap.String("permission", permission))
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden", "permission": permission})
+				return
+			}
+			c.Next()
+			return
+		}
+		subject := c.GetString(ContextUserID)
+		if subject == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		d := rbac.Check(subject, permission)
+		if !d.Allowed {
+			zap.L().Info("权限不足", zap.String("subject", subject),
+				zap.String("permission", permission), zap.String("reason", d.Reason))
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden", "permission": permission})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"web_app/session"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ContextSession 会话中间件写入的会话，类型为 *models.Session
+const ContextSession = "session"
+
+// Session 校验会话cookie，通过后把会话和用户ID写入上下文，同时放入请求的 context，
+// logic 层通过 session.FromContext 读取。会话无效时清除浏览器中的cookie；
+// 非安全方法的跨站请求直接拒绝，见 sameOrigin
+func Session() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !sameOrigin(c) {
+			abortAuth(c, http.StatusForbidden, gin.H{"error": "cross-site request rejected"})
+			return
+		}
+		value, err := c.Cookie(session.CookieName())
+		if err != nil || value == "" {
+			abortAuth(c, http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		s, err := session.Load(c.Request.Context(), value, c.ClientIP())
+		if errors.Is(err, session.ErrInvalidSession) {
+			http.SetCookie(c.Writer, session.Cookie(""))
+			abortAuth(c, http.StatusUnauthorized, gin.H{"error": "session expired"})
+			return
+		}
+		if err != nil {
+			zap.L().Error("查询会话失败", zap.Error(err))
+			abortAuth(c, http.StatusServiceUnavailable, gin.H{"error": "session store unavailable"})
+			return
+		}
+		c.Set(ContextSession, s)
+		c.Set(ContextUserID, s.UserID)
+		c.Request = c.Request.WithContext(session.NewContext(c.Request.Context(), s))
+		if !limitDeferred(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// SameOrigin 拒绝跨站的非安全方法请求，用于不经过 Session 但会写入会话cookie的接口（如会话登录），
+// 防止攻击者让受害者的浏览器登录到攻击者的账号
+func SameOrigin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !sameOrigin(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "cross-site request rejected"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// sameOrigin 非安全方法的请求必须来自本站，或来自 CORS 策略允许携带cookie的来源。
+// 浏览器跨站发起的非安全请求总会带 Origin（旧浏览器至少带 Referer），两者都没有的是非浏览器客户端，
+// 不存在冒用cookie的问题，直接放行。SameSite=none 时cookie会随跨站请求发送，只能依靠这里的检查
+func sameOrigin(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	origin := c.GetHeader("Origin")
+	if origin == "" {
+		ref := c.GetHeader("Referer")
+		if ref == "" {
+			return true
+		}
+		u, err := url.Parse(ref)
+		if err != nil {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		// 包括沙箱 iframe、file:// 等发出的 Origin: null
+		return false
+	}
+	if strings.EqualFold(u.Host, c.Request.Host) {
+		return true
+	}
+	return corsAllowsCredentials(c.Request.URL.Path, origin)
+}
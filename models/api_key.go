@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// APIKey 供服务端调用方使用的API Key，对应表 api_keys。
+// 只保存签名密钥的哈希，密钥明文只在签发时返回一次
+type APIKey struct {
+	ID         int64  `db:"id" json:"id"`
+	KeyID      string `db:"key_id" json:"key_id"` // 公开的标识，请求时放在 X-API-Key 请求头
+	Name       string `db:"name" json:"name"`
+	SecretHash string `db:"secret_hash" json:"-"`
+	// Scopes 允许的权限，写法与角色权限相同，例如 exchange_rates:create、articles:*
+	Scopes StringList `db:"scopes" json:"scopes"`
+	// 每个Key独立的限流，RateWindow 单位为秒，RateLimit 为0表示不限流
+	RateLimit  int        `db:"rate_limit" json:"rate_limit"`
+	RateWindow int        `db:"rate_window" json:"rate_window"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ExchangeRate 汇率记录，对应表 exchange_rates
+type ExchangeRate struct {
+	ID          int64     `db:"id" json:"id"`
+	Base        string    `db:"base" json:"base"`
+	Quote       string    `db:"quote" json:"quote"`
+	Rate        float64   `db:"rate" json:"rate"`
+	Source      string    `db:"source" json:"source"`
+	EffectiveAt time.Time `db:"effective_at" json:"effective_at"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// Pair 返回货币对标识，例如 USD/CNY
+func (r *ExchangeRate) Pair() string {
+	return r.Base + "/" + r.Quote
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// UserTOTP 用户的TOTP两步验证，对应表 user_totp。Secret 为加密后的密钥，
+// EnabledAt 为空表示已发起绑定、等待用户用认证器App的验证码确认
+type UserTOTP struct {
+	UserID    int64      `db:"user_id" json:"user_id"`
+	Secret    string     `db:"secret" json:"-"`
+	EnabledAt *time.Time `db:"enabled_at" json:"enabled_at"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
+
+// TOTPStatus 用户两步验证的状态
+type TOTPStatus struct {
+	Enabled           bool       `json:"enabled"`
+	Pending           bool       `json:"pending"` // 已发起绑定、尚未确认
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Role 角色，对应表 roles，Permissions 为角色拥有的权限名称
+type Role struct {
+	ID          int64     `db:"id" json:"id"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	Permissions []string  `db:"-" json:"permissions"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// Permission 权限，对应表 permissions。名称形如 articles:delete，
+// 以 :* 结尾的权限包含该前缀下的所有权限，* 包含所有权限
+type Permission struct {
+	ID          int64     `db:"id" json:"id"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// RoleBinding 主体与角色的绑定，对应表 role_bindings
+type RoleBinding struct {
+	Subject   string    `db:"subject" json:"subject"`
+	Role      string    `db:"role" json:"role"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session 浏览器登录会话，保存在redis中。ID 是cookie中会话ID的哈希，
+// 可以展示给用户用于吊销，拿到它也无法冒充会话
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	IP         string    `json:"ip"` // 最近一次访问的IP
+	UserAgent  string    `json:"user_agent"`
+	Device     string    `json:"device"` // 由 User-Agent 得出的简短描述，例如 Chrome on Windows
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`        // 绝对过期时间，闲置超时可能更早
+	Current    bool      `json:"current,omitempty"` // 是否为发起请求的会话，只在列表中设置
+}
@@ -0,0 +1,34 @@
+package openapi
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed ui/index.html
+var uiFS embed.FS
+
+var uiTemplate = template.Must(template.ParseFS(uiFS, "ui/index.html"))
+
+// Handler 返回文档JSON，文档在启动时生成一次
+func Handler(doc *Document) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+// UIHandler 文档页面，页面本身嵌入在二进制中，Swagger UI 的脚本和样式从CDN加载
+func UIHandler(title, specURL string) gin.HandlerFunc {
+	var buf bytes.Buffer
+	if err := uiTemplate.Execute(&buf, map[string]string{"Title": title, "SpecURL": specURL}); err != nil {
+		panic(err)
+	}
+	page := buf.Bytes()
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+	}
+}
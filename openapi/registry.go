@@ -0,0 +1,255 @@
+// Package openapi 声明式路由表：路由连同请求、响应结构体等元数据一起声明，
+// Mount 按声明注册到gin，Build 按同一份声明生成 OpenAPI 3 文档，文档不会与实际路由脱节
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Route 一条路由的声明
+type Route struct {
+	Method  string
+	Path    string // gin 路径，如 /articles/:id
+	Handler gin.HandlerFunc
+	// 只作用于这条路由的中间件，在分组中间件之后执行
+	Middleware []gin.HandlerFunc
+
+	Summary     string
+	Description string
+	Tags        []string
+	// Request 请求结构体的零值，按 uri、header、form、json、xml、yaml 标签生成参数和请求体，
+	// binding 标签中的 required、min、max、len、oneof 等规则转换为约束
+	Request interface{}
+	// BodyType 没有请求结构体可以描述的请求体类型，如 application/octet-stream
+	BodyType string
+	// Response 成功响应的结构体零值，Status 默认为200
+	Response interface{}
+	Status   int
+	// Security 认证方式的名称，对应 Document.Components.SecuritySchemes
+	Security   []string
+	Deprecated bool
+	// Hidden 为 true 时不出现在文档中
+	Hidden bool
+}
+
+// Group 一组共享前缀和中间件的路由
+type Group struct {
+	Prefix     string
+	Middleware []gin.HandlerFunc
+	// Tags、Security 作为组内路由的默认值
+	Tags     []string
+	Security []string
+	Routes   []Route
+}
+
+// Mount 把声明的路由注册到gin
+func Mount(r gin.IRouter, groups ...Group) {
+	for _, g := range groups {
+		gr := r.Group(g.Prefix, g.Middleware...)
+		for _, rt := range g.Routes {
+			handlers := append(append([]gin.HandlerFunc{}, rt.Middleware...), rt.Handler)
+			gr.Handle(rt.Method, rt.Path, handlers...)
+		}
+	}
+}
+
+var pathParam = regexp.MustCompile(`[:*]([^/]+)`)
+
+// Build 根据声明生成文档，securitySchemes 为文档中可用的认证方式
+func Build(info Info, securitySchemes map[string]*SecurityScheme, groups ...Group) *Document {
+	g := &generator{schemas: make(map[string]*Schema)}
+	doc := &Document{
+		OpenAPI:    "3.0.3",
+		Info:       info,
+		Paths:      make(map[string]map[string]*Operation),
+		Components: Components{Schemas: g.schemas, SecuritySchemes: securitySchemes},
+	}
+	ids := make(map[string]int)
+	for _, gr := range groups {
+		for _, rt := range gr.Routes {
+			if rt.Hidden {
+				continue
+			}
+			full := strings.TrimSuffix(gr.Prefix, "/") + rt.Path
+			path := pathParam.ReplaceAllString(full, "{$1}")
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = make(map[string]*Operation)
+			}
+			op := g.operation(rt, full)
+			if len(op.Tags) == 0 {
+				op.Tags = gr.Tags
+			}
+			security := rt.Security
+			if security == nil {
+				security = gr.Security
+			}
+			for _, name := range security {
+				op.Security = append(op.Security, map[string][]string{name: {}})
+			}
+			// 同一个处理函数可能挂在多条路由上，operationId 需要唯一
+			if op.OperationID != "" {
+				if n := ids[op.OperationID]; n > 0 {
+					ids[op.OperationID] = n + 1
+					op.OperationID += "_" + strconv.Itoa(n+1)
+				} else {
+					ids[op.OperationID] = 1
+				}
+			}
+			doc.Paths[path][strings.ToLower(rt.Method)] = op
+		}
+	}
+	return doc
+}
+
+func (g *generator) operation(rt Route, fullPath string) *Operation {
+	op := &Operation{
+		Tags:        rt.Tags,
+		Summary:     rt.Summary,
+		Description: rt.Description,
+		OperationID: handlerName(rt.Handler),
+		Deprecated:  rt.Deprecated,
+		Responses:   make(map[string]*Response),
+	}
+	if rt.Request != nil {
+		g.request(op, rt.Method, reflect.TypeOf(rt.Request))
+	}
+	// 请求结构体没有覆盖到的路径参数
+	for _, m := range pathParam.FindAllStringSubmatch(fullPath, -1) {
+		if !hasParam(op, m[1], "path") {
+			op.Parameters = append(op.Parameters, &Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	if op.RequestBody == nil && rt.BodyType != "" {
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]*MediaType{rt.BodyType: {}}}
+	}
+	status := rt.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	resp := &Response{Description: http.StatusText(status)}
+	if rt.Response != nil {
+		resp.Content = map[string]*MediaType{
+			"application/json": {Schema: g.schemaOf(reflect.TypeOf(rt.Response), "json", map[reflect.Type]bool{})},
+		}
+	}
+	op.Responses[strconv.Itoa(status)] = resp
+	if rt.Request != nil {
+		op.Responses["400"] = &Response{Description: "参数错误"}
+	}
+	return op
+}
+
+// request 按标签把请求结构体拆分为路径、查询、请求头参数和请求体
+func (g *generator) request(op *Operation, method string, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	formInQuery := method == http.MethodGet || method == http.MethodDelete || method == http.MethodHead
+	fields := g.structSchema(t, "form", map[reflect.Type]bool{}, func(f reflect.StructField) bool { return f.Tag.Get("form") != "" })
+	for _, in := range []string{"uri", "header"} {
+		params := g.structSchema(t, in, map[reflect.Type]bool{}, func(f reflect.StructField) bool { return f.Tag.Get(in) != "" })
+		location := map[string]string{"uri": "path", "header": "header"}[in]
+		addParams(op, params, location)
+	}
+	if formInQuery {
+		addParams(op, fields, "query")
+	}
+
+	content := make(map[string]*MediaType)
+	for _, tag := range []string{"json", "xml", "yaml"} {
+		body := g.structSchema(t, tag, map[reflect.Type]bool{}, func(f reflect.StructField) bool { return f.Tag.Get(tag) != "" })
+		if body.Properties == nil {
+			continue
+		}
+		mime := map[string]string{"json": "application/json", "xml": "application/xml", "yaml": "application/x-yaml"}[tag]
+		// 纯JSON请求体的具名结构体放入 components
+		if tag == "json" && t.Name() != "" && jsonOnly(t) {
+			body = g.ref(t)
+		}
+		content[mime] = &MediaType{Schema: body}
+	}
+	if !formInQuery && fields.Properties != nil {
+		mime := "application/x-www-form-urlencoded"
+		for _, p := range fields.Properties {
+			if p.Format == "binary" || p.Items != nil && p.Items.Format == "binary" {
+				mime = "multipart/form-data"
+			}
+		}
+		content[mime] = &MediaType{Schema: fields}
+	}
+	if len(content) > 0 {
+		op.RequestBody = &RequestBody{Required: true, Content: content}
+	}
+}
+
+func addParams(op *Operation, s *Schema, in string) {
+	required := make(map[string]bool)
+	for _, name := range s.Required {
+		required[name] = true
+	}
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := s.Properties[name]
+		desc := p.Description
+		p.Description = ""
+		op.Parameters = append(op.Parameters, &Parameter{
+			Name:        name,
+			In:          in,
+			Description: desc,
+			Required:    required[name] || in == "path",
+			Schema:      p,
+		})
+	}
+}
+
+func hasParam(op *Operation, name, in string) bool {
+	for _, p := range op.Parameters {
+		if p.Name == name && p.In == in {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonOnly 结构体中没有路径、请求头和表单字段，整个结构体就是JSON请求体
+func jsonOnly(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		for _, other := range []string{"uri", "header", "form"} {
+			if f.Tag.Get(other) != "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// handlerName 处理函数的名称，作为 operationId
+func handlerName(h gin.HandlerFunc) string {
+	if h == nil {
+		return ""
+	}
+	name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = name[strings.Index(name, ".")+1:]
+	// 闭包和方法值的名称形如 Handler.func1、(*T).Method-fm，不适合作为ID
+	if strings.ContainsAny(name, "().-") {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,205 @@
+package openapi
+
+import (
+	"encoding/json"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	fileHeaderType = reflect.TypeOf(multipart.FileHeader{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// generator 把Go类型转换为Schema，JSON中出现的具名结构体放入 components 复用
+type generator struct {
+	schemas map[string]*Schema
+}
+
+// schemaOf tag 为字段命名使用的标签：json、xml、yaml 或 form
+func (g *generator) schemaOf(t reflect.Type, tag string, visiting map[reflect.Type]bool) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "integer", Format: "int64", Description: "纳秒"}
+	case fileHeaderType:
+		return &Schema{Type: "string", Format: "binary"}
+	case rawMessageType:
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem(), tag, visiting)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem(), tag, visiting)}
+	case reflect.Struct:
+		if tag == "json" && t.Name() != "" {
+			return g.ref(t)
+		}
+		if visiting[t] {
+			return &Schema{Type: "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		return g.structSchema(t, tag, visiting, nil)
+	default:
+		// interface{} 等无法确定类型的字段
+		return &Schema{}
+	}
+}
+
+// ref 返回指向 components 的引用，第一次遇到时生成定义；先占位再展开，允许递归类型
+func (g *generator) ref(t reflect.Type) *Schema {
+	name := t.Name()
+	if _, ok := g.schemas[name]; !ok {
+		g.schemas[name] = &Schema{}
+		*g.schemas[name] = *g.structSchema(t, "json", map[reflect.Type]bool{t: true}, nil)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// structSchema 展开结构体字段；keep 不为 nil 时只保留 keep 返回 true 的字段，用于从请求结构体中挑出请求体字段
+func (g *generator) structSchema(t reflect.Type, tag string, visiting map[reflect.Type]bool, keep func(reflect.StructField) bool) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.addFields(s, t, tag, visiting, keep)
+	if len(s.Properties) == 0 {
+		s.Properties = nil
+	}
+	return s
+}
+
+func (g *generator) addFields(s *Schema, t reflect.Type, tag string, visiting map[reflect.Type]bool, keep func(reflect.StructField) bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if tag == "xml" && f.Name == "XMLName" {
+			if name, _ := tagName(f, "xml"); name != "" {
+				s.XML = &XML{Name: name}
+			}
+			continue
+		}
+		name, opts := tagName(f, tag)
+		if name == "-" {
+			continue
+		}
+		// 没有标签的嵌入结构体，字段提升到外层
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(s, ft, tag, visiting, keep)
+				continue
+			}
+		}
+		if !f.IsExported() || keep != nil && !keep(f) {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fs := g.schemaOf(f.Type, tag, visiting)
+		if fs.Ref == "" {
+			if def, ok := opts["default"]; ok {
+				fs.Default = def
+			}
+			if desc := f.Tag.Get("description"); desc != "" {
+				fs.Description = desc
+			}
+		}
+		if applyBinding(fs, f.Tag.Get("binding")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+	}
+}
+
+// tagName 解析 `json:"name,omitempty"`、`form:"page,default=1"` 这类标签
+func tagName(f reflect.StructField, tag string) (string, map[string]string) {
+	parts := strings.Split(f.Tag.Get(tag), ",")
+	opts := make(map[string]string)
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		opts[k] = v
+	}
+	return parts[0], opts
+}
+
+// applyBinding 把 validator 规则翻译为Schema约束，返回字段是否必填。引用类型的约束无法附加，只处理 required
+func applyBinding(s *Schema, rules string) (required bool) {
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "url", "uri":
+			s.Format = "uri"
+		case "oneof":
+			for _, v := range strings.Fields(arg) {
+				s.Enum = append(s.Enum, v)
+			}
+		case "len":
+			setMin(s, arg)
+			setMax(s, arg)
+		case "min", "gte":
+			setMin(s, arg)
+		case "max", "lte":
+			setMax(s, arg)
+		}
+	}
+	return required
+}
+
+// setMin 数值类型设置 minimum，字符串设置 minLength
+func setMin(s *Schema, arg string) {
+	switch s.Type {
+	case "integer", "number":
+		if v, err := strconv.ParseFloat(arg, 64); err == nil {
+			s.Minimum = &v
+		}
+	case "string":
+		if v, err := strconv.Atoi(arg); err == nil {
+			s.MinLength = &v
+		}
+	}
+}
+
+func setMax(s *Schema, arg string) {
+	switch s.Type {
+	case "integer", "number":
+		if v, err := strconv.ParseFloat(arg, 64); err == nil {
+			s.Maximum = &v
+		}
+	case "string":
+		if v, err := strconv.Atoi(arg); err == nil {
+			s.MaxLength = &v
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Page 统一的分页响应
+type Page struct {
+	Items      []map[string]interface{} `json:"items"`
+	Page       int                      `json:"page,omitempty"`
+	Size       int                      `json:"size"`
+	Total      *int64                   `json:"total,omitempty"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+// NewPage 根据查询结果构造分页响应，rows 的key为字段名；
+// 游标分页时 rows 可能多一行，用来判断是否还有下一页
+func (q *Query) NewPage(rows []map[string]interface{}, total int64) *Page {
+	p := &Page{Size: q.Size}
+	if !q.UseCursor {
+		p.Page = q.Page
+		p.Total = &total
+		p.Items = q.project(rows)
+		return p
+	}
+	if len(rows) > q.Size {
+		rows = rows[:q.Size]
+		p.NextCursor = q.encodeCursor(rows[len(rows)-1])
+	}
+	p.Items = q.project(rows)
+	return p
+}
+
+// project 去掉只为游标查询出来的字段
+func (q *Query) project(rows []map[string]interface{}) []map[string]interface{} {
+	if rows == nil {
+		return []map[string]interface{}{}
+	}
+	if len(q.Fields) == 0 {
+		return rows
+	}
+	out := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		item := make(map[string]interface{}, len(q.Fields))
+		for _, name := range q.Fields {
+			item[name] = row[name]
+		}
+		out[i] = item
+	}
+	return out
+}
+
+// encodeCursor 把最后一行的排序字段值编码为不透明的游标
+func (q *Query) encodeCursor(row map[string]interface{}) string {
+	values := make([]string, len(q.Sorts))
+	for i, by := range q.Sorts {
+		switch v := row[by.Field].(type) {
+		case time.Time:
+			values[i] = v.Format(time.RFC3339Nano)
+		default:
+			values[i] = fmt.Sprint(v)
+		}
+	}
+	raw, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func (s *Schema) decodeCursor(cursor string, sorts []Sort) ([]interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, err
+	}
+	if len(values) != len(sorts) {
+		return nil, fmt.Errorf("cursor has %d values, want %d", len(values), len(sorts))
+	}
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		if out[i], err = convert(s.Fields[sorts[i].Field].Type, v); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
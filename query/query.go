@@ -0,0 +1,246 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type 字段类型，决定过滤值如何解析
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Float
+	Bool
+	Time // RFC3339
+)
+
+// Op 过滤操作符
+type Op string
+
+const (
+	Eq   Op = "eq"
+	Ne   Op = "ne"
+	Gt   Op = "gt"
+	Gte  Op = "gte"
+	Lt   Op = "lt"
+	Lte  Op = "lte"
+	Like Op = "like"
+	In   Op = "in"
+)
+
+var opSQL = map[Op]string{Eq: "=", Ne: "<>", Gt: ">", Gte: ">=", Lt: "<", Lte: "<=", Like: "LIKE", In: "IN"}
+
+// Field 允许查询的字段，未在 Schema 中声明的字段一律拒绝
+type Field struct {
+	Column string // 数据库列名，只来自代码中的声明，不会拼接用户输入
+	Type   Type
+	Filter bool // 是否允许过滤
+	Sort   bool // 是否允许排序
+}
+
+// Schema 某个资源的查询白名单
+type Schema struct {
+	Table  string
+	Fields map[string]Field
+	// Key 唯一字段，游标分页时作为最后的排序字段保证顺序稳定
+	Key         string
+	DefaultSort []Sort
+	DefaultSize int // 默认20
+	MaxSize     int // 默认100
+}
+
+// Filter 一个过滤条件，多个条件之间为 AND
+type Filter struct {
+	Field  string
+	Op     Op
+	Values []interface{}
+}
+
+// Sort 排序字段
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Query 校验后的列表查询
+type Query struct {
+	Schema  *Schema
+	Filters []Filter
+	Sorts   []Sort
+	Fields  []string
+	Page    int
+	Size    int
+	// UseCursor 为 true 时使用游标分页，Page 被忽略
+	UseCursor bool
+	Cursor    []interface{}
+}
+
+// Error 查询参数错误，应返回400
+type Error struct {
+	Param string
+	Msg   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Param, e.Msg)
+}
+
+func errorf(param, format string, args ...interface{}) error {
+	return &Error{Param: param, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Params 列表接口的查询参数，Parse 直接解析 url.Values，该结构体用于生成接口文档
+type Params struct {
+	Filter []string `form:"filter" description:"过滤条件 field:op:value，op 为 eq、ne、gt、gte、lt、lte、like、in，in 的多个值用 | 分隔"`
+	Sort   string   `form:"sort" description:"排序字段，逗号分隔，- 前缀表示降序"`
+	Fields string   `form:"fields" description:"返回的字段，逗号分隔"`
+	Page   int      `form:"page" binding:"min=1"`
+	Size   int      `form:"size" binding:"min=1"`
+	Cursor string   `form:"cursor" description:"游标分页，首页传空值，之后传上一页返回的 next_cursor"`
+}
+
+// Parse 解析并校验查询参数:
+//
+//	filter=base:eq:USD&filter=rate:gte:7    多个条件可重复传或用逗号分隔，in 的多个值用 | 分隔
+//	sort=-effective_at,base                 - 表示降序
+//	fields=base,quote,rate
+//	page=1&size=20                          页码分页
+//	cursor=                                 游标分页，首页传空值，之后传上一页返回的 next_cursor
+func (s *Schema) Parse(values url.Values) (*Query, error) {
+	q := &Query{Schema: s, Page: 1, Size: s.DefaultSize}
+	if q.Size <= 0 {
+		q.Size = 20
+	}
+	maxSize := s.MaxSize
+	if maxSize <= 0 {
+		maxSize = 100
+	}
+	for _, raw := range splitList(values["filter"]) {
+		f, err := s.parseFilter(raw)
+		if err != nil {
+			return nil, err
+		}
+		q.Filters = append(q.Filters, f)
+	}
+	for _, raw := range splitList(values["sort"]) {
+		sort := Sort{Field: raw}
+		if strings.HasPrefix(raw, "-") {
+			sort = Sort{Field: raw[1:], Desc: true}
+		}
+		if f, ok := s.Fields[sort.Field]; !ok || !f.Sort {
+			return nil, errorf("sort", "field %q is not sortable", sort.Field)
+		}
+		q.Sorts = append(q.Sorts, sort)
+	}
+	if len(q.Sorts) == 0 {
+		q.Sorts = append(q.Sorts, s.DefaultSort...)
+	}
+	for _, name := range splitList(values["fields"]) {
+		if _, ok := s.Fields[name]; !ok {
+			return nil, errorf("fields", "unknown field %q", name)
+		}
+		q.Fields = append(q.Fields, name)
+	}
+	var err error
+	if v := values.Get("page"); v != "" {
+		if q.Page, err = strconv.Atoi(v); err != nil || q.Page < 1 {
+			return nil, errorf("page", "must be a positive integer")
+		}
+	}
+	if v := values.Get("size"); v != "" {
+		if q.Size, err = strconv.Atoi(v); err != nil || q.Size < 1 || q.Size > maxSize {
+			return nil, errorf("size", "must be between 1 and %d", maxSize)
+		}
+	}
+	if _, ok := values["cursor"]; ok {
+		if s.Key == "" {
+			return nil, errorf("cursor", "cursor pagination is not supported")
+		}
+		q.UseCursor = true
+		// 游标分页要求排序唯一，追加主键作为最后的排序字段
+		if !q.sortedBy(s.Key) {
+			desc := len(q.Sorts) > 0 && q.Sorts[len(q.Sorts)-1].Desc
+			q.Sorts = append(q.Sorts, Sort{Field: s.Key, Desc: desc})
+		}
+		if raw := values.Get("cursor"); raw != "" {
+			if q.Cursor, err = s.decodeCursor(raw, q.Sorts); err != nil {
+				return nil, errorf("cursor", "malformed cursor")
+			}
+		}
+	}
+	return q, nil
+}
+
+func (q *Query) sortedBy(field string) bool {
+	for _, s := range q.Sorts {
+		if s.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) parseFilter(raw string) (Filter, error) {
+	parts := strings.SplitN(raw, ":", 3)
+	if len(parts) != 3 {
+		return Filter{}, errorf("filter", "%q must be field:op:value", raw)
+	}
+	name, op := parts[0], Op(parts[1])
+	field, ok := s.Fields[name]
+	if !ok || !field.Filter {
+		return Filter{}, errorf("filter", "field %q is not filterable", name)
+	}
+	if _, ok := opSQL[op]; !ok {
+		return Filter{}, errorf("filter", "unknown operator %q", op)
+	}
+	if op == Like && field.Type != String {
+		return Filter{}, errorf("filter", "like is only supported on text fields")
+	}
+	raws := []string{parts[2]}
+	if op == In {
+		raws = strings.Split(parts[2], "|")
+	}
+	f := Filter{Field: name, Op: op}
+	for _, r := range raws {
+		v, err := convert(field.Type, r)
+		if err != nil {
+			return Filter{}, errorf("filter", "field %q: %v", name, err)
+		}
+		f.Values = append(f.Values, v)
+	}
+	return f, nil
+}
+
+// convert 按字段类型解析字符串
+func convert(t Type, raw string) (interface{}, error) {
+	switch t {
+	case Int:
+		return strconv.ParseInt(raw, 10, 64)
+	case Float:
+		return strconv.ParseFloat(raw, 64)
+	case Bool:
+		return strconv.ParseBool(raw)
+	case Time:
+		return time.Parse(time.RFC3339, raw)
+	default:
+		return raw, nil
+	}
+}
+
+// splitList 同时支持重复参数和逗号分隔
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,170 @@
+package query
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testSchema = &Schema{
+	Table: "exchange_rates",
+	Fields: map[string]Field{
+		"id":           {Column: "id", Type: Int, Filter: true, Sort: true},
+		"base":         {Column: "base", Type: String, Filter: true, Sort: true},
+		"rate":         {Column: "rate", Type: Float, Filter: true, Sort: true},
+		"source":       {Column: "source", Type: String, Filter: true},
+		"effective_at": {Column: "effective_at", Type: Time, Filter: true, Sort: true},
+		"created_at":   {Column: "created_at", Type: Time},
+	},
+	Key:         "id",
+	DefaultSort: []Sort{{Field: "effective_at", Desc: true}},
+	MaxSize:     50,
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		param string
+	}{
+		{"filter without value", "filter=base:eq", "filter"},
+		{"unknown filter field", "filter=secret:eq:x", "filter"},
+		{"field not filterable", "filter=created_at:eq:2024-01-01T00:00:00Z", "filter"},
+		{"unknown operator", "filter=base:regex:U.*", "filter"},
+		{"like on number", "filter=rate:like:7", "filter"},
+		{"value of wrong type", "filter=rate:gt:seven", "filter"},
+		{"time not RFC3339", "filter=effective_at:gte:2024-01-01", "filter"},
+		{"field not sortable", "sort=source", "sort"},
+		{"unknown field", "fields=base,password", "fields"},
+		{"page zero", "page=0", "page"},
+		{"size above max", "size=51", "size"},
+		{"malformed cursor", "cursor=not-base64!", "cursor"},
+		{"cursor with wrong arity", "cursor=" + encodeValues(`["2024-01-01T00:00:00Z"]`), "cursor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			_, err := testSchema.Parse(values)
+			var qe *Error
+			if !errors.As(err, &qe) {
+				t.Fatalf("got %v, want *Error", err)
+			}
+			if qe.Param != tt.param {
+				t.Errorf("param = %s, want %s", qe.Param, tt.param)
+			}
+		})
+	}
+}
+
+func TestToSQL(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantList  string
+		wantArgs  []interface{}
+		wantCount string
+	}{
+		{
+			name:      "defaults",
+			query:     "fields=base,rate",
+			wantList:  "SELECT base, rate, effective_at FROM exchange_rates ORDER BY effective_at DESC LIMIT 20 OFFSET 0",
+			wantCount: "SELECT COUNT(*) FROM exchange_rates",
+		},
+		{
+			name:      "filters and sort",
+			query:     "filter=base:eq:USD,rate:gte:7.5&sort=base,-rate&fields=base,rate&page=3&size=10",
+			wantList:  "SELECT base, rate FROM exchange_rates WHERE base = ? AND rate >= ? ORDER BY base, rate DESC LIMIT 10 OFFSET 20",
+			wantArgs:  []interface{}{"USD", 7.5},
+			wantCount: "SELECT COUNT(*) FROM exchange_rates WHERE base = ? AND rate >= ?",
+		},
+		{
+			name:      "in and like",
+			query:     "filter=base:in:USD|EUR&filter=source:like:ecb%25&fields=id",
+			wantList:  "SELECT id, effective_at FROM exchange_rates WHERE base IN (?, ?) AND source LIKE ? ORDER BY effective_at DESC LIMIT 20 OFFSET 0",
+			wantArgs:  []interface{}{"USD", "EUR", "ecb%"},
+			wantCount: "SELECT COUNT(*) FROM exchange_rates WHERE base IN (?, ?) AND source LIKE ?",
+		},
+		{
+			name:     "first cursor page",
+			query:    "cursor=&fields=base&size=2",
+			wantList: "SELECT base, effective_at, id FROM exchange_rates ORDER BY effective_at DESC, id DESC LIMIT 3",
+		},
+		{
+			name:  "next cursor page",
+			query: "cursor=" + encodeValues(`["2024-01-02T00:00:00Z","17"]`) + "&filter=base:eq:USD&fields=base&size=2",
+			wantList: "SELECT base, effective_at, id FROM exchange_rates WHERE base = ? AND " +
+				"((effective_at < ?) OR (effective_at = ? AND id < ?)) ORDER BY effective_at DESC, id DESC LIMIT 3",
+			wantArgs: []interface{}{"USD", mustTime("2024-01-02T00:00:00Z"), mustTime("2024-01-02T00:00:00Z"), int64(17)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			q, err := testSchema.Parse(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			list, args, count, _ := q.ToSQL()
+			if list != tt.wantList {
+				t.Errorf("list SQL\n got: %s\nwant: %s", list, tt.wantList)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+			if count != tt.wantCount {
+				t.Errorf("count SQL\n got: %s\nwant: %s", count, tt.wantCount)
+			}
+		})
+	}
+}
+
+// TestCursorRoundTrip 上一页返回的 next_cursor 解析后得到最后一行的排序字段值
+func TestCursorRoundTrip(t *testing.T) {
+	values, _ := url.ParseQuery("cursor=&fields=base&size=2")
+	q, err := testSchema.Parse(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC)
+	rows := []map[string]interface{}{
+		{"base": "USD", "effective_at": at.Add(time.Hour), "id": int64(9)},
+		{"base": "EUR", "effective_at": at, "id": int64(8)},
+		{"base": "JPY", "effective_at": at, "id": int64(7)},
+	}
+	page := q.NewPage(rows, 0)
+	if len(page.Items) != 2 || page.NextCursor == "" || page.Total != nil {
+		t.Fatalf("page = %+v, want 2 items, a next cursor and no total", page)
+	}
+	if want := map[string]interface{}{"base": "USD"}; !reflect.DeepEqual(page.Items[0], want) {
+		t.Errorf("item = %v, want only the selected fields %v", page.Items[0], want)
+	}
+
+	next, err := testSchema.Parse(url.Values{"cursor": {page.NextCursor}, "fields": {"base"}, "size": {"2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{at, int64(8)}; !reflect.DeepEqual(next.Cursor, want) {
+		t.Errorf("cursor = %v, want %v", next.Cursor, want)
+	}
+
+	last := next.NewPage(rows[2:], 0)
+	if last.NextCursor != "" {
+		t.Errorf("last page has next cursor %q", last.NextCursor)
+	}
+}
+
+// encodeValues 按 encodeCursor 的格式编码游标
+func encodeValues(json string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(json))
+}
+
+func mustTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
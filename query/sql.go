@@ -0,0 +1,125 @@
+package query
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ToSQL 生成列表查询和计数查询，占位符为 ?，MySQL 和 SQLite 通用。
+// 列名全部来自 Schema，用户输入只会出现在参数中。
+// 游标分页时多查询一行用于判断是否还有下一页，且不生成计数查询。
+func (q *Query) ToSQL() (listSQL string, listArgs []interface{}, countSQL string, countArgs []interface{}) {
+	s := q.Schema
+	where, args := q.where()
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	b.WriteString(strings.Join(q.columns(), ", "))
+	b.WriteString(" FROM ")
+	b.WriteString(s.Table)
+	listArgs = append(listArgs, args...)
+	conds := where
+	if q.UseCursor && q.Cursor != nil {
+		seek, seekArgs := q.seek()
+		conds = append(conds, seek)
+		listArgs = append(listArgs, seekArgs...)
+	}
+	if len(conds) > 0 {
+		b.WriteString(" WHERE ")
+		b.WriteString(strings.Join(conds, " AND "))
+	}
+	if len(q.Sorts) > 0 {
+		order := make([]string, len(q.Sorts))
+		for i, by := range q.Sorts {
+			order[i] = s.Fields[by.Field].Column
+			if by.Desc {
+				order[i] += " DESC"
+			}
+		}
+		b.WriteString(" ORDER BY ")
+		b.WriteString(strings.Join(order, ", "))
+	}
+	if q.UseCursor {
+		b.WriteString(" LIMIT " + strconv.Itoa(q.Size+1))
+		return b.String(), listArgs, "", nil
+	}
+	b.WriteString(" LIMIT " + strconv.Itoa(q.Size) + " OFFSET " + strconv.Itoa((q.Page-1)*q.Size))
+	countSQL = "SELECT COUNT(*) FROM " + s.Table
+	if len(where) > 0 {
+		countSQL += " WHERE " + strings.Join(where, " AND ")
+	}
+	return b.String(), listArgs, countSQL, args
+}
+
+// Names 返回结果中每一列对应的字段名，顺序与 SELECT 的列一致
+func (q *Query) Names() []string {
+	names := append([]string(nil), q.Fields...)
+	if len(names) == 0 {
+		for name := range q.Schema.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	// 游标需要排序字段的值，未选择时也要查询出来
+	for _, s := range q.Sorts {
+		if !contains(names, s.Field) {
+			names = append(names, s.Field)
+		}
+	}
+	return names
+}
+
+func (q *Query) columns() []string {
+	names := q.Names()
+	cols := make([]string, len(names))
+	for i, name := range names {
+		cols[i] = q.Schema.Fields[name].Column
+	}
+	return cols
+}
+
+func (q *Query) where() ([]string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	for _, f := range q.Filters {
+		col := q.Schema.Fields[f.Field].Column
+		if f.Op == In {
+			conds = append(conds, col+" IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(f.Values)), ", ")+")")
+		} else {
+			conds = append(conds, col+" "+opSQL[f.Op]+" ?")
+		}
+		args = append(args, f.Values...)
+	}
+	return conds, args
+}
+
+// seek 生成游标分页条件，对排序 (a, b) 展开为 a > ? OR (a = ? AND b > ?)，
+// 方向按各字段的升降序决定
+func (q *Query) seek() (string, []interface{}) {
+	var ors []string
+	var args []interface{}
+	for i, by := range q.Sorts {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, q.Schema.Fields[q.Sorts[j].Field].Column+" = ?")
+			args = append(args, q.Cursor[j])
+		}
+		op := " > ?"
+		if by.Desc {
+			op = " < ?"
+		}
+		ands = append(ands, q.Schema.Fields[by.Field].Column+op)
+		args = append(args, q.Cursor[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package rates
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"web_app/models"
+)
+
+// FileProvider 从本地 CSV 或 JSON 文件加载汇率
+//
+// CSV 需要表头 base,quote,rate[,effective_at]；JSON 为对象数组:
+// [{"base":"USD","quote":"CNY","rate":7.12,"effective_at":"2024-01-01T00:00:00Z"}]
+type FileProvider struct {
+	name string
+	path string
+}
+
+func NewFileProvider(name, path string) *FileProvider {
+	return &FileProvider{name: name, path: path}
+}
+
+func (p *FileProvider) Name() string {
+	return p.name
+}
+
+func (p *FileProvider) Fetch(ctx context.Context) ([]*models.ExchangeRate, error) {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []record
+	switch strings.ToLower(filepath.Ext(p.path)) {
+	case ".csv":
+		records, err = readCSV(f)
+	case ".json":
+		err = json.NewDecoder(f).Decode(&records)
+	default:
+		return nil, fmt.Errorf("unsupported rates file %q", p.path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", p.path, err)
+	}
+	return toModels(p.name, records)
+}
+
+func readCSV(r io.Reader) ([]record, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	// 表头决定列顺序
+	index := make(map[string]int, len(rows[0]))
+	for i, col := range rows[0] {
+		index[strings.ToLower(strings.TrimSpace(col))] = i
+	}
+	for _, col := range []string{"base", "quote", "rate"} {
+		if _, ok := index[col]; !ok {
+			return nil, fmt.Errorf("missing column %q", col)
+		}
+	}
+	get := func(row []string, col string) string {
+		if i, ok := index[col]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	records := make([]record, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		records = append(records, record{
+			Base:        get(row, "base"),
+			Quote:       get(row, "quote"),
+			Rate:        get(row, "rate"),
+			EffectiveAt: get(row, "effective_at"),
+		})
+	}
+	return records, nil
+}
+
+// toModels 转换整批记录，任意一条格式错误都会使整批失败
+func toModels(source string, records []record) ([]*models.ExchangeRate, error) {
+	now := time.Now()
+	list := make([]*models.ExchangeRate, 0, len(records))
+	for i, r := range records {
+		m, err := r.toModel(source, now)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		list = append(list, m)
+	}
+	return list, nil
+}
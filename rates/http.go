@@ -0,0 +1,55 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"web_app/models"
+)
+
+// HTTPProvider 从 HTTP 接口拉取汇率，响应体格式与 JSON 文件相同
+type HTTPProvider struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+func NewHTTPProvider(name, url string, timeout time.Duration) *HTTPProvider {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &HTTPProvider{
+		name:   name,
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *HTTPProvider) Name() string {
+	return p.name
+}
+
+func (p *HTTPProvider) Fetch(ctx context.Context) ([]*models.ExchangeRate, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("GET %s: unexpected status %s", p.url, resp.Status)
+	}
+	var records []record
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", p.url, err)
+	}
+	return toModels(p.name, records)
+}
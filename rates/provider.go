@@ -0,0 +1,91 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"web_app/models"
+	"web_app/settings"
+)
+
+// Provider 汇率数据源
+type Provider interface {
+	// Name 数据源名称，会写入汇率记录的 source 字段
+	Name() string
+	// Fetch 拉取一批汇率
+	Fetch(ctx context.Context) ([]*models.ExchangeRate, error)
+}
+
+// NewProvider 根据配置创建对应类型的数据源
+func NewProvider(cfg settings.RateProviderConfig) (Provider, error) {
+	switch cfg.Type {
+	case "file":
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("rates provider %q: path is required", cfg.Name)
+		}
+		return NewFileProvider(cfg.Name, cfg.Path), nil
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("rates provider %q: url is required", cfg.Name)
+		}
+		return NewHTTPProvider(cfg.Name, cfg.URL, cfg.Timeout), nil
+	default:
+		return nil, fmt.Errorf("rates provider %q: unknown type %q", cfg.Name, cfg.Type)
+	}
+}
+
+// record 文件和HTTP数据源共用的数据格式
+type record struct {
+	Base        string `json:"base"`
+	Quote       string `json:"quote"`
+	Rate        string `json:"rate"`
+	EffectiveAt string `json:"effective_at"`
+}
+
+// UnmarshalJSON 兼容 rate 字段为数字或字符串两种写法
+func (r *record) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Base        string      `json:"base"`
+		Quote       string      `json:"quote"`
+		Rate        interface{} `json:"rate"`
+		EffectiveAt string      `json:"effective_at"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	r.Base, r.Quote, r.EffectiveAt = raw.Base, raw.Quote, raw.EffectiveAt
+	switch v := raw.Rate.(type) {
+	case float64:
+		r.Rate = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		r.Rate = v
+	case nil:
+	default:
+		return fmt.Errorf("invalid rate %v", v)
+	}
+	return nil
+}
+
+// toModel 把原始记录转换为汇率模型，缺省的生效时间使用 now
+func (r record) toModel(source string, now time.Time) (*models.ExchangeRate, error) {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(r.Rate), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate %q: %w", r.Rate, err)
+	}
+	effectiveAt := now
+	if s := strings.TrimSpace(r.EffectiveAt); s != "" {
+		if effectiveAt, err = time.Parse(time.RFC3339, s); err != nil {
+			return nil, fmt.Errorf("invalid effective_at %q: %w", s, err)
+		}
+	}
+	return &models.ExchangeRate{
+		Base:        strings.ToUpper(strings.TrimSpace(r.Base)),
+		Quote:       strings.ToUpper(strings.TrimSpace(r.Quote)),
+		Rate:        rate,
+		Source:      source,
+		EffectiveAt: effectiveAt.UTC(),
+	}, nil
+}
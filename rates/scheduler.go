@@ -0,0 +1,359 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/dao/redis"
+	"web_app/deps"
+	"web_app/jobs"
+	"web_app/models"
+	"web_app/settings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultInterval     = 10 * time.Minute
+	defaultMaxDeviation = 0.2
+	defaultConfirm      = 3
+	// 生效时间允许超前当前时间的范围，防止数据源时钟错误
+	maxClockSkew = 5 * time.Minute
+
+	electionName = "rates-scheduler"
+	electionTTL  = 15 * time.Second
+)
+
+type job struct {
+	provider Provider
+	interval time.Duration
+}
+
+// candidate 被判为异常的读数，等待后续读数确认
+type candidate struct {
+	rate  float64
+	at    time.Time
+	count int
+}
+
+// Scheduler 按各数据源配置的间隔定时拉取汇率，校验后写入数据库
+type Scheduler struct {
+	jobs         []job
+	maxDeviation float64
+	confirm      int
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+
+	mu         sync.Mutex
+	candidates map[string]candidate // key 为 来源/货币对
+}
+
+// NewScheduler 根据配置创建调度器，任意数据源配置错误都会返回错误
+func NewScheduler(cfg settings.RatesConfig) (*Scheduler, error) {
+	s := &Scheduler{
+		maxDeviation: cfg.MaxDeviation,
+		confirm:      cfg.ConfirmReadings,
+		candidates:   make(map[string]candidate),
+	}
+	if s.maxDeviation <= 0 {
+		s.maxDeviation = defaultMaxDeviation
+	}
+	if s.confirm <= 0 {
+		s.confirm = defaultConfirm
+	}
+	for _, pc := range cfg.Providers {
+		p, err := NewProvider(pc)
+		if err != nil {
+			return nil, err
+		}
+		interval := pc.Interval
+		if interval <= 0 {
+			interval = defaultInterval
+		}
+		s.jobs = append(s.jobs, job{provider: p, interval: interval})
+	}
+	return s, nil
+}
+
+// Start 参与leader竞选，当选后为每个数据源启动一个轮询goroutine并立即执行一次；
+// 多实例部署时同一时刻只有一个实例拉取，leader宕机后由其他实例接替。
+// redis 不可用时无法竞选，退化为每个实例各自拉取，重复数据由唯一键去重，redis 恢复后重新竞选
+func (s *Scheduler) Start(ctx context.Context) {
+	if len(s.jobs) == 0 {
+		return
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for ctx.Err() == nil {
+			if redisUp() {
+				s.elect(ctx)
+			} else {
+				s.runLocal(ctx)
+			}
+		}
+	}()
+}
+
+// elect 竞选并在当选期间拉取，写入时带上防护令牌；redis 不可用时返回
+func (s *Scheduler) elect(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		waitUntil(ctx, func() bool { return !redisUp() })
+		cancel()
+	}()
+	redis.RunAsLeader(ctx, electionName, electionTTL, s.runAll)
+}
+
+// runLocal redis 不可用期间在本实例拉取，没有防护令牌；redis 恢复时返回
+func (s *Scheduler) runLocal(ctx context.Context) {
+	zap.L().Warn("redis不可用，汇率调度退化为本实例独立拉取")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		waitUntil(ctx, redisUp)
+		cancel()
+	}()
+	s.runAll(ctx, 0)
+}
+
+// runAll 为每个数据源启动轮询，直到 ctx 结束
+func (s *Scheduler) runAll(ctx context.Context, fence int64) {
+	var wg sync.WaitGroup
+	for _, j := range s.jobs {
+		wg.Add(1)
+		go func(j job) {
+			defer wg.Done()
+			s.loop(ctx, j, fence)
+		}(j)
+	}
+	wg.Wait()
+}
+
+func redisUp() bool {
+	return deps.Up(deps.Redis)
+}
+
+// waitUntil 按竞选续期的频率检查 cond，满足或 ctx 结束时返回
+func waitUntil(ctx context.Context, cond func() bool) {
+	ticker := time.NewTicker(electionTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if cond() {
+				return
+			}
+		}
+	}
+}
+
+// Stop 退出竞选、停止所有轮询并等待正在进行的拉取结束
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, j job, fence int64) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		// 失败已经记录日志，等下一个周期重试；令牌过期说明已有新leader，
+		// 当前 ctx 随锁丢失很快会被取消
+		s.runOnce(ctx, j.provider, fence)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// IngestJobType 立即拉取汇率的后台任务类型，参数为 IngestPayload
+const IngestJobType = "rates.ingest"
+
+// IngestPayload 拉取任务参数，Provider 为空时拉取所有数据源
+type IngestPayload struct {
+	Provider string `json:"provider"`
+}
+
+// HandleIngestJob 后台任务处理函数，在任务队列中执行，不阻塞请求；
+// 任一数据源失败时返回错误，由任务队列按退避策略重试
+func (s *Scheduler) HandleIngestJob(ctx context.Context, job *jobs.Job) error {
+	var p IngestPayload
+	if err := job.Bind(&p); err != nil {
+		return err
+	}
+	found := false
+	var errs []error
+	for _, j := range s.jobs {
+		if p.Provider == "" || p.Provider == j.provider.Name() {
+			found = true
+			if err := s.RunOnce(ctx, j.provider); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", j.provider.Name(), err))
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown rates provider %q", p.Provider)
+	}
+	return errors.Join(errs...)
+}
+
+// errMySQLDown mysql不可用时跳过拉取
+var errMySQLDown = errors.New("mysql is unavailable")
+
+// RunOnce 拉取一次数据源并写入，结果通过zap记录，拉取或写入失败时返回错误。
+// 不经过选举，不带防护令牌，用于手动触发的拉取任务
+func (s *Scheduler) RunOnce(ctx context.Context, p Provider) error {
+	return s.runOnce(ctx, p, 0)
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, p Provider, fence int64) error {
+	start := time.Now()
+	log := zap.L().With(zap.String("provider", p.Name()), zap.Int64("fence", fence))
+	if !deps.Up(deps.MySQL) {
+		log.Warn("mysql不可用，跳过本次汇率拉取")
+		return errMySQLDown
+	}
+	fetched, err := p.Fetch(ctx)
+	if err != nil {
+		log.Error("拉取汇率失败", zap.Error(err))
+		return err
+	}
+	accepted, rejected := s.filter(ctx, fetched, log)
+	var inserted int64
+	if len(accepted) > 0 {
+		if inserted, err = mysql.CreateExchangeRates(ctx, accepted, fence); err != nil {
+			log.Error("写入汇率失败", zap.Int("accepted", len(accepted)), zap.Error(err))
+			return err
+		}
+	}
+	log.Info("汇率拉取完成",
+		zap.Int("fetched", len(fetched)),
+		zap.Int("rejected", rejected),
+		zap.Int64("inserted", inserted),
+		zap.Duration("cost", time.Since(start)),
+	)
+	return nil
+}
+
+// filter 丢弃格式不合法和相对最新汇率偏离过大的记录；偏离的读数被同一来源后续的读数确认后接受，
+// 避免行情真的大幅变化时新汇率永远无法写入
+func (s *Scheduler) filter(ctx context.Context, list []*models.ExchangeRate, log *zap.Logger) (accepted []*models.ExchangeRate, rejected int) {
+	// 与刚写入的数据比较，必须读主库
+	ctx = mysql.WithPrimary(ctx)
+	latest := make(map[string]float64)
+	for _, r := range list {
+		if err := validate(r); err != nil {
+			log.Warn("忽略非法汇率", zap.String("pair", r.Pair()), zap.Error(err))
+			rejected++
+			continue
+		}
+		prev, ok := latest[r.Pair()]
+		if !ok {
+			last, err := mysql.GetLatestExchangeRate(ctx, r.Base, r.Quote)
+			if err != nil {
+				log.Warn("查询历史汇率失败，跳过异常值检查", zap.String("pair", r.Pair()), zap.Error(err))
+			} else if last != nil {
+				prev = last.Rate
+			}
+		}
+		if prev > 0 && s.deviates(r.Rate, prev) {
+			if n, ok := s.confirmOutlier(r); !ok {
+				log.Warn("忽略异常汇率",
+					zap.String("pair", r.Pair()),
+					zap.Float64("rate", r.Rate),
+					zap.Float64("previous", prev),
+					zap.Int("readings", n),
+				)
+				rejected++
+				continue
+			}
+			log.Warn("偏离的汇率已被连续读数确认，予以接受",
+				zap.String("pair", r.Pair()),
+				zap.Float64("rate", r.Rate),
+				zap.Float64("previous", prev),
+			)
+		} else {
+			s.resetOutlier(r)
+		}
+		latest[r.Pair()] = r.Rate
+		accepted = append(accepted, r)
+	}
+	return accepted, rejected
+}
+
+func (s *Scheduler) deviates(rate, prev float64) bool {
+	return math.Abs(rate-prev)/prev > s.maxDeviation
+}
+
+// confirmOutlier 记录一次偏离的读数，返回与之一致的连续读数次数，达到 confirm 次时确认。
+// 只统计生效时间更新的读数，数据源没有更新时重复拉到的同一条数据不算
+func (s *Scheduler) confirmOutlier(r *models.ExchangeRate) (int, bool) {
+	key := r.Source + "/" + r.Pair()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.candidates[key]
+	switch {
+	case !ok || s.deviates(r.Rate, c.rate):
+		c = candidate{count: 1}
+	case r.EffectiveAt.After(c.at):
+		c.count++
+	default:
+		return c.count, false
+	}
+	c.rate, c.at = r.Rate, r.EffectiveAt
+	if c.count >= s.confirm {
+		delete(s.candidates, key)
+		return c.count, true
+	}
+	s.candidates[key] = c
+	return c.count, false
+}
+
+// resetOutlier 出现正常读数时之前偏离的读数不再算作连续
+func (s *Scheduler) resetOutlier(r *models.ExchangeRate) {
+	s.mu.Lock()
+	delete(s.candidates, r.Source+"/"+r.Pair())
+	s.mu.Unlock()
+}
+
+func validate(r *models.ExchangeRate) error {
+	if !isCurrencyCode(r.Base) || !isCurrencyCode(r.Quote) {
+		return fmt.Errorf("invalid currency pair %q", r.Pair())
+	}
+	if r.Base == r.Quote {
+		return fmt.Errorf("base and quote are both %s", r.Base)
+	}
+	if math.IsNaN(r.Rate) || math.IsInf(r.Rate, 0) || r.Rate <= 0 {
+		return fmt.Errorf("invalid rate %v", r.Rate)
+	}
+	if r.EffectiveAt.After(time.Now().Add(maxClockSkew)) {
+		return fmt.Errorf("effective_at %s is in the future", r.EffectiveAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// isCurrencyCode 判断是否为ISO 4217格式的三位大写字母代码
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
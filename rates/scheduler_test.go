@@ -0,0 +1,191 @@
+package rates
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/dao/redis/redistest"
+	"web_app/deps"
+	"web_app/jobs"
+	"web_app/models"
+	"web_app/settings"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	// runOnce 和 Start 按依赖状态决定是否拉取、是否竞选，这里把两者都标记为可用
+	for _, name := range []string{deps.MySQL, deps.Redis} {
+		deps.Register(&deps.Dependency{Name: name, Connect: func() error { return nil }})
+	}
+	if err := deps.Start(settings.StartupConfig{}); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	deps.Stop()
+	os.Exit(code)
+}
+
+func setup(t *testing.T) context.Context {
+	t.Helper()
+	ctx := context.Background()
+	if err := mysql.Init(settings.MysqlConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "test.db")}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mysql.Close() })
+	if err := mysql.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+// fakeProvider 每次拉取返回 rates 生成的一批汇率，并记录拉取次数
+type fakeProvider struct {
+	name    string
+	rates   func() []*models.ExchangeRate
+	fetches atomic.Int32
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Fetch(context.Context) ([]*models.ExchangeRate, error) {
+	p.fetches.Add(1)
+	return p.rates(), nil
+}
+
+func newScheduler(providers ...Provider) *Scheduler {
+	s := &Scheduler{maxDeviation: 0.2, confirm: 3, candidates: make(map[string]candidate)}
+	for _, p := range providers {
+		s.jobs = append(s.jobs, job{provider: p, interval: time.Hour})
+	}
+	return s
+}
+
+func rate(source, pair string, r float64, at time.Time) *models.ExchangeRate {
+	return &models.ExchangeRate{Base: pair[:3], Quote: pair[4:], Rate: r, Source: source, EffectiveAt: at}
+}
+
+func TestFilterOutliers(t *testing.T) {
+	ctx := setup(t)
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if _, err := mysql.CreateExchangeRates(ctx, []*models.ExchangeRate{rate("ecb", "USD/CNY", 7.0, base)}, 0); err != nil {
+		t.Fatal(err)
+	}
+	s := newScheduler()
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	// 按顺序执行，每一步依赖之前的读数；数据库中的最新汇率始终是 7.0
+	steps := []struct {
+		name     string
+		reading  *models.ExchangeRate
+		accepted bool
+	}{
+		{"outlier", rate("ecb", "USD/CNY", 9.0, at(1)), false},
+		{"normal reading resets the outlier", rate("ecb", "USD/CNY", 7.1, at(2)), true},
+		{"first outlier of a new run", rate("ecb", "USD/CNY", 9.0, at(3)), false},
+		{"same reading fetched again is not counted", rate("ecb", "USD/CNY", 9.0, at(3)), false},
+		{"second consistent outlier", rate("ecb", "USD/CNY", 9.1, at(4)), false},
+		{"outlier far from the candidate restarts the count", rate("ecb", "USD/CNY", 12.0, at(5)), false},
+		{"other sources are counted separately", rate("boc", "USD/CNY", 12.0, at(6)), false},
+		{"second reading near the new candidate", rate("ecb", "USD/CNY", 12.1, at(6)), false},
+		{"third consistent reading is accepted", rate("ecb", "USD/CNY", 12.0, at(7)), true},
+		{"confirmation is not carried over", rate("ecb", "USD/CNY", 12.0, at(8)), false},
+		{"invalid pair", rate("ecb", "usd/CNY", 7.0, at(9)), false},
+		{"same currency", rate("ecb", "USD/USD", 1, at(9)), false},
+		{"negative rate", rate("ecb", "EUR/CNY", -1, at(9)), false},
+		{"effective in the future", rate("ecb", "EUR/CNY", 7.8, time.Now().Add(time.Hour)), false},
+		{"pair without history", rate("ecb", "EUR/CNY", 7.8, at(9)), true},
+	}
+	for _, st := range steps {
+		accepted, rejected := s.filter(ctx, []*models.ExchangeRate{st.reading}, zap.NewNop())
+		if got := len(accepted) == 1; got != st.accepted || rejected+len(accepted) != 1 {
+			t.Fatalf("%s: accepted %d, rejected %d, want accepted %v", st.name, len(accepted), rejected, st.accepted)
+		}
+	}
+}
+
+func TestFilterBatch(t *testing.T) {
+	ctx := setup(t)
+	now := time.Now().Add(-time.Minute)
+	s := newScheduler()
+	// 同一批中的后续读数与本批已接受的读数比较
+	accepted, rejected := s.filter(ctx, []*models.ExchangeRate{
+		rate("ecb", "USD/CNY", 7.0, now),
+		rate("ecb", "USD/CNY", 7.2, now.Add(time.Second)),
+		rate("ecb", "USD/CNY", 9.9, now.Add(2*time.Second)),
+	}, zap.NewNop())
+	if len(accepted) != 2 || rejected != 1 {
+		t.Fatalf("accepted %d, rejected %d; want 2 and 1", len(accepted), rejected)
+	}
+}
+
+func TestStartElectsAndWrites(t *testing.T) {
+	ctx := setup(t)
+	_, stop := redistest.Start()
+	defer stop()
+	at := time.Now().Add(-time.Minute).Truncate(time.Second)
+	p := &fakeProvider{name: "ecb", rates: func() []*models.ExchangeRate {
+		return []*models.ExchangeRate{rate("ecb", "USD/CNY", 7.1, at)}
+	}}
+	s := newScheduler(p)
+	s.Start(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		latest, err := mysql.GetLatestExchangeRate(ctx, "USD", "CNY")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if latest != nil {
+			if latest.Rate != 7.1 || latest.Source != "ecb" {
+				t.Errorf("latest = %+v", latest)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("scheduler did not write any rate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Stop()
+	// 当选leader后写入带上防护令牌
+	var fence int64
+	if err := mysql.DB().GetContext(ctx, &fence, `SELECT fence FROM write_fences WHERE name = 'exchange_rates'`); err != nil || fence < 1 {
+		t.Errorf("fence = %d, %v; want a leader fencing token", fence, err)
+	}
+	if n := p.fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+}
+
+func TestHandleIngestJob(t *testing.T) {
+	setup(t)
+	at := time.Now().Add(-time.Minute).Truncate(time.Second)
+	ecb := &fakeProvider{name: "ecb", rates: func() []*models.ExchangeRate { return []*models.ExchangeRate{rate("ecb", "USD/CNY", 7.1, at)} }}
+	boc := &fakeProvider{name: "boc", rates: func() []*models.ExchangeRate { return []*models.ExchangeRate{rate("boc", "USD/CNY", 7.1, at)} }}
+	s := newScheduler(ecb, boc)
+	tests := []struct {
+		name     string
+		payload  string
+		ecb, boc int32 // 执行后两个数据源累计的拉取次数
+		wantErr  bool
+	}{
+		{"one provider", `{"provider":"boc"}`, 0, 1, false},
+		{"all providers", `{}`, 1, 2, false},
+		{"unknown provider", `{"provider":"fed"}`, 1, 2, true},
+		{"bad payload", `[`, 1, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.HandleIngestJob(context.Background(), &jobs.Job{Payload: []byte(tt.payload)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if ecb.fetches.Load() != tt.ecb || boc.fetches.Load() != tt.boc {
+				t.Errorf("fetches = %d/%d, want %d/%d", ecb.fetches.Load(), boc.fetches.Load(), tt.ecb, tt.boc)
+			}
+		})
+	}
+}
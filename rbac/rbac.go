@@ -0,0 +1,325 @@
+// Package rbac 基于角色的访问控制。角色、权限和绑定保存在数据库中，
+// 每个实例在内存中保存一份快照用于鉴权，数据变更后本实例立即重新加载，
+// 并通过redis广播通知其他实例；另有定时刷新兜底，错过广播的实例最多延迟一个刷新周期
+package rbac
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/dao/redis"
+	"web_app/models"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// changedChannel 广播权限数据变更的频道
+	changedChannel  = "rbac:changed"
+	refreshInterval = time.Minute
+	loadTimeout     = 5 * time.Second
+)
+
+// resubscribeInterval 检查变更订阅是否需要重建的间隔
+var resubscribeInterval = 5 * time.Second
+
+var (
+	// ErrInvalidName 角色或权限名称不合法
+	ErrInvalidName = errors.New("rbac: invalid name")
+
+	roleNameRe       = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+	permissionNameRe = regexp.MustCompile(`^(\*|[a-z0-9_-]+(:[a-z0-9_-]+)*(:\*)?)$`)
+)
+
+// snapshot 某一时刻的全部授权数据，加载后只读
+type snapshot struct {
+	grants   map[string][]string // 角色 -> 权限
+	bindings map[string][]string // 主体 -> 角色，按名称排序
+	loadedAt time.Time
+}
+
+var (
+	current atomic.Pointer[snapshot]
+
+	stop     context.CancelFunc
+	wg       sync.WaitGroup
+	startMu  sync.Mutex
+	hookOnce sync.Once
+)
+
+// Start 加载授权数据，订阅变更广播并启动定时刷新。首次加载失败不影响启动，
+// 加载成功前所有鉴权都会被拒绝
+func Start() {
+	startMu.Lock()
+	defer startMu.Unlock()
+	if stop != nil {
+		return
+	}
+	hookOnce.Do(func() {
+		mysql.OnWrite("rbac", func(ctx context.Context, _ []string) {
+			reload(context.WithoutCancel(ctx))
+			if redis.Rdb() == nil {
+				return
+			}
+			if err := redis.Rdb().Publish(ctx, changedChannel, "1"); err != nil {
+				zap.L().Warn("广播权限变更失败", zap.Error(err))
+			}
+		})
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	stop = cancel
+	reload(ctx)
+
+	var sub subscriber
+	sub.ensure()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer sub.close()
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		retry := time.NewTicker(resubscribeInterval)
+		defer retry.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reload(ctx)
+			case <-retry.C:
+				// 订阅断开期间错过的广播由重新加载补上
+				if sub.ensure() {
+					reload(ctx)
+				}
+			case _, ok := <-sub.changed:
+				if !ok {
+					// 客户端被关闭或重连，等下一次检查时重新订阅
+					sub.close()
+					continue
+				}
+				reload(ctx)
+			}
+		}
+	}()
+}
+
+// subscriber 变更广播的订阅，跟随当前的redis客户端：启动时redis不可用、
+// 重连后换了客户端或订阅通道被关闭，都会在下一次检查时重新订阅
+type subscriber struct {
+	store   redis.Store
+	sub     redis.Subscription
+	changed <-chan *redis.Message // 未订阅时为 nil，读取会一直阻塞
+}
+
+// ensure 没有订阅或redis客户端已经更换时重新订阅，返回是否建立了新的订阅
+func (s *subscriber) ensure() bool {
+	store := redis.Rdb()
+	if store == nil || (store == s.store && s.sub != nil) {
+		return false
+	}
+	s.close()
+	s.store = store
+	s.sub = store.Subscribe(changedChannel)
+	s.changed = s.sub.Channel()
+	return true
+}
+
+func (s *subscriber) close() {
+	if s.sub != nil {
+		s.sub.Close()
+	}
+	s.sub = nil
+	s.changed = nil
+}
+
+// Stop 停止定时刷新和广播订阅
+func Stop() {
+	startMu.Lock()
+	defer startMu.Unlock()
+	if stop == nil {
+		return
+	}
+	stop()
+	wg.Wait()
+	stop = nil
+}
+
+// reload 从主库重新加载授权数据，失败时保留原快照
+func reload(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(mysql.WithPrimary(ctx), loadTimeout)
+	defer cancel()
+	roles, err := mysql.ListRoles(ctx)
+	if err != nil {
+		zap.L().Error("加载角色失败", zap.Error(err))
+		return
+	}
+	bindings, err := mysql.ListRoleBindings(ctx, "")
+	if err != nil {
+		zap.L().Error("加载角色绑定失败", zap.Error(err))
+		return
+	}
+	s := &snapshot{
+		grants:   make(map[string][]string, len(roles)),
+		bindings: make(map[string][]string),
+		loadedAt: time.Now(),
+	}
+	for _, r := range roles {
+		s.grants[r.Name] = r.Permissions
+	}
+	for _, b := range bindings {
+		s.bindings[b.Subject] = append(s.bindings[b.Subject], b.Role)
+	}
+	current.Store(s)
+}
+
+// Decision 鉴权结果及原因
+type Decision struct {
+	Subject    string   `json:"subject"`
+	Permission string   `json:"permission"`
+	Allowed    bool     `json:"allowed"`
+	Reason     string   `json:"reason"`
+	Roles      []string `json:"roles"` // 主体绑定的角色
+	// GrantedBy 允许时为授予权限的角色和该角色上匹配的权限，例如 editor 的 articles:*
+	GrantedBy *Grant `json:"granted_by,omitempty"`
+	// Candidates 拥有该权限的角色，拒绝时为主体绑定其中之一即可获得权限
+	Candidates []string  `json:"candidates,omitempty"`
+	LoadedAt   time.Time `json:"loaded_at"` // 所依据的授权数据的加载时间
+}
+
+// Grant 角色上的一条权限
+type Grant struct {
+	Role       string `json:"role"`
+	Permission string `json:"permission"`
+}
+
+// Check 判断主体是否拥有权限，结果中说明允许或拒绝的原因
+func Check(subject, permission string) *Decision {
+	d := &Decision{Subject: subject, Permission: permission, Roles: []string{}}
+	s := current.Load()
+	if s == nil {
+		d.Reason = "authorization data not loaded"
+		return d
+	}
+	d.LoadedAt = s.loadedAt
+	if roles := s.bindings[subject]; roles != nil {
+		d.Roles = roles
+	}
+	for _, role := range d.Roles {
+		if grant, ok := s.match(role, permission); ok {
+			d.Allowed = true
+			d.GrantedBy = &Grant{Role: role, Permission: grant}
+			d.Reason = "role " + role + " grants " + grant
+			return d
+		}
+	}
+	for role := range s.grants {
+		if _, ok := s.match(role, permission); ok {
+			d.Candidates = append(d.Candidates, role)
+		}
+	}
+	sort.Strings(d.Candidates)
+	switch {
+	case len(d.Roles) == 0:
+		d.Reason = "subject has no roles"
+	case len(d.Candidates) == 0:
+		d.Reason = "no role grants " + permission
+	default:
+		d.Reason = "none of the subject's roles grant " + permission
+	}
+	return d
+}
+
+// match 返回角色上匹配 permission 的权限
+func (s *snapshot) match(role, permission string) (string, bool) {
+	for _, grant := range s.grants[role] {
+		if Matches(grant, permission) {
+			return grant, true
+		}
+	}
+	return "", false
+}
+
+// Matches 判断已授予的权限是否包含 permission：* 包含所有权限，articles:* 包含 articles: 开头的权限
+func Matches(grant, permission string) bool {
+	if grant == permission || grant == "*" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(grant, "*"); ok && strings.HasSuffix(prefix, ":") {
+		return strings.HasPrefix(permission, prefix)
+	}
+	return false
+}
+
+// Roles 所有角色及其权限
+func Roles(ctx context.Context) ([]*models.Role, error) {
+	return mysql.ListRoles(ctx)
+}
+
+// Permissions 所有权限
+func Permissions(ctx context.Context) ([]*models.Permission, error) {
+	return mysql.ListPermissions(ctx)
+}
+
+// SubjectRoles 主体绑定的角色
+func SubjectRoles(ctx context.Context, subject string) ([]*models.RoleBinding, error) {
+	return mysql.ListRoleBindings(ctx, subject)
+}
+
+// CreatePermission 新增权限
+func CreatePermission(ctx context.Context, p *models.Permission) error {
+	if !ValidPermission(p.Name) {
+		return ErrInvalidName
+	}
+	return mysql.CreatePermission(ctx, p)
+}
+
+// CreateRole 新增角色，Permissions 中不存在的权限会自动创建
+func CreateRole(ctx context.Context, role *models.Role) error {
+	if !roleNameRe.MatchString(role.Name) || !validPermissions(role.Permissions) {
+		return ErrInvalidName
+	}
+	return mysql.CreateRole(ctx, role)
+}
+
+// SetRolePermissions 替换角色的全部权限
+func SetRolePermissions(ctx context.Context, role string, perms []string) error {
+	if !validPermissions(perms) {
+		return ErrInvalidName
+	}
+	return mysql.SetRolePermissions(ctx, role, perms)
+}
+
+// DeleteRole 删除角色及其绑定
+func DeleteRole(ctx context.Context, role string) error {
+	return mysql.DeleteRole(ctx, role)
+}
+
+// Bind 为主体绑定角色
+func Bind(ctx context.Context, subject, role string) error {
+	return mysql.BindRole(ctx, subject, role)
+}
+
+// Unbind 解除主体与角色的绑定
+func Unbind(ctx context.Context, subject, role string) error {
+	return mysql.UnbindRole(ctx, subject, role)
+}
+
+// ValidPermission 权限名称是否合法：由冒号分隔的小写单词组成，可以以 :* 结尾，或者是单独的 *
+func ValidPermission(p string) bool {
+	return permissionNameRe.MatchString(p)
+}
+
+func validPermissions(perms []string) bool {
+	for _, p := range perms {
+		if !ValidPermission(p) {
+			return false
+		}
+	}
+	return true
+}
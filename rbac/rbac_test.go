@@ -0,0 +1,191 @@
+package rbac
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"web_app/dao/mysql"
+	"web_app/dao/redis"
+	"web_app/dao/redis/redistest"
+	"web_app/models"
+	"web_app/settings"
+)
+
+func setup(t *testing.T) context.Context {
+	t.Helper()
+	ctx := context.Background()
+	if err := mysql.Init(settings.MysqlConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "test.db")}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mysql.Close() })
+	if err := mysql.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	prev := current.Swap(nil)
+	t.Cleanup(func() { current.Store(prev) })
+	return ctx
+}
+
+func createRole(t *testing.T, ctx context.Context, name string, perms ...string) {
+	t.Helper()
+	if err := mysql.CreateRole(ctx, &models.Role{Name: name, Permissions: perms}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func bind(t *testing.T, ctx context.Context, subject, role string) {
+	t.Helper()
+	if err := mysql.BindRole(ctx, subject, role); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// bindQuietly 绕过写入钩子直接绑定角色，模拟其他实例的写入：本实例只能通过广播或定时刷新看到
+func bindQuietly(t *testing.T, ctx context.Context, subject, role string) {
+	t.Helper()
+	if _, err := mysql.DB().ExecContext(ctx,
+		`INSERT INTO role_bindings (subject, role_id) SELECT ?, id FROM roles WHERE name = ?`, subject, role); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitAllowed(t *testing.T, subject, permission string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !Check(subject, permission).Allowed {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not granted %s", subject, permission)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		grant, permission string
+		want              bool
+	}{
+		{"articles:create", "articles:create", true},
+		{"articles:create", "articles:delete", false},
+		{"*", "exchange_rates:create", true},
+		{"articles:*", "articles:create", true},
+		{"articles:*", "articles:drafts:publish", true},
+		{"articles:*", "articles", false},
+		{"articles:*", "articlesx:create", false},
+		{"articles*", "articles:create", false},
+		{"articles", "articles:create", false},
+	}
+	for _, tt := range tests {
+		if got := Matches(tt.grant, tt.permission); got != tt.want {
+			t.Errorf("Matches(%q, %q) = %v, want %v", tt.grant, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ctx := setup(t)
+	if d := Check("user:1", "articles:create"); d.Allowed || d.Reason != "authorization data not loaded" {
+		t.Fatalf("before load: %+v", d)
+	}
+	createRole(t, ctx, "editor", "articles:*")
+	createRole(t, ctx, "writer", "articles:create")
+	createRole(t, ctx, "admin", "*")
+	createRole(t, ctx, "viewer")
+	bind(t, ctx, "user:1", "editor")
+	bind(t, ctx, "user:2", "viewer")
+	bind(t, ctx, "user:3", "admin")
+	reload(ctx)
+
+	tests := []struct {
+		name       string
+		subject    string
+		permission string
+		allowed    bool
+		grantedBy  *Grant
+		candidates []string
+		reason     string
+	}{
+		{"wildcard grant", "user:1", "articles:delete", true, &Grant{"editor", "articles:*"}, nil, "role editor grants articles:*"},
+		{"admin", "user:3", "exchange_rates:create", true, &Grant{"admin", "*"}, nil, "role admin grants *"},
+		{"role without grant", "user:2", "articles:create", false, nil, []string{"admin", "editor", "writer"}, "none of the subject's roles grant articles:create"},
+		{"no roles", "user:9", "articles:delete", false, nil, []string{"admin", "editor"}, "subject has no roles"},
+		{"only admin grants", "user:1", "exchange_rates:create", false, nil, []string{"admin"}, "none of the subject's roles grant exchange_rates:create"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Check(tt.subject, tt.permission)
+			if d.Allowed != tt.allowed || d.Reason != tt.reason {
+				t.Errorf("allowed = %v (%s), want %v (%s)", d.Allowed, d.Reason, tt.allowed, tt.reason)
+			}
+			if !reflect.DeepEqual(d.GrantedBy, tt.grantedBy) {
+				t.Errorf("granted by = %+v, want %+v", d.GrantedBy, tt.grantedBy)
+			}
+			if !reflect.DeepEqual(d.Candidates, tt.candidates) {
+				t.Errorf("candidates = %v, want %v", d.Candidates, tt.candidates)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	ctx := setup(t)
+	createRole(t, ctx, "writer", "articles:create")
+	bindQuietly(t, ctx, "user:1", "writer")
+	if Check("user:1", "articles:create").Allowed {
+		t.Fatal("allowed before reload")
+	}
+	reload(ctx)
+	if !Check("user:1", "articles:create").Allowed {
+		t.Fatal("not allowed after reload")
+	}
+
+	// 加载失败时保留原快照
+	loaded := current.Load()
+	mysql.Close()
+	reload(ctx)
+	if current.Load() != loaded {
+		t.Fatal("snapshot replaced after a failed reload")
+	}
+	if !Check("user:1", "articles:create").Allowed {
+		t.Fatal("not allowed after a failed reload")
+	}
+}
+
+func TestStartResubscribes(t *testing.T) {
+	ctx := setup(t)
+	prevInterval := resubscribeInterval
+	resubscribeInterval = 10 * time.Millisecond
+	t.Cleanup(func() { resubscribeInterval = prevInterval })
+	restore := redis.Use(nil)
+	t.Cleanup(restore)
+	createRole(t, ctx, "writer", "articles:create")
+
+	// 启动时redis不可用
+	Start()
+	t.Cleanup(Stop)
+	first := redistest.New()
+	defer first.Close()
+	redis.Use(first)
+	bindQuietly(t, ctx, "user:1", "writer")
+	waitAllowed(t, "user:1", "articles:create")
+	bindQuietly(t, ctx, "user:2", "writer")
+	if err := first.Publish(ctx, changedChannel, "1"); err != nil {
+		t.Fatal(err)
+	}
+	waitAllowed(t, "user:2", "articles:create")
+
+	// 重连后换了客户端，旧客户端的订阅通道被关闭
+	second := redistest.New()
+	defer second.Close()
+	redis.Use(second)
+	first.Close()
+	bindQuietly(t, ctx, "user:3", "writer")
+	waitAllowed(t, "user:3", "articles:create")
+	bindQuietly(t, ctx, "user:4", "writer")
+	if err := second.Publish(ctx, changedChannel, "1"); err != nil {
+		t.Fatal(err)
+	}
+	waitAllowed(t, "user:4", "articles:create")
+}
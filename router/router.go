@@ -2,12 +2,13 @@ package router
 
 import (
 	"log"
-	"time"
-	"web_app/controllers"
 	"web_app/logger"
+	"web_app/middleware"
+	"web_app/openapi"
+	"web_app/settings"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 func SetRouters() *gin.Engine {
@@ -22,61 +23,29 @@ func SetRouters() *gin.Engine {
 	gin.DefaultErrorWriter = logger.GetGinWriter() // 重定向Gin的错误日志
 	gin.SetMode(gin.ReleaseMode)                   //设置为生产环境，减少日志输出
 	r := gin.New()
-	r.Use(logger.GinLogger(), logger.GinRecovery(true))
-	r.Use(cors.New(cors.Config{
-		//前端地址
-		AllowOrigins:     []string{"http://localhost:5173"},
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
-	apiV1 := r.Group("/api/v1")
-	//括号可以省略，为了区分路由，留下
-	{
-		//路径参数 GET /get/123
-		apiV1.GET("/get/a/:id", controllers.TestFunc1)
-		//查询参数 GET /get?page=2&size=10
-		apiV1.GET("/get", controllers.TestFunc2)
-		//文件下载 GET /get/download/web_app.log
-		apiV1.GET("/get/download/:filename", controllers.Download)
+	//gin 默认信任所有代理，客户端可以伪造 X-Forwarded-For 绕过按IP的限流和登录锁定，只信任配置的代理
+	if err := r.SetTrustedProxies(settings.Config().SecurityConfig.TrustedProxies); err != nil {
+		zap.L().Error("可信代理配置不正确，不信任任何代理", zap.Strings("trusted_proxies", settings.Config().SecurityConfig.TrustedProxies), zap.Error(err))
+		r.SetTrustedProxies(nil)
 	}
-	{
-		//路径参数 POST /post/123
-		apiV1.POST("/post/a/:id", controllers.TestFunc1)
-		//查询参数 POST /post?page=2&size=10
-		apiV1.POST("/post", controllers.TestFunc2)
-		//JSON参数 POST
-		apiV1.POST("/post/json", controllers.TestFunc3)
-		//表单参数 POST
-		apiV1.POST("/post/form", controllers.TestFunc4)
-		//单文件上传
-		apiV1.POST("/post/upload", controllers.TestFunc5)
-		//多文件上传
-		apiV1.POST("/post/uploadFiles", controllers.TestMultiFileUpload)
-		//二进制文件
-		apiV1.POST("/post/bin", controllers.TestFunc6)
-	}
-	{
-		//路径参数 PUT /put/123
-		apiV1.PUT("/put/a/:id", controllers.TestFunc4)
-		//JSON参数 PUT
-		apiV1.PUT("/put/json", controllers.TestFunc3)
-	}
-	{
-		//路径参数 DELETE  /delete/123
-		apiV1.DELETE("/delete/:id", controllers.TestFunc4)
-	}
-	apiV2 := r.Group("/api/v2")
-	apiV2.GET("/getExchangeRates", controllers.TestFunc4)
-	{
-		apiV2.POST("/createExchangeRate", controllers.TestFunc4)
-		apiV2.POST("/articles", controllers.TestFunc4)
-		apiV2.GET("/articles", controllers.TestFunc4)
-		apiV2.GET("/articles/:id", controllers.TestFunc4)
-		apiV2.POST("/articles/:id/like", controllers.TestFunc4)
-		apiV2.GET("/articles/:id/like", controllers.TestFunc4)
+	r.Use(logger.GinRequestID(), logger.GinLogger(), logger.GinRecovery(true))
+	//跨域策略来自配置文件，可以按路由组覆盖，修改后热加载生效
+	r.Use(middleware.CORS())
+	//路由在 routes.go 中声明，接口文档由同一份声明生成
+	groups := routeGroups()
+	//按用户或API Key限流的路由组要等认证之后才能计数，没有认证的请求在处理函数之前按IP补上
+	for i := range groups {
+		for j := range groups[i].Routes {
+			rt := &groups[i].Routes[j]
+			rt.Middleware = append(rt.Middleware[:len(rt.Middleware):len(rt.Middleware)], middleware.RateLimitFallback())
+		}
 	}
+	openapi.Mount(r, groups...)
+	doc := openapi.Build(openapi.Info{
+		Title:   settings.Config().Name,
+		Version: settings.Config().Version,
+	}, securitySchemes, groups...)
+	r.GET("/openapi.json", openapi.Handler(doc))
+	r.GET("/docs", openapi.UIHandler(settings.Config().Name, "/openapi.json"))
 	return r
 }
@@ -0,0 +1,317 @@
+package router
+
+import (
+	"net/http"
+	"time"
+	"web_app/auth"
+	"web_app/captcha"
+	"web_app/controllers"
+	"web_app/deps"
+	"web_app/metrics"
+	"web_app/middleware"
+	"web_app/models"
+	"web_app/openapi"
+	"web_app/query"
+	"web_app/rates"
+	"web_app/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+// securitySchemes 文档中的认证方式，路由通过 Security 字段引用
+var securitySchemes = map[string]*openapi.SecurityScheme{
+	"admin_token": {Type: "apiKey", In: "header", Name: middleware.AdminTokenHeader, Description: "管理接口令牌"},
+	"bearer":      {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "访问令牌"},
+	"session":     {Type: "apiKey", In: "cookie", Name: "sid", Description: "浏览器会话，cookie名称可配置"},
+	"api_key": {Type: "apiKey", In: "header", Name: middleware.APIKeyHeader,
+		Description: "服务端调用方的API Key，同时需要 X-Timestamp、X-Nonce 和 X-Signature 签名请求头"},
+}
+
+// routeGroups 所有路由的声明
+func routeGroups() []openapi.Group {
+	return []openapi.Group{
+		{
+			Tags: []string{"运维"},
+			Routes: []openapi.Route{
+				//健康检查，供负载均衡探测
+				{Method: http.MethodGet, Path: "/healthz", Handler: controllers.Healthz, Summary: "存活探针"},
+				{Method: http.MethodGet, Path: "/readyz", Handler: controllers.Readyz, Summary: "就绪探针",
+					Description: "关机中或必需依赖不可用时返回503"},
+				{Method: http.MethodGet, Path: "/health/details", Handler: controllers.HealthDetails,
+					Middleware: []gin.HandlerFunc{middleware.AdminOnly()}, Security: []string{"admin_token"},
+					Summary: "依赖状态详情", Description: "各依赖的延迟、连接池统计、版本和运行时长"},
+				//运行指标，包括数据库连接池统计，抓取时需要带上管理员令牌
+				{Method: http.MethodGet, Path: "/metrics", Handler: gin.WrapH(metrics.Handler()),
+					Middleware: []gin.HandlerFunc{middleware.AdminOnly()}, Hidden: true},
+				{Method: http.MethodGet, Path: "/.well-known/jwks.json", Handler: controllers.JWKS, Summary: "令牌签名公钥",
+					Response: auth.JWKSet{}},
+			},
+		},
+		{
+			Prefix:     "/api/v1/auth",
+			Middleware: []gin.HandlerFunc{middleware.RateLimit("auth")},
+			Tags:       []string{"认证"},
+			Routes:     authRoutes(),
+		},
+		{
+			Prefix:     "/api/v1/account",
+			Middleware: []gin.HandlerFunc{middleware.RateLimit("account"), deps.Require(deps.MySQL)},
+			Tags:       []string{"账号"},
+			Routes:     accountRoutes(),
+		},
+		{
+			Prefix:     "/api/v1/sessions",
+			Middleware: []gin.HandlerFunc{middleware.RateLimit("account")},
+			Tags:       []string{"会话"},
+			Routes:     sessionRoutes(),
+		},
+		{
+			Prefix:     "/api/v1/rbac",
+			Middleware: []gin.HandlerFunc{middleware.AdminOnly(), deps.Require(deps.MySQL)},
+			Tags:       []string{"权限"},
+			Security:   []string{"admin_token"},
+			Routes:     rbacRoutes(),
+		},
+		{
+			Prefix:     "/api/v1/api-keys",
+			Middleware: []gin.HandlerFunc{middleware.AdminOnly(), deps.Require(deps.MySQL)},
+			Tags:       []string{"API Key"},
+			Security:   []string{"admin_token"},
+			Routes: []openapi.Route{
+				{Method: http.MethodPost, Path: "", Handler: controllers.IssueAPIKey, Summary: "签发API Key",
+					Description: "密钥只在响应中出现一次", Request: controllers.IssueAPIKeyRequest{},
+					Response: controllers.IssueAPIKeyResponse{}, Status: http.StatusCreated},
+				{Method: http.MethodGet, Path: "", Handler: controllers.ListAPIKeys, Summary: "API Key列表",
+					Response: []models.APIKey{}},
+				{Method: http.MethodDelete, Path: "/:key_id", Handler: controllers.RevokeAPIKey, Summary: "吊销API Key",
+					Status: http.StatusNoContent},
+			},
+		},
+		{
+			Prefix:     "/api/v1",
+			Middleware: []gin.HandlerFunc{middleware.RateLimit("api_v1")},
+			Tags:       []string{"示例"},
+			Routes:     apiV1Routes(),
+		},
+		{
+			//汇率和文章都依赖mysql，降级模式下返回503
+			Prefix:     "/api/v2",
+			Middleware: []gin.HandlerFunc{middleware.RateLimit("api_v2"), deps.Require(deps.MySQL)},
+			Routes:     apiV2Routes(),
+		},
+	}
+}
+
+// authRoutes 令牌的签发、刷新和吊销
+func authRoutes() []openapi.Route {
+	return []openapi.Route{
+		{Method: http.MethodPost, Path: "/token", Handler: controllers.IssueToken,
+			Middleware: []gin.HandlerFunc{middleware.AdminOnly()}, Security: []string{"admin_token"},
+			Summary: "为指定用户签发令牌", Description: "供调试和内部服务使用",
+			Request: controllers.IssueTokenRequest{}, Response: auth.TokenPair{}},
+		{Method: http.MethodPost, Path: "/refresh", Handler: controllers.RefreshToken, Summary: "刷新令牌",
+			Description: "旧的刷新令牌随即失效；已轮换的刷新令牌再次使用时吊销整个令牌族",
+			Request:     controllers.RefreshTokenRequest{}, Response: auth.TokenPair{}},
+		{Method: http.MethodPost, Path: "/logout", Handler: controllers.Logout,
+			Middleware: []gin.HandlerFunc{middleware.Auth()}, Security: []string{"bearer"},
+			Summary: "退出登录", Description: "吊销当前访问令牌和同一次登录的刷新令牌", Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: "/me", Handler: controllers.Me,
+			Middleware: []gin.HandlerFunc{middleware.Auth()}, Security: []string{"bearer"},
+			Summary: "当前令牌的声明", Response: controllers.MeResponse{}},
+	}
+}
+
+// accountRoutes 注册、登录、邮箱验证和两步验证
+func accountRoutes() []openapi.Route {
+	return []openapi.Route{
+		{Method: http.MethodPost, Path: "/register", Handler: controllers.Register, Summary: "注册",
+			Description: "用户名和邮箱不区分大小写，注册后向邮箱发送验证邮件",
+			Request:     controllers.RegisterRequest{}, Response: models.User{}, Status: http.StatusCreated},
+		{Method: http.MethodPost, Path: "/login", Handler: controllers.Login, Summary: "登录",
+			Description: "用户名或邮箱均可登录", Request: controllers.LoginRequest{}, Response: controllers.LoginResponse{}},
+		{Method: http.MethodPost, Path: "/logout", Handler: controllers.Logout,
+			Middleware: []gin.HandlerFunc{middleware.Auth()}, Security: []string{"bearer"},
+			Summary: "退出登录", Description: "吊销当前访问令牌和同一次登录的刷新令牌", Status: http.StatusNoContent},
+		{Method: http.MethodPost, Path: "/verify-email", Handler: controllers.VerifyEmail, Summary: "验证邮箱",
+			Request: controllers.VerifyEmailRequest{}, Response: models.User{}},
+		{Method: http.MethodPost, Path: "/verify-email/resend", Handler: controllers.ResendVerification,
+			Middleware: []gin.HandlerFunc{middleware.Auth()}, Security: []string{"bearer"},
+			Summary: "重新发送验证邮件", Description: "之前发出的验证链接随即失效", Status: http.StatusAccepted},
+		{Method: http.MethodGet, Path: "/profile", Handler: controllers.Profile,
+			Middleware: []gin.HandlerFunc{middleware.Auth()}, Security: []string{"bearer"},
+			Summary: "当前账号", Response: models.User{}},
+		{Method: http.MethodPost, Path: "/captcha", Handler: controllers.NewCaptcha, Summary: "获取图片验证码",
+			Description: "失败次数较多后登录和注册需要验证码，验证码使用一次即作废",
+			Response:    captcha.Captcha{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: "/totp", Handler: controllers.TOTPStatus,
+			Middleware: []gin.HandlerFunc{middleware.Auth()}, Security: []string{"bearer"},
+			Summary: "两步验证状态", Response: models.TOTPStatus{}},
+		{Method: http.MethodPost, Path: "/totp", Handler: controllers.EnrollTOTP,
+			Middleware: []gin.HandlerFunc{middleware.Auth()}, Security: []string{"bearer"},
+			Summary: "发起两步验证绑定", Description: "确认之前不影响登录，重复发起会替换未确认的密钥",
+			Response: controllers.EnrollTOTPResponse{}, Status: http.StatusCreated},
+		{Method: http.MethodPost, Path: "/totp/confirm", Handler: controllers.ConfirmTOTP,
+			Middleware: []gin.HandlerFunc{middleware.Auth()}, Security: []string{"bearer"},
+			Summary: "确认绑定并开启两步验证", Description: "返回的恢复码只出现这一次",
+			Request: controllers.ConfirmTOTPRequest{}, Response: controllers.RecoveryCodesResponse{}},
+		{Method: http.MethodDelete, Path: "/totp", Handler: controllers.DisableTOTP,
+			Middleware: []gin.HandlerFunc{middleware.Auth()}, Security: []string{"bearer"},
+			Summary: "关闭两步验证", Request: controllers.DisableTOTPRequest{}, Status: http.StatusNoContent},
+		{Method: http.MethodPost, Path: "/recovery-codes", Handler: controllers.RegenerateRecoveryCodes,
+			Middleware: []gin.HandlerFunc{middleware.Auth()}, Security: []string{"bearer"},
+			Summary: "重新生成恢复码", Description: "之前的恢复码全部失效",
+			Request: controllers.ConfirmTOTPRequest{}, Response: controllers.RecoveryCodesResponse{}},
+	}
+}
+
+// sessionRoutes 浏览器会话的登录、查询和吊销
+func sessionRoutes() []openapi.Route {
+	return []openapi.Route{
+		{Method: http.MethodPost, Path: "", Handler: controllers.SessionLogin,
+			Middleware: []gin.HandlerFunc{middleware.SameOrigin(), deps.Require(deps.MySQL)}, Summary: "登录并创建会话",
+			Description: "会话ID通过 HttpOnly cookie 返回", Request: controllers.LoginRequest{},
+			Response: controllers.SessionLoginResponse{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: "", Handler: controllers.ListSessions,
+			Middleware: []gin.HandlerFunc{middleware.Session()}, Security: []string{"session"},
+			Summary: "当前用户的会话和设备", Response: []models.Session{}},
+		{Method: http.MethodDelete, Path: "", Handler: controllers.SignOutEverywhere,
+			Middleware: []gin.HandlerFunc{middleware.Session()}, Security: []string{"session"},
+			Summary: "在所有设备上退出登录", Description: "吊销全部会话，以及此前签发的访问令牌和刷新令牌",
+			Response: controllers.SignOutEverywhereResponse{}},
+		{Method: http.MethodDelete, Path: "/current", Handler: controllers.SessionLogout,
+			Middleware: []gin.HandlerFunc{middleware.Session()}, Security: []string{"session"},
+			Summary: "退出当前会话", Status: http.StatusNoContent},
+		{Method: http.MethodDelete, Path: "/:id", Handler: controllers.RevokeSession,
+			Middleware: []gin.HandlerFunc{middleware.Session()}, Security: []string{"session"},
+			Summary: "吊销指定会话", Description: "id 为会话列表中的 id", Status: http.StatusNoContent},
+	}
+}
+
+// rbacRoutes 角色、权限和绑定的管理接口
+func rbacRoutes() []openapi.Route {
+	return []openapi.Route{
+		{Method: http.MethodGet, Path: "/roles", Handler: controllers.ListRoles, Summary: "角色列表",
+			Response: []models.Role{}},
+		{Method: http.MethodPost, Path: "/roles", Handler: controllers.CreateRole, Summary: "新增角色",
+			Request: controllers.CreateRoleRequest{}, Response: models.Role{}, Status: http.StatusCreated},
+		{Method: http.MethodPut, Path: "/roles/:name/permissions", Handler: controllers.SetRolePermissions, Summary: "替换角色的权限",
+			Request: controllers.RolePermissionsRequest{}, Status: http.StatusNoContent},
+		{Method: http.MethodDelete, Path: "/roles/:name", Handler: controllers.DeleteRole, Summary: "删除角色",
+			Description: "角色的绑定一并删除", Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: "/permissions", Handler: controllers.ListPermissions, Summary: "权限列表",
+			Response: []models.Permission{}},
+		{Method: http.MethodPost, Path: "/permissions", Handler: controllers.CreatePermission, Summary: "新增权限",
+			Request: controllers.CreatePermissionRequest{}, Response: models.Permission{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: "/subjects/:subject/roles", Handler: controllers.ListSubjectRoles, Summary: "用户的角色",
+			Response: []models.RoleBinding{}},
+		{Method: http.MethodPut, Path: "/subjects/:subject/roles/:role", Handler: controllers.BindRole, Summary: "绑定角色",
+			Status: http.StatusNoContent},
+		{Method: http.MethodDelete, Path: "/subjects/:subject/roles/:role", Handler: controllers.UnbindRole, Summary: "解除角色绑定",
+			Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: "/explain", Handler: controllers.ExplainAccess, Summary: "说明鉴权结果",
+			Request: controllers.ExplainRequest{}, Response: rbac.Decision{},
+			Description: "用户是否拥有权限、由哪个角色授予，或者为什么被拒绝以及哪些角色拥有该权限"},
+	}
+}
+
+// apiV1Routes 演示各种传参方式的示例接口
+func apiV1Routes() []openapi.Route {
+	return []openapi.Route{
+		//路径参数 GET /get/a/123
+		{Method: http.MethodGet, Path: "/get/a/:id", Handler: controllers.TestFunc1, Summary: "路径参数"},
+		//查询参数 GET /get?page=2&size=10
+		{Method: http.MethodGet, Path: "/get", Handler: controllers.TestFunc2, Summary: "查询参数"},
+		//文件下载 GET /get/download/web_app.log
+		{Method: http.MethodGet, Path: "/get/download/:filename", Handler: controllers.Download, Summary: "文件下载"},
+		{Method: http.MethodGet, Path: "/path/:id", Handler: controllers.TestGetPathParam, Summary: "路径参数"},
+		{Method: http.MethodGet, Path: "/query", Handler: controllers.TestGetQuery, Summary: "带默认值的查询参数",
+			Request: controllers.GetQueryRequest{}},
+		{Method: http.MethodGet, Path: "/query/struct", Handler: controllers.TestGetQueryStruct, Summary: "查询参数绑定到结构体",
+			Request: controllers.GetQueryStructRequest{}},
+		{Method: http.MethodGet, Path: "/query-struct", Handler: controllers.TestQueryStructBinding, Summary: "查询参数绑定到结构体",
+			Request: controllers.QueryStructBindingRequest{}},
+		{Method: http.MethodGet, Path: "/uri-struct/:name/:age", Handler: controllers.TestURIStructBinding, Summary: "路径参数绑定到结构体",
+			Request: controllers.URIStructBindingRequest{}},
+		{Method: http.MethodGet, Path: "/header", Handler: controllers.TestHeaderParams, Summary: "请求头参数",
+			Request: controllers.HeaderParamsRequest{}},
+		{Method: http.MethodGet, Path: "/cookie", Handler: controllers.TestCookieParams, Summary: "读取Cookie",
+			Description: "读取名为 token 的Cookie"},
+		{Method: http.MethodGet, Path: "/set-cookie", Handler: controllers.TestSetCookie, Summary: "设置Cookie"},
+		{Method: http.MethodGet, Path: "/download/:filename", Handler: controllers.TestDownloadFile, Summary: "下载uploads目录中的文件"},
+		{Method: http.MethodGet, Path: "/stream", Handler: controllers.TestStreamResponse, Summary: "分块传输的流式响应"},
+		{Method: http.MethodGet, Path: "/sse", Handler: controllers.TestSSE, Summary: "服务器发送事件"},
+
+		//路径参数 POST /post/a/123
+		{Method: http.MethodPost, Path: "/post/a/:id", Handler: controllers.TestFunc1, Summary: "路径参数"},
+		//查询参数 POST /post?page=2&size=10
+		{Method: http.MethodPost, Path: "/post", Handler: controllers.TestFunc2, Summary: "查询参数"},
+		{Method: http.MethodPost, Path: "/post/json", Handler: controllers.TestFunc3, Summary: "JSON参数",
+			BodyType: "application/json"},
+		{Method: http.MethodPost, Path: "/post/form", Handler: controllers.TestFunc4, Summary: "表单Map参数",
+			Description: "表单字段形如 info[name]=xx&info[age]=20", BodyType: "application/x-www-form-urlencoded"},
+		{Method: http.MethodPost, Path: "/post/upload", Handler: controllers.TestFunc5, Summary: "单文件上传",
+			Request: controllers.SingleFileUploadRequest{}},
+		{Method: http.MethodPost, Path: "/post/uploadFiles", Handler: controllers.TestMultiFileUpload, Summary: "多文件上传",
+			Request: controllers.MultiFileUploadRequest{}},
+		{Method: http.MethodPost, Path: "/post/bin", Handler: controllers.TestFunc6, Summary: "二进制文件",
+			Description: "文件名通过 Content-Disposition 请求头传入", BodyType: "application/octet-stream"},
+		{Method: http.MethodPost, Path: "/users", Handler: controllers.TestPostJSON, Summary: "JSON绑定",
+			Request: controllers.PostJSONRequest{}},
+		{Method: http.MethodPost, Path: "/users/form", Handler: controllers.TestPostForm, Summary: "表单提交",
+			Request: controllers.PostFormRequest{}},
+		{Method: http.MethodPost, Path: "/users/form-map", Handler: controllers.TestPostFormMap, Summary: "表单Map",
+			Description: "表单字段形如 user[name]=John&user[age]=30", BodyType: "application/x-www-form-urlencoded"},
+		{Method: http.MethodPost, Path: "/form-struct", Handler: controllers.TestFormStructBinding, Summary: "表单绑定到结构体",
+			Request: controllers.FormStructBindingRequest{}},
+		{Method: http.MethodPost, Path: "/xml", Handler: controllers.TestXMLBinding, Summary: "XML绑定",
+			Request: controllers.XMLBindingRequest{}},
+		{Method: http.MethodPost, Path: "/yaml", Handler: controllers.TestYAMLBinding, Summary: "YAML绑定",
+			Request: controllers.YAMLBindingRequest{}},
+		{Method: http.MethodPost, Path: "/raw-body", Handler: controllers.TestRawBody, Summary: "原始请求体",
+			BodyType: "text/plain"},
+
+		//路径参数 PUT /put/a/123
+		{Method: http.MethodPut, Path: "/put/a/:id", Handler: controllers.TestFunc4, Summary: "路径参数"},
+		{Method: http.MethodPut, Path: "/put/json", Handler: controllers.TestFunc3, Summary: "JSON参数",
+			BodyType: "application/json"},
+
+		//路径参数 DELETE /delete/123
+		{Method: http.MethodDelete, Path: "/delete/:id", Handler: controllers.TestFunc4, Summary: "路径参数"},
+	}
+}
+
+// apiV2Routes 汇率和文章接口
+func apiV2Routes() []openapi.Route {
+	rateTags := []string{"汇率"}
+	articleTags := []string{"文章"}
+	return []openapi.Route{
+		{Method: http.MethodGet, Path: "/getExchangeRates", Handler: controllers.GetExchangeRates, Tags: rateTags,
+			Summary: "汇率列表", Description: "支持过滤、排序、字段选择，以及页码或游标分页",
+			Request: query.Params{}, Response: query.Page{}},
+		{Method: http.MethodGet, Path: "/getLatestExchangeRate", Handler: controllers.GetLatestExchangeRate, Tags: rateTags,
+			Summary: "货币对的最新汇率", Request: controllers.LatestExchangeRateRequest{}, Response: models.ExchangeRate{}},
+		{Method: http.MethodPost, Path: "/refreshExchangeRates", Handler: controllers.RefreshExchangeRates, Tags: rateTags,
+			Middleware: []gin.HandlerFunc{middleware.AdminOnly()}, Security: []string{"admin_token"},
+			Summary: "立即拉取汇率", Description: "在后台任务中执行，provider 为空时拉取所有数据源",
+			Request: rates.IngestPayload{}, Response: controllers.JobResponse{}, Status: http.StatusAccepted},
+		//客户端超时重试时带上 Idempotency-Key，避免重复创建
+		{Method: http.MethodPost, Path: "/createExchangeRate", Handler: controllers.TestFunc4, Tags: rateTags,
+			Middleware: requirePermission("exchange_rates:create", middleware.Idempotency(24*time.Hour)), Security: []string{"bearer", "session", "api_key"},
+			Summary: "创建汇率", Description: "需要 exchange_rates:create 权限"},
+		{Method: http.MethodPost, Path: "/articles", Handler: controllers.TestFunc4, Tags: articleTags,
+			Middleware: requirePermission("articles:create", middleware.Idempotency(time.Hour)), Security: []string{"bearer", "session", "api_key"},
+			Summary: "创建文章", Description: "需要 articles:create 权限"},
+		{Method: http.MethodDelete, Path: "/articles/:id", Handler: controllers.TestFunc4, Tags: articleTags,
+			Middleware: requirePermission("articles:delete"), Security: []string{"bearer", "session", "api_key"},
+			Summary: "删除文章", Description: "需要 articles:delete 权限"},
+		{Method: http.MethodGet, Path: "/articles", Handler: controllers.TestFunc4, Tags: articleTags, Summary: "文章列表"},
+		{Method: http.MethodGet, Path: "/articles/:id", Handler: controllers.TestFunc4, Tags: articleTags, Summary: "文章详情"},
+		{Method: http.MethodPost, Path: "/articles/:id/like", Handler: controllers.TestFunc4, Tags: articleTags, Summary: "点赞"},
+		{Method: http.MethodGet, Path: "/articles/:id/like", Handler: controllers.TestFunc4, Tags: articleTags, Summary: "点赞数"},
+	}
+}
+
+// requirePermission 要求登录用户或签名的API Key拥有权限，next 在鉴权通过后执行
+func requirePermission(permission string, next ...gin.HandlerFunc) []gin.HandlerFunc {
+	return append([]gin.HandlerFunc{middleware.Authenticate(), middleware.Require(permission)}, next...)
+}
@@ -0,0 +1,212 @@
+// Package session 浏览器使用的服务端会话。会话ID放在签名的 HttpOnly cookie 中，
+// 会话数据保存在redis，闲置超时随访问顺延，另有自创建起的最长有效期。
+//
+// redis 中的会话以会话ID的哈希为键，列出会话时展示的也是哈希，
+// 前端脚本拿不到cookie中的会话ID，吊销接口也无法被用来冒充会话
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"web_app/dao/redis"
+	"web_app/models"
+	"web_app/settings"
+)
+
+const (
+	defaultCookieName  = "sid"
+	defaultIdleTimeout = 24 * time.Hour
+	defaultMaxLifetime = 720 * time.Hour
+	// touchInterval 距上次续期不足该时长的访问不再续期，减少redis写入
+	touchInterval = time.Minute
+)
+
+var (
+	// ErrNoSecret 没有配置可用的cookie签名密钥
+	ErrNoSecret = errors.New("session: no usable cookie secret configured")
+	// ErrInvalidSession cookie签名不正确，或会话不存在、已过期、已吊销
+	ErrInvalidSession = errors.New("session: invalid or expired session")
+	// ErrNotFound 要吊销的会话不存在或不属于当前用户
+	ErrNotFound = errors.New("session: not found")
+)
+
+// Create 为用户创建会话，返回写入cookie的值
+func Create(ctx context.Context, userID, ip, userAgent string) (string, *models.Session, error) {
+	secrets := settings.Config().SessionConfig.Secrets
+	if len(secrets) == 0 || len(secrets[0]) < 32 {
+		return "", nil, ErrNoSecret
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	sid := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now().UTC()
+	s := &models.Session{
+		ID:         hashID(sid),
+		UserID:     userID,
+		IP:         ip,
+		UserAgent:  userAgent,
+		Device:     describeDevice(userAgent),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(maxLifetime()),
+	}
+	if err := redis.CreateSession(ctx, s, idleTimeout(), maxLifetime()); err != nil {
+		return "", nil, err
+	}
+	return sid + "." + sign(secrets[0], sid), s, nil
+}
+
+// Load 校验cookie并查询会话，闲置超时从本次访问重新计时，但不超过最长有效期
+func Load(ctx context.Context, cookie, ip string) (*models.Session, error) {
+	sid, ok := verify(cookie)
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+	s, err := redis.GetSession(ctx, hashID(sid))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if s == nil || !now.Before(s.ExpiresAt) {
+		return nil, ErrInvalidSession
+	}
+	if now.Sub(s.LastSeenAt) < touchInterval && ip == s.IP {
+		return s, nil
+	}
+	ttl := idleTimeout()
+	if left := s.ExpiresAt.Sub(now); left < ttl {
+		ttl = left
+	}
+	ok, err = redis.TouchSession(ctx, s.ID, ip, now, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+	s.LastSeenAt, s.IP = now.UTC(), ip
+	return s, nil
+}
+
+// List 用户的所有会话，currentID 对应的会话标记为当前会话
+func List(ctx context.Context, userID, currentID string) ([]*models.Session, error) {
+	sessions, err := redis.ListUserSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		s.Current = s.ID == currentID
+	}
+	return sessions, nil
+}
+
+// Revoke 吊销用户的一个会话，会话不属于该用户时返回 ErrNotFound
+func Revoke(ctx context.Context, userID, id string) error {
+	s, err := redis.GetSession(ctx, id)
+	if err != nil {
+		return err
+	}
+	if s == nil || s.UserID != userID {
+		return ErrNotFound
+	}
+	_, err = redis.DeleteSession(ctx, userID, id)
+	return err
+}
+
+// RevokeAll 吊销用户的所有会话，返回吊销的数量
+func RevokeAll(ctx context.Context, userID string) (int, error) {
+	return redis.DeleteUserSessions(ctx, userID)
+}
+
+// Cookie 按配置生成会话cookie，value 为空时生成删除cookie的响应头
+func Cookie(value string) *http.Cookie {
+	cfg := settings.Config().SessionConfig
+	c := &http.Cookie{
+		Name:     CookieName(),
+		Value:    value,
+		Path:     "/",
+		Domain:   cfg.Domain,
+		MaxAge:   int(maxLifetime().Seconds()),
+		Secure:   !cfg.InsecureCookie,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	switch strings.ToLower(cfg.SameSite) {
+	case "strict":
+		c.SameSite = http.SameSiteStrictMode
+	case "none":
+		c.SameSite = http.SameSiteNoneMode
+	}
+	if value == "" {
+		c.MaxAge = -1
+	}
+	return c
+}
+
+// CookieName 会话cookie的名称
+func CookieName() string {
+	if name := settings.Config().SessionConfig.CookieName; name != "" {
+		return name
+	}
+	return defaultCookieName
+}
+
+type sessionKey struct{}
+
+// NewContext 把会话放入 context，供 logic 层读取当前会话
+func NewContext(ctx context.Context, s *models.Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// FromContext 取出会话中间件放入的会话，不是通过会话认证时返回 nil
+func FromContext(ctx context.Context) *models.Session {
+	s, _ := ctx.Value(sessionKey{}).(*models.Session)
+	return s
+}
+
+// verify 用配置的各个密钥校验cookie签名，返回其中的会话ID
+func verify(cookie string) (string, bool) {
+	sid, sig, ok := strings.Cut(cookie, ".")
+	if !ok || sid == "" {
+		return "", false
+	}
+	for _, secret := range settings.Config().SessionConfig.Secrets {
+		if len(secret) >= 32 && hmac.Equal([]byte(sign(secret, sid)), []byte(sig)) {
+			return sid, true
+		}
+	}
+	return "", false
+}
+
+func sign(secret, sid string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(sid))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func hashID(sid string) string {
+	sum := sha256.Sum256([]byte(sid))
+	return hex.EncodeToString(sum[:])
+}
+
+func idleTimeout() time.Duration {
+	if d := settings.Config().SessionConfig.IdleTimeout; d > 0 {
+		return d
+	}
+	return defaultIdleTimeout
+}
+
+func maxLifetime() time.Duration {
+	if d := settings.Config().SessionConfig.MaxLifetime; d > 0 {
+		return d
+	}
+	return defaultMaxLifetime
+}
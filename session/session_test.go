@@ -0,0 +1,277 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"web_app/dao/redis"
+	"web_app/dao/redis/redistest"
+	"web_app/models"
+	"web_app/settings"
+)
+
+const ip = "192.0.2.1"
+
+var (
+	secret    = strings.Repeat("s", 32)
+	oldSecret = strings.Repeat("o", 32)
+)
+
+func useSession(t *testing.T, cfg settings.SessionConfig) {
+	t.Helper()
+	prev := settings.Config().SessionConfig
+	settings.Config().SessionConfig = cfg
+	t.Cleanup(func() { settings.Config().SessionConfig = prev })
+}
+
+func setup(t *testing.T, cfg settings.SessionConfig) (context.Context, *redistest.Store) {
+	t.Helper()
+	st, stop := redistest.Start()
+	t.Cleanup(stop)
+	if cfg.Secrets == nil {
+		cfg.Secrets = []string{secret}
+	}
+	useSession(t, cfg)
+	return context.Background(), st
+}
+
+func create(t *testing.T, ctx context.Context, userID string) (string, *models.Session) {
+	t.Helper()
+	cookie, s, err := Create(ctx, userID, ip, "Mozilla/5.0 (Windows NT 10.0) Chrome/120.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookie, s
+}
+
+// near 判断 got 与 want 相差不超过一秒
+func near(got, want time.Duration) bool {
+	d := got - want
+	return d > -time.Second && d < time.Second
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets []string
+		want    error
+	}{
+		{"ok", []string{secret}, nil},
+		{"no secret", []string{}, ErrNoSecret},
+		{"short secret", []string{"short", secret}, ErrNoSecret},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, st := setup(t, settings.SessionConfig{Secrets: tt.secrets})
+			_, s, err := Create(ctx, "1", ip, "curl/8.0")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if s.Device != "curl" || !s.ExpiresAt.Equal(s.CreatedAt.Add(defaultMaxLifetime)) {
+				t.Errorf("session = %+v", s)
+			}
+			if ttl := st.TTL("session:" + s.ID); !near(ttl, defaultIdleTimeout) {
+				t.Errorf("ttl = %v, want %v", ttl, defaultIdleTimeout)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	const idle = time.Hour
+	tests := []struct {
+		name        string
+		maxLifetime time.Duration
+		ip          string
+		// prepare 在加载前执行，返回要提交的cookie
+		prepare func(t *testing.T, ctx context.Context, st *redistest.Store, s *models.Session, cookie string) string
+		want    error
+		ttl     time.Duration // 加载后会话剩余的存活时间
+	}{
+		{"recent access is not renewed", 0, ip, func(_ *testing.T, _ context.Context, st *redistest.Store, _ *models.Session, cookie string) string {
+			st.FastForward(10 * time.Minute)
+			return cookie
+		}, nil, 50 * time.Minute},
+		{"access after the touch interval slides the idle timeout", 0, ip, func(t *testing.T, ctx context.Context, st *redistest.Store, s *models.Session, cookie string) string {
+			if _, err := redis.TouchSession(ctx, s.ID, ip, time.Now().Add(-2*touchInterval), idle); err != nil {
+				t.Fatal(err)
+			}
+			st.FastForward(10 * time.Minute)
+			return cookie
+		}, nil, idle},
+		{"access from a new IP is renewed at once", 0, "192.0.2.2", func(_ *testing.T, _ context.Context, st *redistest.Store, _ *models.Session, cookie string) string {
+			st.FastForward(10 * time.Minute)
+			return cookie
+		}, nil, idle},
+		{"renewal is capped by the max lifetime", 30 * time.Minute, "192.0.2.2", func(_ *testing.T, _ context.Context, _ *redistest.Store, _ *models.Session, cookie string) string {
+			return cookie
+		}, nil, 30 * time.Minute},
+		{"idle timeout", 0, ip, func(_ *testing.T, _ context.Context, st *redistest.Store, _ *models.Session, cookie string) string {
+			st.FastForward(idle)
+			return cookie
+		}, ErrInvalidSession, 0},
+		{"past the max lifetime", 0, ip, func(t *testing.T, ctx context.Context, _ *redistest.Store, s *models.Session, cookie string) string {
+			expired := *s
+			expired.ExpiresAt = time.Now().Add(-time.Second)
+			if err := redis.CreateSession(ctx, &expired, idle, idle); err != nil {
+				t.Fatal(err)
+			}
+			return cookie
+		}, ErrInvalidSession, 0},
+		{"tampered signature", 0, ip, func(_ *testing.T, _ context.Context, _ *redistest.Store, _ *models.Session, cookie string) string {
+			return cookie + "x"
+		}, ErrInvalidSession, 0},
+		{"missing signature", 0, ip, func(_ *testing.T, _ context.Context, _ *redistest.Store, _ *models.Session, cookie string) string {
+			sid, _, _ := strings.Cut(cookie, ".")
+			return sid
+		}, ErrInvalidSession, 0},
+		{"signed with a rotated-out secret", 0, ip, func(t *testing.T, _ context.Context, _ *redistest.Store, _ *models.Session, cookie string) string {
+			useSession(t, settings.SessionConfig{Secrets: []string{oldSecret, secret}, IdleTimeout: idle})
+			return cookie
+		}, nil, idle},
+		{"secret removed", 0, ip, func(t *testing.T, _ context.Context, _ *redistest.Store, _ *models.Session, cookie string) string {
+			useSession(t, settings.SessionConfig{Secrets: []string{oldSecret}, IdleTimeout: idle})
+			return cookie
+		}, ErrInvalidSession, 0},
+		{"revoked", 0, ip, func(t *testing.T, ctx context.Context, _ *redistest.Store, s *models.Session, cookie string) string {
+			if err := Revoke(ctx, s.UserID, s.ID); err != nil {
+				t.Fatal(err)
+			}
+			return cookie
+		}, ErrInvalidSession, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, st := setup(t, settings.SessionConfig{IdleTimeout: idle, MaxLifetime: tt.maxLifetime})
+			cookie, created := create(t, ctx, "1")
+			cookie = tt.prepare(t, ctx, st, created, cookie)
+			s, err := Load(ctx, cookie, tt.ip)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if s.ID != created.ID || s.IP != tt.ip {
+				t.Errorf("session = %+v", s)
+			}
+			if ttl := st.TTL("session:" + s.ID); !near(ttl, tt.ttl) {
+				t.Errorf("ttl = %v, want %v", ttl, tt.ttl)
+			}
+			// 续期后的访问记录对之后的查询可见
+			stored, err := redis.GetSession(ctx, s.ID)
+			if err != nil || stored.IP != s.IP || s.LastSeenAt.Sub(stored.LastSeenAt).Abs() >= time.Millisecond {
+				t.Errorf("stored = %+v, %v; loaded %+v", stored, err, s)
+			}
+		})
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	tests := []struct {
+		name string
+		id   func(own, other *models.Session) string
+		want error
+	}{
+		{"own session", func(own, _ *models.Session) string { return own.ID }, nil},
+		{"another user's session", func(_, other *models.Session) string { return other.ID }, ErrNotFound},
+		{"unknown session", func(*models.Session, *models.Session) string { return "unknown" }, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := setup(t, settings.SessionConfig{})
+			ownCookie, own := create(t, ctx, "1")
+			keptCookie, _ := create(t, ctx, "1")
+			otherCookie, other := create(t, ctx, "2")
+			if err := Revoke(ctx, "1", tt.id(own, other)); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			_, err := Load(ctx, ownCookie, ip)
+			if revoked := errors.Is(err, ErrInvalidSession); revoked != (tt.want == nil) {
+				t.Errorf("own session: load returned %v", err)
+			}
+			for _, cookie := range []string{keptCookie, otherCookie} {
+				if _, err := Load(ctx, cookie, ip); err != nil {
+					t.Errorf("unrelated session: %v", err)
+				}
+			}
+			sessions, err := List(ctx, "1", own.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 2
+			if tt.want == nil {
+				want = 1
+			}
+			if len(sessions) != want {
+				t.Errorf("listed %d sessions, want %d", len(sessions), want)
+			}
+		})
+	}
+}
+
+func TestRevokeAll(t *testing.T) {
+	ctx, st := setup(t, settings.SessionConfig{})
+	var cookies []string
+	for i := 0; i < 3; i++ {
+		cookie, _ := create(t, ctx, "1")
+		cookies = append(cookies, cookie)
+	}
+	otherCookie, _ := create(t, ctx, "2")
+	n, err := RevokeAll(ctx, "1")
+	if err != nil || n != 3 {
+		t.Fatalf("revoked %d, %v; want 3", n, err)
+	}
+	for _, cookie := range cookies {
+		if _, err := Load(ctx, cookie, ip); !errors.Is(err, ErrInvalidSession) {
+			t.Errorf("got %v, want %v", err, ErrInvalidSession)
+		}
+	}
+	if _, err := Load(ctx, otherCookie, ip); err != nil {
+		t.Errorf("other user's session: %v", err)
+	}
+	if st.Exists("session:user:1") {
+		t.Error("session index not cleared")
+	}
+	if n, err = RevokeAll(ctx, "1"); err != nil || n != 0 {
+		t.Errorf("second call revoked %d, %v; want 0", n, err)
+	}
+	// 之后新建的会话不受影响
+	cookie, _ := create(t, ctx, "1")
+	if _, err := Load(ctx, cookie, ip); err != nil {
+		t.Errorf("new session: %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	ctx, st := setup(t, settings.SessionConfig{IdleTimeout: time.Hour})
+	_, first := create(t, ctx, "1")
+	st.FastForward(30 * time.Minute)
+	_, second := create(t, ctx, "1")
+	create(t, ctx, "2")
+	sessions, err := List(ctx, "1", second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+	for _, s := range sessions {
+		if s.ID != first.ID && s.ID != second.ID {
+			t.Errorf("unexpected session %+v", s)
+		}
+		if s.Current != (s.ID == second.ID) {
+			t.Errorf("session %s: current = %v", s.ID, s.Current)
+		}
+	}
+	// 闲置超时的会话不再列出
+	st.FastForward(45 * time.Minute)
+	if sessions, err = List(ctx, "1", second.ID); err != nil || len(sessions) != 1 || sessions[0].ID != second.ID {
+		t.Errorf("after the first session timed out: %+v, %v", sessions, err)
+	}
+}
@@ -2,6 +2,9 @@ package settings
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/spf13/pflag"
 
@@ -18,6 +21,11 @@ type LogConfig struct {
 	MaxBackups int    `mapstructure:"max_backups"`
 }
 type MysqlConfig struct {
+	// 数据库驱动: mysql(默认) 或 sqlite，sqlite 使用纯Go实现，数据文件由 Path 指定
+	Driver      string `mapstructure:"driver"`
+	Path        string `mapstructure:"path"`
+	AutoMigrate bool   `mapstructure:"auto_migrate"` // 启动时执行迁移，sqlite 总是执行
+	Optional    bool   `mapstructure:"optional"`     // 可选依赖，连接失败时以降级模式启动
 	Host        string `mapstructure:"host"`
 	Port        string `mapstructure:"port"`
 	User        string `mapstructure:"user"`
@@ -25,30 +33,257 @@ type MysqlConfig struct {
 	DbName      string `mapstructure:"dbname"`
 	MaxIdleConn int    `mapstructure:"MaxIdleConn"`
 	MaxOpenConn int    `mapstructure:"MaxOpenConn"`
+	// 连接池生命周期，0表示不限制
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	// DSN参数
+	DialTimeout  time.Duration `mapstructure:"dial_timeout"`
+	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	TLS          string        `mapstructure:"tls"`       // true、false、skip-verify、preferred
+	Loc          string        `mapstructure:"loc"`       // 时区，例如 Asia/Shanghai，默认UTC
+	Collation    string        `mapstructure:"collation"` // 默认 utf8mb4_general_ci
+	// 连接池统计日志的输出间隔，0表示不输出
+	StatsInterval time.Duration `mapstructure:"stats_interval"`
+	// 超过该耗时的语句记录慢查询日志，默认200ms；Debug 为 true 时记录所有语句
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+	Debug         bool          `mapstructure:"debug"`
+	// 只读副本，账号密码和库名与主库相同
+	Replicas            []ReplicaConfig `mapstructure:"replicas"`
+	HealthCheckInterval time.Duration   `mapstructure:"health_check_interval"`
+}
+type ReplicaConfig struct {
+	Host   string `mapstructure:"host"`
+	Port   string `mapstructure:"port"`
+	Weight int    `mapstructure:"weight"` // 权重，小于等于0时按1处理
 }
 type RedisConfig struct {
+	Optional bool `mapstructure:"optional"` // 可选依赖，连接失败时以降级模式启动
+	// 部署模式: standalone(默认)、sentinel 或 cluster
+	Mode string `mapstructure:"mode"`
+	// standalone 模式的地址
+	Host string `mapstructure:"host"`
+	Port string `mapstructure:"port"`
+	// sentinel 模式下为哨兵地址，cluster 模式下为集群节点地址，格式 host:port
+	Addrs      []string `mapstructure:"addrs"`
+	MasterName string   `mapstructure:"master_name"` // sentinel 模式的主节点名称
+	PassWord   string   `mapstructure:"password"`
+	DB         int      `mapstructure:"db"` // cluster 模式只有0号库，该项被忽略
+	PoolSize   int      `mapstructure:"pool_size"`
+	// 超时，0表示使用 go-redis 的默认值（连接5s，读写3s）
+	DialTimeout  time.Duration `mapstructure:"dial_timeout"`
+	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	// 命令失败后的重试次数和重试间隔范围，0表示不重试
+	MaxRetries      int           `mapstructure:"max_retries"`
+	MinRetryBackoff time.Duration `mapstructure:"min_retry_backoff"`
+	MaxRetryBackoff time.Duration `mapstructure:"max_retry_backoff"`
+	TLS             bool          `mapstructure:"tls"`
+	TLSSkipVerify   bool          `mapstructure:"tls_skip_verify"` // 跳过证书校验，只用于测试环境
+	// 缓存前的进程内LRU层
+	LocalCache LocalCacheConfig `mapstructure:"local_cache"`
+}
+type LocalCacheConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Size    int           `mapstructure:"size"` // 最大条目数，默认10000
+	TTL     time.Duration `mapstructure:"ttl"`  // 本地副本最长存活时间，必须大于0
+	// 不走本地缓存的key前缀，例如 exchange_rate:latest
+	SkipPrefixes []string `mapstructure:"skip_prefixes"`
+}
+type StartupConfig struct {
+	// 依赖连接重试的截止时间，默认30s
+	Timeout time.Duration `mapstructure:"timeout"`
+	// 首次重试间隔，之后指数增长，默认1s
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+	// 关机时就绪探针开始失败后继续接收请求的时长，需要大于负载均衡的探测间隔，
+	// 否则摘除本实例之前转发来的请求会连接失败；默认10s，为负数时不等待
+	DrainDelay time.Duration `mapstructure:"drain_delay"`
+}
+type RatesConfig struct {
+	// 与上一次汇率相比允许的最大偏离比例，超过视为异常值丢弃，例如 0.2 表示 20%
+	MaxDeviation float64 `mapstructure:"max_deviation"`
+	// 同一数据源连续多少次给出彼此一致的偏离读数后认为行情确实变化并接受，默认3
+	ConfirmReadings int                  `mapstructure:"confirm_readings"`
+	Providers       []RateProviderConfig `mapstructure:"providers"`
+}
+type RateProviderConfig struct {
+	Name     string        `mapstructure:"name"`
+	Type     string        `mapstructure:"type"` // file 或 http
+	Path     string        `mapstructure:"path"` // type=file 时的本地文件路径，按扩展名识别 csv/json
+	URL      string        `mapstructure:"url"`  // type=http 时的数据源地址
+	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+type RateLimitConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// 按路由组配置的策略，key 为路由组名称（如 api_v1、api_v2），未配置的组使用 default
+	Policies map[string]RateLimitPolicy `mapstructure:"policies"`
+}
+type RateLimitPolicy struct {
+	Algorithm string        `mapstructure:"algorithm"` // sliding_window(默认) 或 token_bucket
+	Limit     int           `mapstructure:"limit"`     // 窗口内最大请求数 / 桶容量
+	Window    time.Duration `mapstructure:"window"`    // 窗口长度 / 补满桶的时间
+	KeyBy     string        `mapstructure:"key_by"`    // ip(默认)、user 或 api_key，后两者在认证通过后计数，未认证的请求按IP
+}
+type JobsConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	Workers     int           `mapstructure:"workers"`      // 工作goroutine数量，默认4
+	MaxAttempts int           `mapstructure:"max_attempts"` // 最大执行次数，超过进入死信队列，默认5
+	Backoff     time.Duration `mapstructure:"backoff"`      // 首次重试间隔，之后指数增长，默认1s
+	// 任务超过该时间未确认视为执行它的实例已崩溃，由其他实例认领，默认5m
+	VisibilityTimeout time.Duration `mapstructure:"visibility_timeout"`
+	// 关机时等待执行中任务完成的最长时间，默认30s
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"`
+}
+type CORSConfig struct {
+	// 默认策略，未配置的字段使用内置默认值
+	CORSPolicy `mapstructure:",squash"`
+	// 按路由组覆盖，key 为路由组前缀（如 /api/v2），按最长前缀匹配，未配置的字段沿用默认策略
+	Groups map[string]CORSPolicy `mapstructure:"groups"`
+}
+type CORSPolicy struct {
+	// 允许的来源，支持 * 通配（如 https://*.example.com）和 /正则/ 写法，单独的 * 表示允许所有来源，
+	// 此时 allow_credentials 不生效
+	AllowOrigins     []string      `mapstructure:"allow_origins"`
+	AllowMethods     []string      `mapstructure:"allow_methods"`
+	AllowHeaders     []string      `mapstructure:"allow_headers"`
+	ExposeHeaders    []string      `mapstructure:"expose_headers"`
+	AllowCredentials *bool         `mapstructure:"allow_credentials"`
+	MaxAge           time.Duration `mapstructure:"max_age"` // 预检结果的缓存时间
+}
+type AuthConfig struct {
+	Issuer   string `mapstructure:"issuer"`
+	Audience string `mapstructure:"audience"`
+	// 令牌有效期，默认访问令牌15m、刷新令牌720h；刷新令牌每次使用后轮换，有效期重新计算
+	AccessTTL  time.Duration `mapstructure:"access_ttl"`
+	RefreshTTL time.Duration `mapstructure:"refresh_ttl"`
+	// 校验 exp、nbf、iat 时允许的时钟偏差
+	Leeway time.Duration `mapstructure:"leeway"`
+	// 签发令牌使用的密钥，为空时使用第一个带私钥的密钥
+	ActiveKey string `mapstructure:"active_key"`
+	// 密钥集合，按令牌头中的 kid 选择校验密钥。轮换时先加入新密钥，所有实例加载后再切换 active_key，
+	// 旧密钥保留到它签发的令牌全部过期后删除；只有公钥的密钥只用于校验
+	Keys []AuthKey `mapstructure:"keys"`
+}
+type AuthKey struct {
+	Kid    string `mapstructure:"kid"`
+	Alg    string `mapstructure:"alg"`    // HS256、RS256 或 EdDSA
+	Secret string `mapstructure:"secret"` // HS256 的共享密钥，至少32字节
+	// RS256、EdDSA 的密钥，以 -----BEGIN 开头时为PEM内容，否则为PEM文件路径；有私钥时可以省略公钥
+	PrivateKey string `mapstructure:"private_key"`
+	PublicKey  string `mapstructure:"public_key"`
+}
+type APIKeyConfig struct {
+	// 派生API Key签名密钥的主密钥，每个至少32字节。第一个用于新签发的Key，其余只用于校验；
+	// 轮换时把新主密钥放在最前面，旧主密钥派生的Key全部重新签发后再删除
+	Secrets []string `mapstructure:"secrets"`
+	// 请求时间戳与服务器时间允许的最大偏差，默认5m
+	MaxSkew time.Duration `mapstructure:"max_skew"`
+}
+type AccountConfig struct {
+	BcryptCost int `mapstructure:"bcrypt_cost"` // 密码哈希的计算强度，默认12
+	// 邮箱验证链接的有效期，默认24h
+	VerificationTTL time.Duration `mapstructure:"verification_ttl"`
+	// 邮件中的验证链接，验证令牌追加在末尾，例如 http://localhost:5173/verify-email?token=
+	VerificationURL string `mapstructure:"verification_url"`
+	// 为 true 时邮箱验证前不能登录
+	RequireVerifiedEmail bool `mapstructure:"require_verified_email"`
+}
+type MailConfig struct {
+	Driver string `mapstructure:"driver"` // file(默认) 或 smtp
+	From   string `mapstructure:"from"`
+	// file 驱动的邮件目录，每封邮件保存为一个 .eml 文件，默认 ./outbox
+	OutboxDir string `mapstructure:"outbox_dir"`
+	// smtp 驱动的服务器地址和账号，账号为空时不认证
 	Host     string `mapstructure:"host"`
 	Port     string `mapstructure:"port"`
-	PassWord string `mapstructure:"password"`
-	DB       int    `mapstructure:"db"`
-	PoolSize int    `mapstructure:"pool_size"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// smtp 驱动连接和发送一封邮件的超时，默认30s
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+type SessionConfig struct {
+	CookieName string `mapstructure:"cookie_name"` // 默认 sid
+	// 签名cookie的密钥，每个至少32字节。第一个用于签名，其余只用于校验，轮换方式与API Key主密钥相同
+	Secrets []string `mapstructure:"secrets"`
+	// 闲置超过 IdleTimeout 的会话失效，每次访问重新计时，默认24h；无论是否活跃，
+	// 会话自创建起最长有效 MaxLifetime，默认720h
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+	MaxLifetime time.Duration `mapstructure:"max_lifetime"`
+	Domain      string        `mapstructure:"domain"`
+	SameSite    string        `mapstructure:"same_site"` // lax(默认)、strict 或 none，跨站的非安全请求无论哪种都会被拒绝
+	// 本地通过 http 调试时设为 true，否则浏览器不会保存带 Secure 属性的cookie
+	InsecureCookie bool `mapstructure:"insecure_cookie"`
+}
+type SecurityConfig struct {
+	// 可信的反向代理地址或网段，只有来自这些地址的请求才采信 X-Forwarded-For 等请求头；
+	// 为空时不信任任何代理，客户端IP取连接的对端地址。按IP的限流、登录锁定和验证码都依赖它
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	// 账号在 FailureWindow 内连续登录失败 MaxFailures 次（默认5次、15m）后锁定，
+	// 同一IP失败 IPMaxFailures 次（默认20次）后锁定该IP
+	MaxFailures   int           `mapstructure:"max_failures"`
+	IPMaxFailures int           `mapstructure:"ip_max_failures"`
+	FailureWindow time.Duration `mapstructure:"failure_window"`
+	// 首次锁定 LockoutBase（默认1m），24小时内每再锁定一次时长翻倍，最长 LockoutMax（默认1h）
+	LockoutBase time.Duration `mapstructure:"lockout_base"`
+	LockoutMax  time.Duration `mapstructure:"lockout_max"`
+	// 账号或IP失败次数达到 CaptchaAfter（默认3次）后登录需要验证码，同一IP注册失败同样计数
+	CaptchaAfter int           `mapstructure:"captcha_after"`
+	CaptchaTTL   time.Duration `mapstructure:"captcha_ttl"` // 验证码有效期，默认5m
+	// 加密保存TOTP密钥的密钥，至少32字节，未配置时不能开启两步验证
+	TOTPKey    string `mapstructure:"totp_key"`
+	TOTPIssuer string `mapstructure:"totp_issuer"` // 认证器App中显示的服务名称，默认为应用名称
 }
 type AppConfig struct {
 	Name string `mapstructure:"name"`
 	Port string `mapstructure:"port"`
 }
 type config struct {
-	Name        string `mapstructure:"name"`
-	Mode        string `mapstructure:"mode"`
-	Port        string `mapstructure:"port"`
-	Version     string `mapstructure:"version"`
-	LogConfig   `mapstructure:"log"`
-	MysqlConfig `mapstructure:"mysql"`
-	RedisConfig `mapstructure:"redis"`
+	Name            string `mapstructure:"name"`
+	Mode            string `mapstructure:"mode"`
+	Port            string `mapstructure:"port"`
+	Version         string `mapstructure:"version"`
+	AdminToken      string `mapstructure:"admin_token"` // 管理接口令牌，通过 X-Admin-Token 请求头传入，为空时禁止访问
+	LogConfig       `mapstructure:"log"`
+	MysqlConfig     `mapstructure:"mysql"`
+	RedisConfig     `mapstructure:"redis"`
+	RatesConfig     `mapstructure:"rates"`
+	StartupConfig   `mapstructure:"startup"`
+	RateLimitConfig `mapstructure:"rate_limit"`
+	JobsConfig      `mapstructure:"jobs"`
+	CORSConfig      `mapstructure:"cors"`
+	AuthConfig      `mapstructure:"auth"`
+	APIKeyConfig    `mapstructure:"api_keys"`
+	AccountConfig   `mapstructure:"account"`
+	MailConfig      `mapstructure:"mail"`
+	SessionConfig   `mapstructure:"session"`
+	SecurityConfig  `mapstructure:"security"`
+}
+
+// current 当前生效的配置。热加载时解码到新的结构体再整体替换指针，
+// 读取方拿到的总是一份完整的配置，不会读到替换到一半的字段
+var current atomic.Pointer[config]
+
+func init() {
+	current.Store(new(config))
+}
+
+// Config 返回当前配置。同一次处理中需要读取多个相关字段时先保存返回值，保证读到的是同一版本
+func Config() *config {
+	return current.Load()
 }
 
-// 全局配置变量
-var Config = new(config)
+var (
+	hooksMu     sync.Mutex
+	changeHooks []func()
+)
+
+// OnChange 注册配置热加载后的回调，需要根据配置重建状态的模块（如编译好的CORS策略）在这里刷新
+func OnChange(fn func()) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	changeHooks = append(changeHooks, fn)
+}
 
 // 指出返回值为err，里面return会默认返回err
 func Init() error {
@@ -75,18 +310,28 @@ func Init() error {
 		fmt.Printf("读取配置文件错误:%v\n", err)
 		return err
 	}
-	if err := viper.Unmarshal(Config); err != nil {
+	cfg := new(config)
+	if err := viper.Unmarshal(cfg); err != nil {
 		fmt.Printf("配置无法解码为结构体:%v\n", err)
 		return err
 	}
+	current.Store(cfg)
 	//配置文件热加载
 	viper.OnConfigChange(func(e fsnotify.Event) {
 		//fmt.Println("配置文件发生变化...")
-		fmt.Println(Config)
-		if err := viper.Unmarshal(Config); err != nil {
+		// 解码到新的结构体再整体替换，配置文件中删除的map和切片项不会残留
+		fresh := new(config)
+		if err := viper.Unmarshal(fresh); err != nil {
 			fmt.Printf("配置无法解码为结构体:%v\n", err)
+			return
+		}
+		current.Store(fresh)
+		hooksMu.Lock()
+		hooks := append([]func(){}, changeHooks...)
+		hooksMu.Unlock()
+		for _, fn := range hooks {
+			fn()
 		}
-		fmt.Println(Config)
 	})
 	viper.WatchConfig()
 	return nil
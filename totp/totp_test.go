@@ -0,0 +1,62 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret RFC 6238 附录B中 SHA1 测试向量使用的密钥 "12345678901234567890"
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestCodeRFC6238 附录B的8位结果取低6位
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// 1111111111 位于第 37037037 个时间步，1111111109 位于前一个
+	now := time.Unix(1111111111, 0)
+	tests := []struct {
+		name     string
+		secret   string
+		passcode string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfcSecret, "050471", 0, 37037037, true},
+		{"previous step within skew", rfcSecret, "081804", 1, 37037036, true},
+		{"previous step without skew", rfcSecret, "081804", 0, 0, false},
+		{"wrong code", rfcSecret, "123456", 1, 0, false},
+		{"wrong length", rfcSecret, "50471", 1, 0, false},
+		{"secret with spaces and lower case", "gezd gnbv gy3t qojq gezd gnbv gy3t qojq", "050471", 0, 37037037, true},
+		{"malformed secret", "not base32!", "050471", 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.secret, tt.passcode, now, tt.skew)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate = (%d, %v), want (%d, %v)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}